@@ -50,6 +50,10 @@ socket_path = "~/.kai/kai.sock"
 [collection]
 poll_interval_ms = 1000
 active_agent_only = true
+watch_roots = []
+# Reads of these files are recorded. "~/" means every user's home and
+# relative entries match inside watched workspaces.
+sensitive_paths = ["~/.ssh", "~/.aws/credentials", "~/.aws/config", "~/.config/gcloud", "~/.azure", "~/.kube/config", "~/.docker/config.json", "~/.netrc", "~/.git-credentials", "~/.npmrc", "~/.pypirc", "~/.config/gh/hosts.yml", "~/.gnupg/private-keys-v1.d", "~/.config/google-chrome/*/Cookies", "~/.config/google-chrome/*/Login Data", "~/.config/chromium/*/Cookies", "~/.config/chromium/*/Login Data", "~/.mozilla/firefox/*/cookies.sqlite", "~/.mozilla/firefox/*/logins.json", "~/.mozilla/firefox/*/key4.db", ".env", ".env.*"]
 
 [snapshot]
 enabled = true
@@ -58,10 +62,38 @@ skip_extensions = [".jpg", ".jpeg", ".png", ".gif", ".mp4", ".zip", ".tar", ".gz
 
 [risk]
 min_display_score = 0
+# Extra risk rules, reloaded when the file changes. Try them with
+# kai rules test <fixture>.
+rules_file = "~/.kai/rules.toml"
 
 [privacy]
 extra_skip_paths = []
 
 [network]
 extra_ai_domains = []
+
+[network.dns]
+enabled = false
+listen = "127.0.0.153:53"
+upstream = ""
+
+# Agents beyond the built-in ones. An entry with a built-in id (claude,
+# codex, cursor, ...) adds to that agent instead.
+# process_names, argv (regular expressions over the full command line)
+# and exe_paths (globs) must all match when given; ancestor takes the same
+# keys and must match some parent process. env lists variables, NAME or
+# NAME=value, the agent sets for everything it runs.
+# [[agents]]
+# id = "aider"
+# name = "Aider"
+# argv = ['(^|/)aider( |$)']
+# domains = ["api.deepseek.com"]
+# ports = []
+#
+# [[agents]]
+# id = "inhouse"
+# process_names = ["node"]
+# argv = ['agent/dist/main\.js']
+# ancestor = { process_names = ["tmux"] }
+# env = ["INHOUSE_AGENT_RUN", "TERM_PROGRAM=inhouse"]
 `
@@ -46,22 +46,8 @@ func newDaemonCmd() *cobra.Command {
 			return nil
 		},
 	})
-	cmd.AddCommand(&cobra.Command{
-		Use:    "run",
-		Short:  "Run daemon in foreground",
-		Hidden: true,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load("")
-			if err != nil {
-				return err
-			}
-			d, err := daemon.New(cfg)
-			if err != nil {
-				return err
-			}
-			return d.Start()
-		},
-	})
+	cmd.AddCommand(newDaemonRunCmd())
+	cmd.AddCommand(newDaemonReplayCmd())
 	cmd.AddCommand(&cobra.Command{
 		Use:   "stop",
 		Short: "Stop daemon",
@@ -125,9 +111,97 @@ func newDaemonCmd() *cobra.Command {
 				fmt.Printf("daemon: running pid=%d\n", st.PID)
 				return nil
 			}
-			fmt.Printf("daemon: running pid=%d uptime=%s events=%d\n", resp.Status.PID, resp.Status.Uptime.Truncate(time.Second), resp.Status.Events)
+			fmt.Printf("daemon: running pid=%d uptime=%s events=%d dropped=%d\n", resp.Status.PID, resp.Status.Uptime.Truncate(time.Second), resp.Status.Events, resp.Status.Dropped)
+			printStages(resp.Status.Stages)
+			if resp.Status.Dropped > 0 {
+				fmt.Println("warning: events were dropped under load; the audit trail has gaps")
+			}
 			return nil
 		},
 	})
 	return cmd
 }
+
+func newDaemonRunCmd() *cobra.Command {
+	var record string
+	cmd := &cobra.Command{
+		Use:    "run",
+		Short:  "Run daemon in foreground",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err != nil {
+				return err
+			}
+			d, err := daemon.New(cfg)
+			if err != nil {
+				return err
+			}
+			if record != "" {
+				if err := d.Record(record); err != nil {
+					return err
+				}
+			}
+			return d.Start()
+		},
+	}
+	cmd.Flags().StringVar(&record, "record", "", "append every raw event, exec root, hook report and DNS answer to this JSONL file")
+	return cmd
+}
+
+func newDaemonReplayCmd() *cobra.Command {
+	var (
+		dbPath   string
+		realtime bool
+	)
+	cmd := &cobra.Command{
+		Use:   "replay <events.jsonl>",
+		Short: "Replay a recorded event stream into a scratch database",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err != nil {
+				return err
+			}
+			if err := daemon.LoadAgents(cfg); err != nil {
+				return err
+			}
+			if _, err := daemon.LoadRiskRules(cfg.Risk.RulesFile); err != nil {
+				return fmt.Errorf("%s: %w", cfg.Risk.RulesFile, err)
+			}
+			if dbPath == "" {
+				dir, err := os.MkdirTemp("", "kai-replay-")
+				if err != nil {
+					return err
+				}
+				dbPath = filepath.Join(dir, "kai.db")
+			}
+			sessions, err := daemon.Replay(cmd.Context(), dbPath, args[0], realtime)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("db: %s\n", dbPath)
+			for _, s := range sessions {
+				fmt.Printf("%s %-8s %s -> %s files:%d exec:%d net:%d risk:%d\n", s.ID, strings.ToUpper(string(s.Agent)), s.StartedAt.Local().Format("15:04:05"), s.LastActivity.Local().Format("15:04:05"), s.FileWrites+s.FileCreates+s.FileDeletes, s.ExecCount, s.NetCount, s.MaxRisk)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dbPath, "db", "", "database to replay into (default: a new temporary one)")
+	cmd.Flags().BoolVar(&realtime, "realtime", false, "keep the recorded gaps between events instead of replaying as fast as possible")
+	return cmd
+}
+
+func printStages(stages []daemon.StageStats) {
+	if len(stages) == 0 {
+		return
+	}
+	fmt.Printf("  %-16s %11s %10s %8s\n", "stage", "queued", "in", "dropped")
+	for _, st := range stages {
+		queued := "-"
+		if st.Capacity > 0 {
+			queued = fmt.Sprintf("%d/%d", st.Depth, st.Capacity)
+		}
+		fmt.Printf("  %-16s %11s %10d %8d\n", st.Name, queued, st.In, st.Dropped)
+	}
+}
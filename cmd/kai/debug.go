@@ -21,7 +21,7 @@ func newDebugCmd() *cobra.Command {
 func newDebugNetCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "net",
-		Short: "Show raw NET_CONNECT events from collector",
+		Short: "Show raw NET_CONNECT/NET_LISTEN events from collector",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load("")
 			if err != nil {
@@ -48,7 +48,11 @@ func newDebugNetCmd() *cobra.Command {
 				if proc == "" {
 					proc = "-"
 				}
-				fmt.Fprintf(os.Stdout, "[%s] pid=%d proc=%s target=%s\n", rev.Timestamp.Local().Format("15:04:05"), rev.PID, strings.ToUpper(proc), rev.Target)
+				proto := rev.Protocol
+				if proto == "" {
+					proto = "tcp"
+				}
+				fmt.Fprintf(os.Stdout, "[%s] %s/%s pid=%d proc=%s target=%s\n", rev.Timestamp.Local().Format("15:04:05"), rev.ActionType, proto, rev.PID, strings.ToUpper(proc), rev.Target)
 			}
 		},
 	}
@@ -90,7 +94,11 @@ func newDebugClassifyCmd() *cobra.Command {
 				if proc == "" {
 					proc = "-"
 				}
-				fmt.Fprintf(os.Stdout, "[%s] agent=%-8s pid=%d proc=%s target=%s\n", raw.Timestamp.Local().Format("15:04:05"), agent, raw.PID, strings.ToUpper(proc), raw.Target)
+				via := ev.Attribution.String()
+				if via == "" {
+					via = "-"
+				}
+				fmt.Fprintf(os.Stdout, "[%s] agent=%-8s pid=%d proc=%s target=%s via=%s\n", raw.Timestamp.Local().Format("15:04:05"), agent, raw.PID, strings.ToUpper(proc), raw.Target, via)
 			}
 		},
 	}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kai-ai/kai/pkg/config"
+	"github.com/kai-ai/kai/pkg/daemon"
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// maxTranscript caps how much terminal output kai exec keeps.
+const maxTranscript = 4 << 20
+
+func newExecCmd() *cobra.Command {
+	var agent string
+	cmd := &cobra.Command{
+		Use:   "exec --agent <id> -- <command> [args...]",
+		Short: "Run an agent under kai supervision",
+		Long: "Run a command as the given agent. Everything it starts is attributed to that agent,\n" +
+			"and its terminal output is kept with the session for kai replay --transcript.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if agent == "" {
+				return errors.New("--agent is required")
+			}
+			cfg, err := config.Load("")
+			if err != nil {
+				return err
+			}
+			id := models.AgentID(strings.ToLower(agent))
+			run := &daemon.ExecRun{PID: os.Getpid(), Command: strings.Join(args, " "), StartedAt: time.Now()}
+
+			registered := false
+			if st, _ := daemon.RunningStatus(cfg); st.Running {
+				if _, err := rpcCall(cfg, daemon.RPCRequest{Action: "exec_start", Agent: &id, Exec: run}); err != nil {
+					return err
+				}
+				registered = true
+			} else {
+				fmt.Fprintln(os.Stderr, "kai: daemon not running; this run will not be recorded")
+			}
+
+			var out transcript
+			child := exec.Command(args[0], args[1:]...)
+			// Shell hooks inside the agent report its commands by this marker.
+			child.Env = append(os.Environ(), "KAI_AGENT="+string(id))
+			code, runErr := runCaptured(child, &out)
+			if runErr != nil {
+				// The command did not run; the run is still ended so the
+				// daemon does not keep it open.
+				code = -1
+			}
+			if registered {
+				run.EndedAt = time.Now()
+				run.ExitCode = code
+				if runErr == nil {
+					run.Transcript, run.Marks, run.Truncated = out.buf, out.marks, out.truncated
+				}
+				resp, err := rpcCall(cfg, daemon.RPCRequest{Action: "exec_end", Agent: &id, Exec: run})
+				switch {
+				case runErr != nil:
+					// Returned below; there is nothing to report.
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "kai: transcript not saved: %v\n", err)
+				case len(resp.Sessions) == 0:
+					fmt.Fprintln(os.Stderr, "kai: no activity was recorded for this run")
+				default:
+					for _, s := range resp.Sessions {
+						fmt.Fprintf(os.Stderr, "kai: recorded in session %s\n", s.ID)
+					}
+				}
+			}
+			if runErr != nil {
+				return runErr
+			}
+			if code != 0 {
+				if code < 0 {
+					code = 1
+				}
+				os.Exit(code)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&agent, "agent", "", "agent to attribute the command to (e.g. claude, codex)")
+	cmd.Flags().SetInterspersed(false)
+	return cmd
+}
+
+// transcript collects terminal output up to maxTranscript bytes, marking
+// the time at most once a second.
+type transcript struct {
+	mu        sync.Mutex
+	buf       []byte
+	marks     []models.TranscriptMark
+	lastMark  time.Time
+	truncated bool
+}
+
+func (t *transcript) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now := time.Now(); now.Sub(t.lastMark) >= time.Second && len(t.buf) < maxTranscript {
+		t.marks = append(t.marks, models.TranscriptMark{Offset: len(t.buf), At: now})
+		t.lastMark = now
+	}
+	room := maxTranscript - len(t.buf)
+	if len(p) > room {
+		t.buf = append(t.buf, p[:room]...)
+		t.truncated = true
+	} else {
+		t.buf = append(t.buf, p...)
+	}
+	return len(p), nil
+}
+
+// exitCode returns the command's exit status, or -1 when it was killed.
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// runPlain runs cmd on kai's own stdio, copying its output into t. It is
+// used when there is no terminal to give the command.
+func runPlain(cmd *exec.Cmd, t io.Writer) (int, error) {
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, t)
+	cmd.Stderr = io.MultiWriter(os.Stderr, t)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	stop := forwardSignals(cmd.Process)
+	defer stop()
+	return exitCode(cmd.Wait())
+}
+
+// forwardSignals passes termination requests on to p. Interrupts are only
+// swallowed: the terminal already delivers them to the whole process group.
+func forwardSignals(p *os.Process) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range sigs {
+			if sig != os.Interrupt {
+				_ = p.Signal(sig)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
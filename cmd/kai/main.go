@@ -17,6 +17,10 @@ func main() {
 	root.AddCommand(newStatusCmd())
 	root.AddCommand(newConfigCmd())
 	root.AddCommand(newDebugCmd())
+	root.AddCommand(newRulesCmd())
+	root.AddCommand(newExecCmd())
+	root.AddCommand(newShellInitCmd())
+	root.AddCommand(newShellIngestCmd())
 	if err := root.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// runCaptured runs cmd on a fresh pseudo-terminal so the agent keeps its
+// interactive UI, teeing everything it draws into t. Without a terminal on
+// stdin it falls back to plain pipes.
+func runCaptured(cmd *exec.Cmd, t io.Writer) (int, error) {
+	stdin := int(os.Stdin.Fd())
+	saved, err := unix.IoctlGetTermios(stdin, unix.TCGETS)
+	if err != nil {
+		return runPlain(cmd, t)
+	}
+	ptmx, pts, err := openPTY()
+	if err != nil {
+		return runPlain(cmd, t)
+	}
+	defer ptmx.Close()
+	resize(ptmx)
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = pts, pts, pts
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	err = cmd.Start()
+	pts.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	raw := *saved
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN], raw.Cc[unix.VTIME] = 1, 0
+	_ = unix.IoctlSetTermios(stdin, unix.TCSETS, &raw)
+	defer unix.IoctlSetTermios(stdin, unix.TCSETS, saved)
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for range winch {
+			resize(ptmx)
+		}
+	}()
+	stop := forwardSignals(cmd.Process)
+	defer stop()
+
+	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.MultiWriter(os.Stdout, t), ptmx)
+		close(copied)
+	}()
+	code, err := exitCode(cmd.Wait())
+	// Background children may still hold the terminal open; don't wait on
+	// them for long.
+	select {
+	case <-copied:
+	case <-time.After(time.Second):
+	}
+	return code, err
+}
+
+func openPTY() (*os.File, *os.File, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(ptmx.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	pts, err := os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	return ptmx, pts, nil
+}
+
+// resize copies kai's window size onto the agent's terminal.
+func resize(ptmx *os.File) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdin.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return
+	}
+	_ = unix.IoctlSetWinsize(int(ptmx.Fd()), unix.TIOCSWINSZ, ws)
+}
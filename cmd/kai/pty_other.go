@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os/exec"
+)
+
+func runCaptured(cmd *exec.Cmd, t io.Writer) (int, error) {
+	return runPlain(cmd, t)
+}
@@ -6,8 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
@@ -22,6 +26,8 @@ func newReplayCmd() *cobra.Command {
 	var agent string
 	var asJSON bool
 	var withDiff bool
+	var fullTranscript bool
+	var minConfidence int
 	cmd := &cobra.Command{
 		Use:   "replay [session-id|last] [file-path]",
 		Short: "Replay session",
@@ -50,12 +56,18 @@ func newReplayCmd() *cobra.Command {
 				return err
 			}
 			replay := resp.Replay
+			if minConfidence > 0 {
+				dropUnconfident(replay, minConfidence)
+			}
 			if asJSON {
 				b, _ := json.MarshalIndent(replay, "", "  ")
 				fmt.Println(string(b))
 				return nil
 			}
 			printReplay(replay)
+			for _, t := range replay.Transcripts {
+				printTranscript(t, fullTranscript)
+			}
 			if withDiff {
 				printReplayDiffs(replay, filterPath)
 			}
@@ -65,6 +77,8 @@ func newReplayCmd() *cobra.Command {
 	cmd.Flags().StringVar(&agent, "agent", "", "replay most recent session for agent")
 	cmd.Flags().BoolVar(&asJSON, "json", false, "json output")
 	cmd.Flags().BoolVar(&withDiff, "diff", false, "include inline diffs")
+	cmd.Flags().BoolVar(&fullTranscript, "transcript", false, "print the whole terminal transcript of kai exec runs")
+	cmd.Flags().IntVar(&minConfidence, "min-confidence", 0, "hide events attributed with less confidence (0-100)")
 	return cmd
 }
 
@@ -97,13 +111,21 @@ func printReplay(r *storage.ReplayResult) {
 		sort.Slice(files, func(i, j int) bool { return files[i].FilePath < files[j].FilePath })
 		fmt.Println(title)
 		for _, f := range files {
-			fmt.Printf("  %-40s +%d -%d\n", f.FilePath, f.LinesAdded, f.LinesRemoved)
+			fmt.Printf("  %-40s +%d -%d%s\n", f.FilePath, f.LinesAdded, f.LinesRemoved, formatAttribution(f.Attribution))
 		}
 		fmt.Println()
 	}
 	printFiles("MODIFIED", models.FileModified)
 	printFiles("CREATED", models.FileCreated)
 	printFiles("DELETED", models.FileDeleted)
+	if files := byType[models.FileRenamed]; len(files) > 0 {
+		sort.Slice(files, func(i, j int) bool { return files[i].FilePath < files[j].FilePath })
+		fmt.Println("RENAMED")
+		for _, f := range files {
+			fmt.Printf("  %s%s\n", formatRename(f), formatAttribution(f.Attribution))
+		}
+		fmt.Println()
+	}
 
 	if len(r.Execs) > 0 {
 		fmt.Println("EXECUTED")
@@ -112,19 +134,70 @@ func printReplay(r *storage.ReplayResult) {
 			if len(e.RiskLabels) > 0 {
 				warn = "  ⚠ " + strings.Join(e.RiskLabels, ", ")
 			}
-			fmt.Printf("  %s%s\n", e.Command, warn)
+			exit := ""
+			if e.Exit != nil {
+				exit = "  " + formatExit(*e.Exit)
+			}
+			if e.ContainerID != "" {
+				exit += "  [" + formatContainer(e.ContainerID, e.ContainerImage) + "]"
+			}
+			fmt.Printf("  %s%s%s%s\n", e.Command, exit, formatAttribution(e.Attribution), warn)
+		}
+		fmt.Println()
+	}
+
+	if len(r.Reads) > 0 {
+		fmt.Println("SENSITIVE READS")
+		for _, rd := range r.Reads {
+			warn := ""
+			if len(rd.RiskLabels) > 0 {
+				warn = "  ⚠ " + strings.Join(rd.RiskLabels, ", ")
+			}
+			fmt.Printf("  %s  by %s (pid %d)%s%s\n", rd.Path, rd.ProcessName, rd.PID, formatAttribution(rd.Attribution), warn)
 		}
 		fmt.Println()
 	}
 
-	if len(r.NetEvents) > 0 {
+	if conns := summarizeConnections(r.NetEvents); len(conns) > 0 {
 		fmt.Println("NETWORK")
-		for _, n := range r.NetEvents {
-			domain := n.RemoteIP
-			if n.Domain != nil {
-				domain = *n.Domain
+		for _, c := range conns {
+			fmt.Printf("  %s\n", c)
+		}
+		fmt.Println()
+	}
+	var listens []string
+	for _, n := range r.NetEvents {
+		if n.Action == models.ActionNetListen {
+			listens = append(listens, netEndpoint(n, true))
+		}
+	}
+	if len(listens) > 0 {
+		fmt.Println("LISTENING")
+		for _, l := range listens {
+			fmt.Printf("  %s\n", l)
+		}
+		fmt.Println()
+	}
+
+	if len(r.Unattributed) > 0 {
+		fmt.Println("NOT ATTRIBUTED")
+		for i, u := range r.Unattributed {
+			if i == unattributedShown {
+				fmt.Printf("  … and %d more\n", len(r.Unattributed)-i)
+				break
+			}
+			fmt.Printf("  %s\n", formatUnattributed(u))
+		}
+		fmt.Println()
+	}
+
+	if len(r.Correlated) > 0 {
+		fmt.Println("CORRELATED")
+		for _, c := range r.Correlated {
+			fmt.Printf("  ⚠  %s [%d]%s\n", c.Rule, c.RiskScore, formatAttribution(c.Attribution))
+			for _, t := range c.Triggers {
+				fmt.Printf("       %s  %-11s %s\n", t.Timestamp.Local().Format("15:04:05"), t.ActionType, t.Target)
 			}
-			fmt.Printf("  %s:%d\n", domain, n.RemotePort)
 		}
 		fmt.Println()
 	}
@@ -144,6 +217,297 @@ func printReplay(r *storage.ReplayResult) {
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 }
 
+// unattributedShown caps the file changes listed as not attributed.
+const unattributedShown = 20
+
+func formatUnattributed(u models.UnattributedEvent) string {
+	line := u.Timestamp.Local().Format("15:04:05") + "  " + strings.TrimPrefix(string(u.Action), "FILE_") + "  " + u.Path
+	if u.ProcessName != "" {
+		line += "  by " + u.ProcessName
+	}
+	if u.Reason != "" {
+		line += "  (" + u.Reason + ")"
+	}
+	return line
+}
+
+func formatAttribution(a models.Attribution) string {
+	if a.Method == "" {
+		return ""
+	}
+	return "  [" + a.String() + "]"
+}
+
+// dropUnconfident removes events attributed with less than minConfidence,
+// including those recorded before attributions were.
+func dropUnconfident(r *storage.ReplayResult, minConfidence int) {
+	files := r.Files[:0]
+	for _, f := range r.Files {
+		if f.Attribution.Confidence >= minConfidence {
+			files = append(files, f)
+		}
+	}
+	r.Files = files
+	execs := r.Execs[:0]
+	for _, e := range r.Execs {
+		if e.Attribution.Confidence >= minConfidence {
+			execs = append(execs, e)
+		}
+	}
+	r.Execs = execs
+	reads := r.Reads[:0]
+	for _, rd := range r.Reads {
+		if rd.Attribution.Confidence >= minConfidence {
+			reads = append(reads, rd)
+		}
+	}
+	r.Reads = reads
+	nets := r.NetEvents[:0]
+	for _, n := range r.NetEvents {
+		if n.Attribution.Confidence >= minConfidence {
+			nets = append(nets, n)
+		}
+	}
+	r.NetEvents = nets
+	correlated := r.Correlated[:0]
+	for _, c := range r.Correlated {
+		if c.Attribution.Confidence >= minConfidence {
+			correlated = append(correlated, c)
+		}
+	}
+	r.Correlated = correlated
+}
+
+// netEndpoint names a net event by domain when known. The port is dropped
+// for named endpoints so every connection to one host groups together.
+func netEndpoint(n models.NetEvent, withPort bool) string {
+	host := n.RemoteIP
+	if n.Domain != nil && *n.Domain != "" {
+		host = *n.Domain
+	} else {
+		withPort = true
+	}
+	v := host
+	if withPort {
+		v = net.JoinHostPort(host, strconv.Itoa(n.RemotePort))
+	}
+	if n.Protocol != "" && n.Protocol != "tcp" {
+		v += " (" + n.Protocol + ")"
+	}
+	return v
+}
+
+// summarizeConnections folds NET_CONNECT flows into one line per endpoint,
+// in order of first contact.
+func summarizeConnections(events []models.NetEvent) []string {
+	type agg struct {
+		count      int
+		sent, recv int64
+		open       int
+	}
+	var order []string
+	byEndpoint := map[string]*agg{}
+	for _, n := range events {
+		if n.Action != models.ActionNetConnect {
+			continue
+		}
+		key := netEndpoint(n, false)
+		a, ok := byEndpoint[key]
+		if !ok {
+			a = &agg{}
+			byEndpoint[key] = a
+			order = append(order, key)
+		}
+		a.count++
+		a.sent += n.BytesSent
+		a.recv += n.BytesRecv
+		if n.EndedAt == nil {
+			a.open++
+		}
+	}
+	lines := make([]string, 0, len(order))
+	for _, key := range order {
+		a := byEndpoint[key]
+		noun := "connections"
+		if a.count == 1 {
+			noun = "connection"
+		}
+		line := fmt.Sprintf("%s: %d %s", key, a.count, noun)
+		if a.sent > 0 || a.recv > 0 {
+			line += fmt.Sprintf(", %s up, %s down", formatBytes(a.sent), formatBytes(a.recv))
+		}
+		if a.open > 0 {
+			line += fmt.Sprintf(" (%d open)", a.open)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func formatExit(x models.ExecExit) string {
+	d := x.Duration.Round(time.Second)
+	if x.Duration < time.Second {
+		d = x.Duration.Round(time.Millisecond)
+	}
+	switch {
+	case x.Signal != 0:
+		return fmt.Sprintf("✗ killed by %s (%s)", signalName(x.Signal), d)
+	case x.Code == 0:
+		return fmt.Sprintf("✓ (%s)", d)
+	case x.Code < 0:
+		return fmt.Sprintf("exited (%s)", d)
+	default:
+		return fmt.Sprintf("✗ exit %d (%s)", x.Code, d)
+	}
+}
+
+// formatRename describes a renamed file, naming only the new base name when
+// the file stayed in the same directory.
+func formatRename(f models.SessionFile) string {
+	to := f.FilePath
+	if filepath.Dir(f.OldPath) == filepath.Dir(f.FilePath) {
+		to = filepath.Base(f.FilePath)
+	}
+	return fmt.Sprintf("renamed %s → %s (+%d -%d)", f.OldPath, to, f.LinesAdded, f.LinesRemoved)
+}
+
+// formatContainer names a container by image and short ID, the way docker
+// ps does.
+func formatContainer(id, image string) string {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	if image == "" {
+		return "container " + id
+	}
+	return image + " " + id
+}
+
+// signalName names the Linux signals commands usually die from.
+func signalName(sig int) string {
+	names := map[int]string{1: "SIGHUP", 2: "SIGINT", 3: "SIGQUIT", 6: "SIGABRT", 9: "SIGKILL", 11: "SIGSEGV", 13: "SIGPIPE", 15: "SIGTERM"}
+	if n, ok := names[sig]; ok {
+		return n
+	}
+	return "signal " + strconv.Itoa(sig)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// transcriptTail is how many transcript lines replay shows by default.
+const transcriptTail = 20
+
+func printTranscript(t models.Transcript, full bool) {
+	status := "running"
+	if !t.EndedAt.IsZero() {
+		status = fmt.Sprintf("exit %d, %s", t.ExitCode, t.EndedAt.Sub(t.StartedAt).Round(time.Second))
+	}
+	fmt.Println()
+	fmt.Printf("TERMINAL  %s  (%s)\n", t.Command, status)
+	lines := transcriptLines(t)
+	if !full && len(lines) > transcriptTail {
+		fmt.Printf("  … %d earlier lines (kai replay --transcript)\n", len(lines)-transcriptTail)
+		lines = lines[len(lines)-transcriptTail:]
+	}
+	for _, l := range lines {
+		fmt.Printf("  %s  %s\n", l.at.Local().Format("15:04:05"), l.text)
+	}
+	if t.Truncated {
+		fmt.Println("  … transcript truncated")
+	}
+}
+
+type transcriptLine struct {
+	at   time.Time
+	text string
+}
+
+// transcriptLines turns raw terminal output into plain text lines, each
+// stamped with the last mark before it started. Escape sequences are
+// dropped and a bare carriage return starts the line over, the way the
+// terminal would have drawn it. Blank lines are skipped.
+func transcriptLines(t models.Transcript) []transcriptLine {
+	var (
+		lines []transcriptLine
+		cur   []byte
+		start int
+		mark  int
+	)
+	at := func(off int) time.Time {
+		for mark+1 < len(t.Marks) && t.Marks[mark+1].Offset <= off {
+			mark++
+		}
+		if len(t.Marks) == 0 || t.Marks[mark].Offset > off {
+			return t.StartedAt
+		}
+		return t.Marks[mark].At
+	}
+	emit := func() {
+		if text := strings.TrimSpace(string(cur)); text != "" {
+			lines = append(lines, transcriptLine{at: at(start), text: text})
+		}
+		cur = cur[:0]
+	}
+	b := t.Content
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == '\n':
+			emit()
+			start = i + 1
+		case c == '\r':
+			if i+1 < len(b) && b[i+1] == '\n' {
+				continue
+			}
+			cur = cur[:0]
+		case c == 0x1b:
+			i = skipEscape(b, i)
+		case c == '\t' || c >= 0x20 && c != 0x7f:
+			cur = append(cur, c)
+		}
+	}
+	emit()
+	return lines
+}
+
+// skipEscape returns the index of the last byte of the escape sequence
+// starting at b[i].
+func skipEscape(b []byte, i int) int {
+	if i+1 >= len(b) {
+		return i
+	}
+	switch b[i+1] {
+	case '[':
+		for j := i + 2; j < len(b); j++ {
+			if b[j] >= 0x40 && b[j] <= 0x7e {
+				return j
+			}
+		}
+	case ']', 'P', '_':
+		for j := i + 2; j < len(b); j++ {
+			if b[j] == 0x07 {
+				return j
+			}
+			if b[j] == 0x1b && j+1 < len(b) && b[j+1] == '\\' {
+				return j + 1
+			}
+		}
+	default:
+		return i + 1
+	}
+	return len(b) - 1
+}
+
 func printReplayDiffs(r *storage.ReplayResult, filterPath string) {
 	for _, f := range r.Files {
 		if filterPath != "" && f.FilePath != filterPath {
@@ -3,8 +3,13 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
 )
 
 func TestUnifiedDiff(t *testing.T) {
@@ -29,3 +34,76 @@ func TestDecodeMaybeGzip(t *testing.T) {
 		t.Fatalf("unexpected decoded value: %q", got)
 	}
 }
+
+func TestSummarizeConnections(t *testing.T) {
+	domain := "api.anthropic.com"
+	ended := time.Now()
+	events := []models.NetEvent{
+		{Action: models.ActionNetConnect, RemoteIP: "160.79.104.10", RemotePort: 443, Domain: &domain, Protocol: "tcp", BytesSent: 1_000_000, BytesRecv: 20_000, EndedAt: &ended},
+		{Action: models.ActionNetConnect, RemoteIP: "127.0.0.1", RemotePort: 11434, Protocol: "tcp"},
+		{Action: models.ActionNetConnect, RemoteIP: "160.79.104.11", RemotePort: 443, Domain: &domain, Protocol: "tcp", BytesSent: 150_000, EndedAt: &ended},
+		{Action: models.ActionNetListen, RemoteIP: "0.0.0.0", RemotePort: 3000, Protocol: "tcp"},
+		{Action: models.ActionNetConnect, RemoteIP: "160.79.104.10", RemotePort: 443, Domain: &domain, Protocol: "tcp", BytesSent: 50_000, BytesRecv: 5_000, EndedAt: &ended},
+	}
+	got := summarizeConnections(events)
+	want := []string{
+		"api.anthropic.com: 3 connections, 1.2 MB up, 25.0 kB down",
+		"127.0.0.1:11434: 1 connection (1 open)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("summarizeConnections got %q, want %q", got, want)
+	}
+}
+
+func TestFormatExit(t *testing.T) {
+	cases := map[string]models.ExecExit{
+		"✗ exit 1 (12s)":           {Code: 1, Duration: 12*time.Second + 300*time.Millisecond},
+		"✓ (250ms)":                {Code: 0, Duration: 250 * time.Millisecond},
+		"✗ killed by SIGKILL (3s)": {Code: -1, Signal: 9, Duration: 3 * time.Second},
+		"exited (1m5s)":            {Code: -1, Duration: 65 * time.Second},
+	}
+	for want, x := range cases {
+		if got := formatExit(x); got != want {
+			t.Errorf("formatExit(%+v) = %q, want %q", x, got, want)
+		}
+	}
+}
+
+func TestDropUnconfident(t *testing.T) {
+	sure := models.Attribution{Method: models.AttrProcess, Confidence: 90}
+	guess := models.Attribution{Method: models.AttrWorkspace, Confidence: 50}
+	r := &storage.ReplayResult{
+		Files:     []models.SessionFile{{FilePath: "a.go", Attribution: sure}, {FilePath: "b.go", Attribution: guess}},
+		Execs:     []models.ExecEvent{{Command: "old"}, {Command: "make", Attribution: sure}},
+		Reads:     []models.ReadEvent{{Path: "/etc/shadow", Attribution: guess}},
+		NetEvents: []models.NetEvent{{RemoteIP: "1.2.3.4", Attribution: sure}},
+	}
+	dropUnconfident(r, 60)
+	if len(r.Files) != 1 || r.Files[0].FilePath != "a.go" || len(r.Execs) != 1 || r.Execs[0].Command != "make" || len(r.Reads) != 0 || len(r.NetEvents) != 1 {
+		t.Fatalf("expected only confident events to remain, got %+v", r)
+	}
+}
+
+func TestFormatRename(t *testing.T) {
+	cases := map[string]models.SessionFile{
+		"renamed /w/a.go → b.go (+3 -1)":        {OldPath: "/w/a.go", FilePath: "/w/b.go", LinesAdded: 3, LinesRemoved: 1},
+		"renamed /w/a.go → /w/pkg/a.go (+0 -0)": {OldPath: "/w/a.go", FilePath: "/w/pkg/a.go"},
+	}
+	for want, f := range cases {
+		if got := formatRename(f); got != want {
+			t.Errorf("formatRename(%+v) = %q, want %q", f, got, want)
+		}
+	}
+}
+
+func TestTranscriptLines(t *testing.T) {
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	content := "\x1b[1;32m$\x1b[0m npm test\r\n\x1b]0;title\x07loading 10%\rloading 100%\r\n\r\nok\r\n"
+	tr := models.Transcript{StartedAt: start, Content: []byte(content), Marks: []models.TranscriptMark{{Offset: 0, At: start}, {Offset: strings.Index(content, "ok"), At: start.Add(3 * time.Second)}}}
+
+	got := transcriptLines(tr)
+	want := []transcriptLine{{start, "$ npm test"}, {start, "loading 100%"}, {start.Add(3 * time.Second), "ok"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("transcriptLines got %+v, want %+v", got, want)
+	}
+}
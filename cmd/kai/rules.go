@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/config"
+	"github.com/kai-ai/kai/pkg/daemon"
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func newRulesCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "rules", Short: "Work with risk rules"}
+	cmd.AddCommand(newRulesTestCmd())
+	return cmd
+}
+
+// ruleCase is one [[cases]] entry of a rules fixture: an event, and the
+// labels and score the rules should give it.
+type ruleCase struct {
+	Name    string   `toml:"name"`
+	Action  string   `toml:"action"`
+	Target  string   `toml:"target"`
+	OldPath string   `toml:"old_path"`
+	Agent   string   `toml:"agent"`
+	Process string   `toml:"process"`
+	Domain  string   `toml:"domain"`
+	Labels  []string `toml:"labels"`
+	// NotLabels must not be given.
+	NotLabels []string `toml:"not_labels"`
+	Score     *int     `toml:"score"`
+}
+
+func newRulesTestCmd() *cobra.Command {
+	var rulesFile string
+	cmd := &cobra.Command{
+		Use:   "test <fixture>",
+		Short: "Check the risk rules against a fixture of sample events",
+		Long: "Load the rules file, failing on any rule that does not validate, and score each\n" +
+			"case of the fixture, a TOML file of [[cases]] such as:\n\n" +
+			"  [[cases]]\n" +
+			"  name = \"deleting a namespace\"\n" +
+			"  action = \"EXEC\"\n" +
+			"  target = \"kubectl delete ns prod\"\n" +
+			"  agent = \"codex\"\n" +
+			"  labels = [\"kubectl delete\"]\n" +
+			"  score = 90\n\n" +
+			"labels must all be given, not_labels none of them, and score is the total.",
+		Args: cobra.ExactArgs(1),
+		// Failing cases are reported above the error; usage would bury them.
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rulesFile == "" {
+				cfg, err := config.Load("")
+				if err != nil {
+					return err
+				}
+				rulesFile = cfg.Risk.RulesFile
+			}
+			n, err := daemon.LoadRiskRules(rulesFile)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rulesFile, err)
+			}
+			fmt.Printf("%d rules from %s\n\n", n, rulesFile)
+
+			var fixture struct {
+				Cases []ruleCase `toml:"cases"`
+			}
+			md, err := toml.DecodeFile(args[0], &fixture)
+			if err != nil {
+				return err
+			}
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				return fmt.Errorf("%s: unknown key %s", args[0], undecoded[0])
+			}
+			failed := 0
+			for i, c := range fixture.Cases {
+				if c.Name == "" {
+					c.Name = fmt.Sprintf("case %d", i+1)
+				}
+				problems, matched, score := runRuleCase(c)
+				status := "PASS"
+				if len(problems) > 0 {
+					status = "FAIL"
+					failed++
+				}
+				fmt.Printf("%s  %s  score=%d\n", status, c.Name, score)
+				for _, r := range matched {
+					fmt.Printf("      %s +%d (%s)\n", r.Label, r.Score, r.Level())
+				}
+				for _, p := range problems {
+					fmt.Printf("      ✗ %s\n", p)
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d cases failed", failed, len(fixture.Cases))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&rulesFile, "rules", "", "rules file (default: risk.rules_file from config)")
+	return cmd
+}
+
+// runRuleCase scores the case's event and lists how the result differs
+// from what the case expects. Only the rules score it: the mass file
+// operation count would otherwise carry over from case to case.
+func runRuleCase(c ruleCase) ([]string, []attribution.RiskRule, int) {
+	ev := &models.AgentEvent{
+		Timestamp:   time.Now(),
+		ActionType:  models.ActionType(strings.ToUpper(c.Action)),
+		Target:      c.Target,
+		OldPath:     c.OldPath,
+		Agent:       models.AgentID(strings.ToLower(c.Agent)),
+		ProcessName: c.Process,
+		Domain:      c.Domain,
+	}
+	matched := attribution.MatchRiskRules(ev)
+	score, labels := attribution.ScoreRules(matched)
+	var problems []string
+	for _, l := range c.Labels {
+		if !slices.Contains(labels, l) {
+			problems = append(problems, fmt.Sprintf("missing label %q", l))
+		}
+	}
+	for _, l := range c.NotLabels {
+		if slices.Contains(labels, l) {
+			problems = append(problems, fmt.Sprintf("unexpected label %q", l))
+		}
+	}
+	if c.Score != nil && score != *c.Score {
+		problems = append(problems, fmt.Sprintf("score %d, want %d", score, *c.Score))
+	}
+	return problems, matched, score
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+)
+
+func TestRulesTest(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.toml")
+	if err := os.WriteFile(rules, []byte(`
+[[rules]]
+label = "kubectl delete"
+score = 90
+argv = ['^kubectl\s+delete\b']
+agents = ["codex"]
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = attribution.LoadRiskRules(nil) })
+
+	var fixture strings.Builder
+	fixture.WriteString(`
+[[cases]]
+name = "deleting a namespace"
+action = "EXEC"
+target = "kubectl delete ns prod"
+agent = "codex"
+labels = ["kubectl delete"]
+score = 90
+`)
+	// More file cases than the mass file operation threshold; each is scored
+	// on its own.
+	for i := range 30 {
+		fmt.Fprintf(&fixture, "\n[[cases]]\naction = \"FILE_WRITE\"\ntarget = \"/work/f%d.txt\"\nagent = \"codex\"\nscore = 0\n", i)
+	}
+	run := func(cases string) error {
+		path := filepath.Join(dir, "cases.toml")
+		if err := os.WriteFile(path, []byte(cases), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := newRulesTestCmd()
+		cmd.SetArgs([]string{"--rules", rules, path})
+		return cmd.Execute()
+	}
+
+	if err := run(fixture.String()); err != nil {
+		t.Fatalf("expected every case to pass, got %v", err)
+	}
+	fixture.WriteString("\n[[cases]]\naction = \"EXEC\"\ntarget = \"kubectl delete ns prod\"\nagent = \"claude\"\nlabels = [\"kubectl delete\"]\n")
+	if err := run(fixture.String()); err == nil || err.Error() != "1 of 32 cases failed" {
+		t.Fatalf("expected the case for another agent to fail, got %v", err)
+	}
+}
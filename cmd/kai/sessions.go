@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -46,7 +47,7 @@ func newSessionsCmd() *cobra.Command {
 						dur = time.Since(s.StartedAt)
 					}
 				}
-				fmt.Printf("%s %-8s %s -> %s files:%d exec:%d net:%d risk:%d\n", s.ID, strings.ToUpper(string(s.Agent)), s.StartedAt.Local().Format("15:04:05"), end, s.FileWrites+s.FileCreates+s.FileDeletes, s.ExecCount, s.NetCount, s.MaxRisk)
+				fmt.Printf("%s %-8s %s -> %s files:%d exec:%d net:%d risk:%d%s\n", s.ID, strings.ToUpper(string(s.Agent)), s.StartedAt.Local().Format("15:04:05"), end, s.FileWrites+s.FileCreates+s.FileDeletes, s.ExecCount, s.NetCount, s.MaxRisk, sessionRepo(s))
 				_ = dur
 			}
 			return nil
@@ -56,3 +57,16 @@ func newSessionsCmd() *cobra.Command {
 	cmd.Flags().StringVar(&agent, "agent", "", "filter agent")
 	return cmd
 }
+
+// sessionRepo tells apart concurrent sessions of one agent by the
+// repository and branch they work in.
+func sessionRepo(s models.Session) string {
+	if s.RepoRoot == nil {
+		return ""
+	}
+	repo := " " + filepath.Base(*s.RepoRoot)
+	if s.RepoBranch != nil && *s.RepoBranch != "" {
+		repo += "@" + *s.RepoBranch
+	}
+	return repo
+}
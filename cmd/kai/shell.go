@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/config"
+	"github.com/kai-ai/kai/pkg/daemon"
+)
+
+func newShellInitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell-init bash|zsh|fish",
+		Short: "Print shell hooks that report every command to the daemon",
+		Long: "Print hooks that report each command an interactive shell runs to the kai daemon,\n" +
+			"so commands agents run through your shell are recorded even when they are too quick to poll.\n\n" +
+			"  bash:  eval \"$(kai shell-init bash)\"   in ~/.bashrc\n" +
+			"  zsh:   eval \"$(kai shell-init zsh)\"    in ~/.zshrc\n" +
+			"  fish:  kai shell-init fish | source   in ~/.config/fish/config.fish",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bin, err := os.Executable()
+			if err != nil {
+				bin = "kai"
+			}
+			script, err := shellHooks(args[0], bin)
+			if err != nil {
+				return err
+			}
+			fmt.Print(script)
+			return nil
+		},
+	}
+}
+
+// newShellIngestCmd is what the hooks run, in the background, after each
+// command.
+func newShellIngestCmd() *cobra.Command {
+	var (
+		c          daemon.ShellCommand
+		durationMS int64
+	)
+	cmd := &cobra.Command{
+		Use:    "shell-ingest -- <command line>",
+		Hidden: true,
+		Args:   cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err != nil {
+				return err
+			}
+			c.Command = strings.Join(args, " ")
+			c.Duration = time.Duration(durationMS) * time.Millisecond
+			c.EndedAt = time.Now()
+			_, err = rpcCall(cfg, daemon.RPCRequest{Action: "ingest_exec", Command: &c})
+			return err
+		},
+	}
+	cmd.Flags().IntVar(&c.PID, "pid", 0, "pid of the shell that ran the command")
+	cmd.Flags().StringVar(&c.Shell, "shell", "", "shell name")
+	cmd.Flags().StringVar(&c.CWD, "cwd", "", "working directory")
+	cmd.Flags().IntVar(&c.ExitCode, "exit", 0, "exit status")
+	cmd.Flags().Int64Var(&durationMS, "duration-ms", 0, "how long the command ran")
+	cmd.Flags().StringVar(&c.Marker, "marker", "", "agent marker variable set in the shell, as NAME=value")
+	return cmd
+}
+
+func shellHooks(shell, bin string) (string, error) {
+	var markers []string
+	for _, m := range attribution.EnvMarkers {
+		if !slices.Contains(markers, m.Name) {
+			markers = append(markers, m.Name)
+		}
+	}
+	var script, quoted string
+	switch shell {
+	case "bash":
+		script, quoted = bashHooks, shellQuote(bin)
+	case "zsh":
+		script, quoted = zshHooks, shellQuote(bin)
+	case "fish":
+		script, quoted = fishHooks, fishQuote(bin)
+	default:
+		return "", fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", shell)
+	}
+	return strings.NewReplacer("@KAI@", quoted, "@MARKERS@", strings.Join(markers, " ")).Replace(script), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// bashHooks reads the command line from history, falling back to the
+// first simple command when history did not record it. Everything after
+// the first command of a line is ignored until the next prompt.
+const bashHooks = `# kai shell integration
+if [ -z "${__kai_hooked:-}" ]; then
+__kai_hooked=1
+__kai_bin=@KAI@
+__kai_cmd=
+__kai_ready=
+__kai_histno=
+
+__kai_clock() {
+	if [ -n "${EPOCHREALTIME:-}" ]; then
+		__kai_t=${EPOCHREALTIME/[.,]/}
+	else
+		__kai_t=$((SECONDS * 1000000))
+	fi
+}
+
+__kai_preexec() {
+	[ -n "$__kai_ready" ] || return
+	[ -n "${COMP_LINE:-}" ] && return
+	__kai_ready=
+	local h
+	h=$(HISTTIMEFORMAT= builtin history 1 2>/dev/null)
+	if [[ $h =~ ^\ *([0-9]+)\*?\ +(.*)$ ]] && [ "${BASH_REMATCH[1]}" != "$__kai_histno" ]; then
+		__kai_histno=${BASH_REMATCH[1]}
+		__kai_cmd=${BASH_REMATCH[2]}
+	else
+		__kai_cmd=$BASH_COMMAND
+	fi
+	__kai_clock
+	__kai_start=$__kai_t
+}
+
+__kai_precmd() {
+	local s=$? v m=
+	if [ -n "$__kai_cmd" ]; then
+		__kai_clock
+		for v in @MARKERS@; do
+			if [ -n "${!v:-}" ]; then
+				m="$v=${!v}"
+				break
+			fi
+		done
+		("$__kai_bin" shell-ingest --shell bash --pid $$ --exit $s --duration-ms $(((__kai_t - __kai_start) / 1000)) --cwd "$PWD" --marker "$m" -- "$__kai_cmd" >/dev/null 2>&1 &)
+	fi
+	__kai_cmd=
+}
+
+trap '__kai_preexec' DEBUG
+PROMPT_COMMAND="__kai_precmd"$'\n'"${PROMPT_COMMAND:-}"$'\n'"__kai_ready=1"
+fi
+`
+
+const zshHooks = `# kai shell integration
+if [[ -z ${__kai_hooked:-} ]]; then
+typeset -g __kai_hooked=1 __kai_bin=@KAI@ __kai_cmd= __kai_start=
+zmodload zsh/datetime 2>/dev/null
+
+__kai_preexec() {
+	__kai_cmd=$1
+	__kai_start=$EPOCHREALTIME
+}
+
+__kai_precmd() {
+	local s=$? v m=
+	[[ -n $__kai_cmd ]] || return 0
+	local -i d=$(( (EPOCHREALTIME - __kai_start) * 1000 ))
+	for v in @MARKERS@; do
+		if [[ -n ${(P)v:-} ]]; then
+			m="$v=${(P)v}"
+			break
+		fi
+	done
+	"$__kai_bin" shell-ingest --shell zsh --pid $$ --exit $s --duration-ms $d --cwd "$PWD" --marker "$m" -- "$__kai_cmd" >/dev/null 2>&1 &!
+	__kai_cmd=
+}
+
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __kai_preexec
+add-zsh-hook precmd __kai_precmd
+fi
+`
+
+const fishHooks = `# kai shell integration
+if not set -q __kai_hooked
+set -g __kai_hooked 1
+set -g __kai_bin @KAI@
+
+function __kai_postexec --on-event fish_postexec
+	set -l s $status
+	test -n "$argv[1]"; or return
+	set -l m
+	for v in @MARKERS@
+		if set -q $v; and test -n "$$v"
+			set m "$v=$$v"
+			break
+		end
+	end
+	command $__kai_bin shell-ingest --shell fish --pid $fish_pid --exit $s --duration-ms $CMD_DURATION --cwd $PWD --marker "$m" -- $argv[1] >/dev/null 2>&1 &
+	disown 2>/dev/null
+end
+end
+`
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellHooks(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := shellHooks(shell, "/opt/it's/kai")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(script, "@") || !strings.Contains(script, "KAI_AGENT CLAUDECODE") || !strings.Contains(script, "shell-ingest --shell "+shell) {
+			t.Fatalf("%s hooks not filled in:\n%s", shell, script)
+		}
+		// Syntax-check with the shell itself when it is installed.
+		path, err := exec.LookPath(shell)
+		if err != nil || shell == "fish" {
+			continue
+		}
+		f := filepath.Join(t.TempDir(), "hooks")
+		if err := os.WriteFile(f, []byte(script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(path, "-n", f).CombinedOutput(); err != nil {
+			t.Fatalf("%s rejects its hooks: %v\n%s", shell, err, out)
+		}
+	}
+	if _, err := shellHooks("tcsh", "kai"); err == nil {
+		t.Fatal("expected unsupported shell to fail")
+	}
+}
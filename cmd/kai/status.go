@@ -33,11 +33,14 @@ func newStatusCmd() *cobra.Command {
 			now := time.Now()
 			for _, s := range sessions {
 				if s.EndedAt == nil && now.Sub(s.LastActivity) < 45*time.Second {
-					fmt.Printf("  ● %-12s session=%s active %s\n", stringsUpper(string(s.Agent)), s.ID, now.Sub(s.StartedAt).Truncate(time.Second))
+					fmt.Printf("  ● %-12s session=%s active %s%s\n", stringsUpper(string(s.Agent)), s.ID, now.Sub(s.StartedAt).Truncate(time.Second), sessionRepo(s))
 				}
 			}
 			if statusResp.Status != nil && statusResp.Status.Running {
 				fmt.Printf("\nDaemon: running pid=%d uptime=%s events=%d\n", statusResp.Status.PID, statusResp.Status.Uptime.Truncate(time.Second), statusResp.Status.Events)
+				if statusResp.Status.Dropped > 0 {
+					fmt.Printf("Warning: %d events dropped under load (see `kai daemon status`)\n", statusResp.Status.Dropped)
+				}
 			} else {
 				fmt.Println("\nDaemon: stopped")
 			}
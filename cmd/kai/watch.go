@@ -14,7 +14,7 @@ import (
 
 func newWatchCmd() *cobra.Command {
 	var agent string
-	var minRisk int
+	var minRisk, minConfidence int
 	cmd := &cobra.Command{
 		Use:   "watch",
 		Short: "Live event stream",
@@ -34,7 +34,7 @@ func newWatchCmd() *cobra.Command {
 				a := models.AgentID(strings.ToLower(agent))
 				aid = &a
 			}
-			if err := enc.Encode(daemon.RPCRequest{Action: "watch", Agent: aid, MinRisk: minRisk}); err != nil {
+			if err := enc.Encode(daemon.RPCRequest{Action: "watch", Agent: aid, MinRisk: minRisk, MinConfidence: minConfidence}); err != nil {
 				return err
 			}
 			for {
@@ -50,12 +50,19 @@ func newWatchCmd() *cobra.Command {
 				if len(ev.RiskLabels) > 0 {
 					warn = " \u26A0 " + strings.Join(ev.RiskLabels, ", ")
 				}
+				if ev.ContainerID != "" {
+					warn += " [" + formatContainer(ev.ContainerID, ev.ContainerImage) + "]"
+				}
+				if a := ev.Attribution.String(); a != "" {
+					warn += " (" + a + ")"
+				}
 				fmt.Fprintf(os.Stdout, "[%s] %-10s %-12s %-40s risk=%d%s\n", ev.Timestamp.Local().Format("15:04:05"), strings.ToUpper(string(ev.Agent)), ev.ActionType, trim(ev.Target, 40), ev.RiskScore, warn)
 			}
 		},
 	}
 	cmd.Flags().StringVar(&agent, "agent", "", "filter by agent")
 	cmd.Flags().IntVar(&minRisk, "min-risk", 0, "minimum risk score")
+	cmd.Flags().IntVar(&minConfidence, "min-confidence", 0, "hide events attributed with less confidence (0-100)")
 	return cmd
 }
 
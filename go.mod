@@ -7,7 +7,10 @@ require (
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/net v0.44.0
+	golang.org/x/sys v0.36.0
 	modernc.org/sqlite v1.40.0
+	mvdan.cc/sh/v3 v3.12.0
 )
 
 require (
@@ -19,7 +22,6 @@ require (
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
-	golang.org/x/sys v0.36.0 // indirect
 	modernc.org/libc v1.66.10 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
@@ -0,0 +1,332 @@
+package attribution
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// maxPartialMatches bounds the sequences a rule tracks per session; the
+// oldest are dropped first.
+const maxPartialMatches = 32
+
+// SequenceRule matches events of one session that happen in the order of
+// Steps, all within Window of the first. Each step sees the events matched
+// before it, so it can require the same file or host.
+type SequenceRule struct {
+	Label  string
+	Score  int
+	Window time.Duration
+	Steps  []func(e *models.AgentEvent, earlier []models.AgentEvent) bool
+}
+
+// SequenceMatch is a rule matched by Events, oldest first.
+type SequenceMatch struct {
+	Rule   SequenceRule
+	Events []models.AgentEvent
+}
+
+// Correlator follows the sequence rules through each session's events.
+type Correlator struct {
+	mu       sync.Mutex
+	rules    []SequenceRule
+	sessions map[string]*sequenceState
+}
+
+type sequenceState struct {
+	last time.Time
+	// partial holds, per rule, the sequences begun but not finished.
+	partial [][][]models.AgentEvent
+}
+
+func NewCorrelator(rules []SequenceRule) *Correlator {
+	return &Correlator{rules: rules, sessions: map[string]*sequenceState{}}
+}
+
+// Observe advances the sequences of ev's session and returns those ev
+// completes. A sequence that completes is forgotten along with the others
+// begun by the same event, so one secret read does not raise an alert for
+// every connection after it.
+func (c *Correlator) Observe(ev *models.AgentEvent) []SequenceMatch {
+	if ev.SessionID == "" || ev.ActionType == models.ActionCorrelated {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.sessions[ev.SessionID]
+	if !ok {
+		st = &sequenceState{partial: make([][][]models.AgentEvent, len(c.rules))}
+		c.sessions[ev.SessionID] = st
+	}
+	if ev.Timestamp.After(st.last) {
+		st.last = ev.Timestamp
+	}
+
+	var matches []SequenceMatch
+	for i, rule := range c.rules {
+		var kept [][]models.AgentEvent
+		var done []models.AgentEvent
+		for _, seq := range st.partial[i] {
+			if ev.Timestamp.Sub(seq[0].Timestamp) > rule.Window {
+				continue
+			}
+			kept = append(kept, seq)
+			if done != nil || !rule.Steps[len(seq)](ev, seq) {
+				continue
+			}
+			next := append(slices.Clip(seq), *ev)
+			if len(next) == len(rule.Steps) {
+				done = next
+				continue
+			}
+			// The shorter sequence stays: a later event may fit it better.
+			kept = append(kept, next)
+		}
+		if done != nil {
+			matches = append(matches, SequenceMatch{Rule: rule, Events: done})
+			kept = slices.DeleteFunc(kept, func(seq []models.AgentEvent) bool { return seq[0].ID == done[0].ID })
+		} else if rule.Steps[0](ev, nil) {
+			kept = append(kept, []models.AgentEvent{*ev})
+		}
+		if len(kept) > maxPartialMatches {
+			kept = kept[len(kept)-maxPartialMatches:]
+		}
+		st.partial[i] = kept
+	}
+	return matches
+}
+
+// Prune forgets sessions with no event within any rule's window.
+func (c *Correlator) Prune(now time.Time) {
+	var window time.Duration
+	for _, r := range c.rules {
+		window = max(window, r.Window)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, st := range c.sessions {
+		if now.Sub(st.last) > window {
+			delete(c.sessions, id)
+		}
+	}
+}
+
+var builtinSequenceRules = []SequenceRule{
+	{Label: "secret read then external connection", Score: 95, Window: 5 * time.Minute, Steps: []func(*models.AgentEvent, []models.AgentEvent) bool{
+		func(e *models.AgentEvent, _ []models.AgentEvent) bool {
+			switch sensitiveRead(e) {
+			case readBrowser, readCredentials, readEnv:
+				return true
+			case readSSHKey:
+				return !sshTools[e.ProcessName]
+			}
+			return false
+		},
+		func(e *models.AgentEvent, _ []models.AgentEvent) bool {
+			if e.ActionType != models.ActionNetConnect || (e.Domain != "" && isKnownAIDomain(e.Domain)) {
+				return false
+			}
+			host, _ := splitHostPort(e.Target)
+			if ip := net.ParseIP(host); ip != nil {
+				return !ip.IsLoopback() && !ip.IsUnspecified()
+			}
+			return host != "" && host != "localhost" && !isKnownAIDomain(host)
+		},
+	}},
+	{Label: "downloaded file made executable and run", Score: 95, Window: 10 * time.Minute, Steps: []func(*models.AgentEvent, []models.AgentEvent) bool{
+		func(e *models.AgentEvent, _ []models.AgentEvent) bool { return len(downloads(e)) > 0 },
+		func(e *models.AgentEvent, earlier []models.AgentEvent) bool {
+			return len(overlap(madeExecutable(e), downloads(&earlier[0]))) > 0
+		},
+		func(e *models.AgentEvent, earlier []models.AgentEvent) bool {
+			files := overlap(madeExecutable(&earlier[1]), downloads(&earlier[0]))
+			return anyCommand(e, func(argv []string) bool {
+				prog := argv[0]
+				if shells[commandName(argv)] && len(argv) > 1 {
+					prog = argv[1]
+				}
+				return slices.Contains(files, resolvePath(e.CWD, prog)) || !strings.Contains(prog, "/") && slices.ContainsFunc(files, func(f string) bool {
+					return filepath.Base(f) == prog
+				})
+			})
+		},
+	}},
+	{Label: "CI pipeline modified then pushed", Score: 85, Window: 30 * time.Minute, Steps: []func(*models.AgentEvent, []models.AgentEvent) bool{
+		func(e *models.AgentEvent, _ []models.AgentEvent) bool {
+			return isFileWrite(e) && strings.Contains(filepath.ToSlash(e.Target), ".github/workflows/")
+		},
+		func(e *models.AgentEvent, _ []models.AgentEvent) bool {
+			return anyCommand(e, func(argv []string) bool {
+				sub, _ := gitSubcommand(argv)
+				return sub == "push"
+			})
+		},
+	}},
+}
+
+// downloads returns the files a curl or wget in e saves to, resolved
+// against its working directory: the output option's file, the name taken
+// from the URL, or where the output is redirected.
+func downloads(e *models.AgentEvent) []string {
+	var files []string
+	for _, argv := range execCommands(e) {
+		for _, f := range downloadTargets(argv) {
+			files = append(files, resolvePath(e.CWD, f))
+		}
+	}
+	if e.ActionType == models.ActionExec {
+		for _, f := range redirectTargets(e.ExecArgs, e.Target, "curl", "wget") {
+			files = append(files, resolvePath(e.CWD, f))
+		}
+	}
+	return files
+}
+
+// downloadTargets returns the files one curl or wget command writes.
+func downloadTargets(argv []string) []string {
+	name := commandName(argv)
+	if name != "curl" && name != "wget" {
+		return nil
+	}
+	var files, urls []string
+	// wget names the file after the URL unless told otherwise; curl only
+	// with -O.
+	remote := name == "wget"
+	var dir string
+	output := func(f string) {
+		if name == "wget" {
+			remote = false
+		}
+		if f != "" && f != "-" {
+			files = append(files, f)
+		}
+	}
+	for i := 1; i < len(argv); i++ {
+		a := argv[i]
+		next := func() string {
+			if i+1 < len(argv) {
+				i++
+				return argv[i]
+			}
+			return ""
+		}
+		long, value, hasValue := strings.Cut(a, "=")
+		switch {
+		case !strings.HasPrefix(a, "-"):
+			if strings.Contains(a, "://") {
+				urls = append(urls, a)
+			}
+		case name == "curl" && long == "--output", name == "wget" && long == "--output-document":
+			if !hasValue {
+				value = next()
+			}
+			output(value)
+		case name == "curl" && (a == "--remote-name" || a == "--remote-name-all"):
+			remote = true
+		case name == "wget" && long == "--directory-prefix":
+			if !hasValue {
+				value = next()
+			}
+			dir = value
+		case strings.HasPrefix(a, "--"):
+		default:
+			// A cluster of short options; one taking a value takes the
+			// rest of the cluster or the next argument.
+			for j := 1; j < len(a); j++ {
+				var value string
+				switch {
+				case name == "curl" && a[j] == 'O':
+					remote = true
+					continue
+				case name == "curl" && a[j] == 'o', name == "wget" && (a[j] == 'O' || a[j] == 'P'):
+					if value = a[j+1:]; value == "" {
+						value = next()
+					}
+				default:
+					continue
+				}
+				if a[j] == 'P' {
+					dir = value
+				} else {
+					output(value)
+				}
+				break
+			}
+		}
+	}
+	if remote {
+		for _, raw := range urls {
+			if u, err := url.Parse(raw); err == nil {
+				if base := path.Base(u.Path); base != "." && base != "/" {
+					files = append(files, filepath.Join(dir, base))
+				}
+			}
+		}
+	}
+	return files
+}
+
+func overlap(a, b []string) []string {
+	var both []string
+	for _, f := range a {
+		if slices.Contains(b, f) {
+			both = append(both, f)
+		}
+	}
+	return both
+}
+
+// madeExecutable returns the files a chmod in e gives execute permission,
+// resolved against its working directory.
+func madeExecutable(e *models.AgentEvent) []string {
+	var files []string
+	for _, argv := range execCommands(e) {
+		if commandName(argv) != "chmod" {
+			continue
+		}
+		var mode string
+		for _, a := range argv[1:] {
+			switch {
+			case mode == "" && (strings.HasPrefix(a, "--") || a == "-R" || a == "-v" || a == "-c" || a == "-f"):
+			case mode == "":
+				mode = a
+			case modeAddsExec(mode):
+				files = append(files, resolvePath(e.CWD, a))
+			}
+		}
+	}
+	return files
+}
+
+// modeAddsExec reports whether a chmod mode, octal or symbolic, grants
+// execute permission.
+func modeAddsExec(mode string) bool {
+	if mode != "" && strings.Trim(mode, "01234567") == "" {
+		for _, d := range mode[max(0, len(mode)-3):] {
+			if (d-'0')&1 == 1 {
+				return true
+			}
+		}
+		return false
+	}
+	for _, clause := range strings.Split(mode, ",") {
+		if i := strings.IndexAny(clause, "+="); i >= 0 && strings.Contains(clause[i:], "x") {
+			return true
+		}
+	}
+	return false
+}
+
+func resolvePath(cwd, p string) string {
+	if !filepath.IsAbs(p) && cwd != "" {
+		p = filepath.Join(cwd, p)
+	}
+	return filepath.Clean(p)
+}
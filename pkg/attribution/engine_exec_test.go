@@ -0,0 +1,173 @@
+package attribution
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
+)
+
+func TestRegisterRoot_AttributesGenericRuntime(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	e.Process(models.RawEvent{Timestamp: base, PID: 10, PPID: 1, ProcessName: "kai", ActionType: models.ActionExec, StartTime: base})
+	e.RegisterRoot(10, models.AgentCodex)
+	e.Process(models.RawEvent{Timestamp: base, PID: 11, PPID: 10, ProcessName: "node", ActionType: models.ActionExec, Target: "node agent.js", StartTime: base})
+	ev := e.Process(models.RawEvent{Timestamp: base.Add(time.Second), PID: 12, PPID: 11, ProcessName: "git", ActionType: models.ActionExec, Target: "git status", StartTime: base})
+	if ev == nil || ev.Agent != models.AgentCodex {
+		t.Fatalf("expected exec under the registered root to be codex's, got %+v", ev)
+	}
+
+	// A process named after a different agent still belongs to the root.
+	ev = e.Process(models.RawEvent{Timestamp: base.Add(2 * time.Second), PID: 13, PPID: 11, ProcessName: "claude", ActionType: models.ActionExec, Target: "claude -p hi", StartTime: base})
+	if ev == nil || ev.Agent != models.AgentCodex {
+		t.Fatalf("expected pinned root to win over process name, got %+v", ev)
+	}
+
+	sessions := e.FinishRoot(10)
+	if len(sessions) != 1 || sessions[0] != ev.SessionID {
+		t.Fatalf("expected root to report its session, got %v", sessions)
+	}
+	if again := e.FinishRoot(10); len(again) != 0 {
+		t.Fatalf("expected root to be finished once, got %v", again)
+	}
+
+	e.Process(models.RawEvent{Timestamp: base.Add(3 * time.Second), PID: 10, ActionType: models.ActionProcExit, StartTime: base})
+	if _, _, ok := e.tree.Pinned(12); ok {
+		t.Fatal("expected pin to be dropped when the root exits")
+	}
+}
+
+func TestProcess_RecordsShellCommandsOnce(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	e.Process(models.RawEvent{Timestamp: base, PID: 20, PPID: 1, ProcessName: "codex", ActionType: models.ActionExec, StartTime: base})
+	e.Process(models.RawEvent{Timestamp: base, PID: 21, PPID: 20, ProcessName: "bash", ActionType: models.ActionExec, Target: "bash", StartTime: base})
+	seen := e.Process(models.RawEvent{Timestamp: base.Add(time.Second), PID: 22, PPID: 21, ProcessName: "make", ActionType: models.ActionExec, Target: "make test", StartTime: base})
+	if seen == nil {
+		t.Fatal("expected collector exec to be attributed")
+	}
+
+	if ev := e.Process(models.RawEvent{Timestamp: base.Add(900 * time.Millisecond), PID: 21, Target: "make test", Reported: &models.ShellReport{Exit: models.ExecExit{Duration: 2 * time.Second}}}); ev != nil {
+		t.Fatalf("expected command the collector saw to be skipped, got %+v", ev)
+	}
+	// The collector quotes argv for display; the hook sends the line as typed.
+	e.Process(models.RawEvent{Timestamp: base.Add(2 * time.Second), PID: 23, PPID: 21, ProcessName: "grep", ActionType: models.ActionExec, Target: "grep -r 'a b' .", ExecArgs: []string{"grep", "-r", "a b", "."}, StartTime: base})
+	if ev := e.Process(models.RawEvent{Timestamp: base.Add(2 * time.Second), PID: 21, Target: `grep -r "a b" . | head -n 3`, Reported: &models.ShellReport{Exit: models.ExecExit{Duration: time.Second}}}); ev != nil {
+		t.Fatalf("expected a pipeline the collector saw part of to be skipped, got %+v", ev)
+	}
+	// The hook's own report runs after every command.
+	if ev := e.Process(models.RawEvent{Timestamp: base.Add(3 * time.Second), PID: 24, PPID: 21, ProcessName: "kai", ActionType: models.ActionExec, Target: "/usr/local/bin/kai shell-ingest --shell bash -- 'make test'", ExecArgs: []string{"/usr/local/bin/kai", "shell-ingest", "--shell", "bash", "--", "make test"}, StartTime: base}); ev != nil {
+		t.Fatalf("expected kai shell-ingest not to be recorded, got %+v", ev)
+	}
+	ev := e.Process(models.RawEvent{Timestamp: base.Add(5 * time.Second), PID: 21, Target: "cd src && ls", Reported: &models.ShellReport{Exit: models.ExecExit{Code: 2, Duration: 40 * time.Millisecond}}})
+	if ev == nil || ev.Agent != models.AgentCodex || ev.ActionType != models.ActionExec {
+		t.Fatalf("expected hook command to be codex's exec, got %+v", ev)
+	}
+	// A marker attributes a shell kai knows nothing about.
+	marked := e.Process(models.RawEvent{Timestamp: base.Add(6 * time.Second), PID: 99, Target: "git status", Reported: &models.ShellReport{Agent: models.AgentClaude, Marker: "CLAUDECODE"}})
+	if marked == nil || marked.Agent != models.AgentClaude {
+		t.Fatalf("expected marker to attribute the command, got %+v", marked)
+	}
+
+	r, err := db.GetReplay(ev.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *models.ExecEvent
+	for i := range r.Execs {
+		if r.Execs[i].ID == ev.ID {
+			got = &r.Execs[i]
+		}
+	}
+	if got == nil || got.Exit == nil || got.Exit.Code != 2 || got.Exit.Duration != 40*time.Millisecond {
+		t.Fatalf("expected hook command stored with its exit, got %+v", got)
+	}
+}
+
+func TestProcess_AttributesByEnvironmentMarker(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	e.environ = func(pid int) []string {
+		if pid != 30 {
+			return []string{"PATH=/usr/bin"}
+		}
+		return []string{"PATH=/usr/bin", "CLAUDECODE=1", "GITHUB_TOKEN=ghp_secret"}
+	}
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Re-parented to init, so the tree alone cannot tell. The daemon may
+	// run as root, so the process's user does not matter.
+	ev := e.Process(models.RawEvent{Timestamp: base, PID: 30, PPID: 1, ProcessName: "make", ActionType: models.ActionExec, Target: "make build", UID: 1001, StartTime: base})
+	if ev == nil || ev.Agent != models.AgentClaude {
+		t.Fatalf("expected marker to attribute the exec, got %+v", ev)
+	}
+	if node := e.tree.currentLocked(30); node == nil || node.marker != "CLAUDECODE" {
+		t.Fatalf("expected only the marker's name to be kept, got %+v", node)
+	}
+	if ev := e.Process(models.RawEvent{Timestamp: base, PID: 31, PPID: 1, ProcessName: "make", ActionType: models.ActionExec, Target: "make build", UID: -1, StartTime: base}); ev != nil {
+		t.Fatalf("expected a process without markers to stay unattributed, got %+v", ev)
+	}
+}
+
+func TestProcess_RecordsHowEventsWereAttributed(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	own := e.Process(models.RawEvent{Timestamp: base, PID: 40, PPID: 1, ProcessName: "codex", ActionType: models.ActionExec, Target: "codex", CWD: "/work", StartTime: base})
+	child := e.Process(models.RawEvent{Timestamp: base.Add(time.Second), PID: 41, PPID: 40, ProcessName: "git", ActionType: models.ActionExec, Target: "git status", StartTime: base})
+	hooked := e.Process(models.RawEvent{Timestamp: base.Add(2 * time.Second), PID: 99, Target: "ls", Reported: &models.ShellReport{Agent: models.AgentCodex, Marker: "CODEX_SANDBOX"}})
+	conn := e.Process(models.RawEvent{Timestamp: base.Add(3 * time.Second), PID: 77, ProcessName: "curl", ActionType: models.ActionNetConnect, Target: "api.openai.com:443"})
+	owned := e.Process(models.RawEvent{Timestamp: base.Add(4 * time.Second), ActionType: models.ActionFileWrite, Target: "/work/a.go"})
+
+	for _, c := range []struct {
+		name string
+		ev   *models.AgentEvent
+		want models.Attribution
+	}{
+		{"own process", own, models.Attribution{Method: models.AttrProcess, Confidence: confProcess, Detail: "codex"}},
+		{"descendant", child, models.Attribution{Method: models.AttrAncestor, Confidence: confAncestor, Detail: "codex(40)"}},
+		{"shell hook", hooked, models.Attribution{Method: models.AttrHook, Confidence: confHook, Detail: "CODEX_SANDBOX"}},
+		{"endpoint", conn, models.Attribution{Method: models.AttrDomain, Confidence: confDomain, Detail: "api.openai.com"}},
+		{"workspace", owned, models.Attribution{Method: models.AttrWorkspace, Confidence: confWorkspace, Detail: "/work"}},
+	} {
+		if c.ev == nil || c.ev.Attribution != c.want {
+			t.Fatalf("%s: expected %v, got %+v", c.name, c.want, c.ev)
+		}
+	}
+
+	r, err := db.GetReplay(child.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := false
+	for _, x := range r.Execs {
+		stored = stored || x.ID == child.ID && x.Attribution == child.Attribution
+	}
+	if !stored {
+		t.Fatalf("expected attribution to be stored, got %+v", r.Execs)
+	}
+}
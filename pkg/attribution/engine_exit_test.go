@@ -0,0 +1,43 @@
+package attribution
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
+)
+
+func TestProcess_JoinsExitToExec(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	start := base.Add(-time.Second)
+	e.Process(models.RawEvent{Timestamp: base, PID: 10, ProcessName: "claude", ActionType: models.ActionProcSpawn, StartTime: base.Add(-time.Minute)})
+	ev := e.Process(models.RawEvent{Timestamp: base, PID: 11, PPID: 10, ProcessName: "go", ActionType: models.ActionExec, Target: "go test ./...", StartTime: start})
+	if ev == nil {
+		t.Fatal("expected exec to be attributed")
+	}
+	// An exit for an earlier process that had the same PID is ignored.
+	e.Process(models.RawEvent{Timestamp: base.Add(time.Second), PID: 11, ActionType: models.ActionProcExit, ExitCode: 0, StartTime: start.Add(-time.Hour)})
+	if got := e.Process(models.RawEvent{Timestamp: base.Add(12 * time.Second), PID: 11, ActionType: models.ActionProcExit, ExitCode: 1, StartTime: start}); got != nil {
+		t.Fatalf("expected exit to be folded into the exec, got %+v", got)
+	}
+
+	r, err := db.GetReplay(ev.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Execs) != 1 || r.Execs[0].Exit == nil {
+		t.Fatalf("expected exec with exit, got %+v", r.Execs)
+	}
+	if x := *r.Execs[0].Exit; x.Code != 1 || x.Signal != 0 || x.Duration != 12*time.Second {
+		t.Fatalf("unexpected exit: %+v", x)
+	}
+}
@@ -17,7 +17,7 @@ func TestClassify_NetEventDoesNotUseStalePIDAgent(t *testing.T) {
 	defer db.Close()
 
 	e := NewEngine(db)
-	e.pidAgent[12345] = models.AgentOllama
+	e.tree.Observe(models.RawEvent{Timestamp: time.Now(), PID: 12345, ProcessName: "ollama", ActionType: models.ActionExec})
 
 	raw := models.RawEvent{
 		Timestamp:   time.Now(),
@@ -27,7 +27,7 @@ func TestClassify_NetEventDoesNotUseStalePIDAgent(t *testing.T) {
 		Target:      "18.97.36.79:443",
 		Platform:    "macos",
 	}
-	got := e.classify(raw, raw.Timestamp)
+	got, _ := e.classify(raw, raw.Timestamp)
 	if got == models.AgentOllama {
 		t.Fatalf("expected net classification not to use stale pid-agent mapping, got %s", got)
 	}
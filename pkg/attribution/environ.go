@@ -0,0 +1,27 @@
+package attribution
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxEnviron bounds how much of a process environment is read.
+const maxEnviron = 256 << 10
+
+// readEnviron returns pid's environment from procfs, or nil where there is
+// none. The caller must not keep it.
+func readEnviron(pid int) []string {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxEnviron))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+}
@@ -1,7 +1,9 @@
 package attribution
 
 import (
+	"maps"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -10,6 +12,10 @@ import (
 	"github.com/kai-ai/kai/pkg/storage"
 )
 
+// dnsAnswerMinTTL keeps forwarded answers around longer than their DNS TTL;
+// clients cache addresses past it and the name is still the right one.
+const dnsAnswerMinTTL = 10 * time.Minute
+
 type cacheEntry struct {
 	domain string
 	expiry time.Time
@@ -17,17 +23,40 @@ type cacheEntry struct {
 
 type DNSCache struct {
 	mu    sync.RWMutex
-	mem   map[string]cacheEntry // keys: ip OR ip:port
+	mem   map[string]cacheEntry // keys: ip, ip:port OR pid/ip
 	store *storage.DB
+	// offline disables reverse lookups, for replaying recorded events.
+	// Entries then expire on the time of the latest event, not the clock.
+	offline   bool
+	eventTime time.Time
 }
 
 func NewDNSCache(store *storage.DB) *DNSCache {
 	return &DNSCache{mem: map[string]cacheEntry{}, store: store}
 }
 
+// advance moves an offline cache's clock to the time of an event.
+func (c *DNSCache) advance(at time.Time) {
+	c.mu.Lock()
+	if at.After(c.eventTime) {
+		c.eventTime = at
+	}
+	c.mu.Unlock()
+}
+
+func (c *DNSCache) now() time.Time {
+	if !c.offline {
+		return time.Now()
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.eventTime
+}
+
 func (c *DNSCache) Set(ip, domain string, ttl time.Duration) {
+	expiry := c.now().Add(ttl)
 	c.mu.Lock()
-	c.mem[ip] = cacheEntry{domain: domain, expiry: time.Now().Add(ttl)}
+	c.mem[ip] = cacheEntry{domain: domain, expiry: expiry}
 	c.mu.Unlock()
 	if c.store != nil {
 		_ = c.store.SetDNSEntry(ip, domain, ttl)
@@ -39,16 +68,39 @@ func (c *DNSCache) SetEndpoint(ip string, port int, domain string, ttl time.Dura
 		return
 	}
 	key := endpointKey(ip, port)
+	expiry := c.now().Add(ttl)
+	c.mu.Lock()
+	c.mem[key] = cacheEntry{domain: domain, expiry: expiry}
+	c.mu.Unlock()
+}
+
+// RecordAnswer stores a name the DNS forwarder resolved for a process. The
+// answer also wins for that process alone, so two processes that resolved
+// different names to one shared CDN address each keep their own name.
+func (c *DNSCache) RecordAnswer(ip, domain string, ttl time.Duration, pid int, processName string, at time.Time) {
+	if ip == "" || domain == "" {
+		return
+	}
+	if ttl < dnsAnswerMinTTL {
+		ttl = dnsAnswerMinTTL
+	}
+	expiry := at.Add(ttl)
 	c.mu.Lock()
-	c.mem[key] = cacheEntry{domain: domain, expiry: time.Now().Add(ttl)}
+	c.mem[ip] = cacheEntry{domain: domain, expiry: expiry}
+	if pid > 0 {
+		c.mem[pidKey(pid, ip)] = cacheEntry{domain: domain, expiry: expiry}
+	}
 	c.mu.Unlock()
+	if c.store != nil {
+		_ = c.store.RecordDNSAnswer(ip, domain, ttl, pid, processName, at)
+	}
 }
 
 func (c *DNSCache) Get(ip string) (string, bool) {
 	c.mu.RLock()
 	v, ok := c.mem[ip]
 	c.mu.RUnlock()
-	if ok && time.Now().Before(v.expiry) {
+	if ok && c.now().Before(v.expiry) {
 		return v.domain, true
 	}
 	if c.store != nil {
@@ -61,8 +113,7 @@ func (c *DNSCache) Get(ip string) (string, bool) {
 }
 
 func PreResolveKnownDomains(cache *DNSCache) {
-	for domain := range KnownAIDomains {
-		d := domain
+	for _, d := range slices.Concat(slices.Collect(maps.Keys(KnownAIDomains)), extraAIDomains) {
 		go func() {
 			host, port := splitDomainPort(d)
 			ips, err := net.LookupHost(host)
@@ -83,6 +134,20 @@ func PreResolveKnownDomains(cache *DNSCache) {
 }
 
 func (c *DNSCache) ResolveIP(ip string, port int) (*string, bool) {
+	return c.ResolveIPFor(0, ip, port)
+}
+
+// ResolveIPFor is ResolveIP preferring the name pid itself looked up.
+func (c *DNSCache) ResolveIPFor(pid int, ip string, port int) (*string, bool) {
+	if pid > 0 {
+		c.mu.RLock()
+		v, ok := c.mem[pidKey(pid, ip)]
+		c.mu.RUnlock()
+		if ok && c.now().Before(v.expiry) {
+			d := v.domain
+			return &d, isKnownAIDomain(d)
+		}
+	}
 	if port > 0 {
 		if d, ok := c.getEndpoint(ip, port); ok {
 			isAI := isKnownAIDomain(d)
@@ -93,6 +158,9 @@ func (c *DNSCache) ResolveIP(ip string, port int) (*string, bool) {
 		isAI := isKnownAIDomain(d)
 		return &d, isAI
 	}
+	if c.offline {
+		return nil, false
+	}
 	go func() {
 		names, err := net.LookupAddr(ip)
 		if err == nil && len(names) > 0 {
@@ -108,12 +176,16 @@ func (c *DNSCache) getEndpoint(ip string, port int) (string, bool) {
 	c.mu.RLock()
 	v, ok := c.mem[key]
 	c.mu.RUnlock()
-	if ok && time.Now().Before(v.expiry) {
+	if ok && c.now().Before(v.expiry) {
 		return v.domain, true
 	}
 	return "", false
 }
 
+func pidKey(pid int, ip string) string {
+	return strconv.Itoa(pid) + "/" + ip
+}
+
 func endpointKey(ip string, port int) string {
 	return ip + ":" + strconv.Itoa(port)
 }
@@ -137,6 +209,14 @@ func splitDomainPort(v string) (string, int) {
 }
 
 func isKnownAIDomain(d string) bool {
-	_, ok := AgentForDomain(d)
-	return ok
+	if _, ok := AgentForDomain(d); ok {
+		return true
+	}
+	d = normalizeDomain(d)
+	for _, extra := range extraAIDomains {
+		if d == extra || strings.HasSuffix(d, "."+extra) {
+			return true
+		}
+	}
+	return false
 }
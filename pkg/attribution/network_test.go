@@ -45,3 +45,17 @@ func TestPreResolveKnownDomains_LocalhostPortScoped(t *testing.T) {
 		t.Fatalf("expected no IP-wide localhost attribution, got %q", d)
 	}
 }
+
+func TestDNSCache_RecordAnswerPrefersAskingProcess(t *testing.T) {
+	c := NewDNSCache(nil)
+	now := time.Now()
+	c.RecordAnswer("160.79.104.10", "api.anthropic.com", 30*time.Second, 100, "claude", now)
+	c.RecordAnswer("160.79.104.10", "static.example.com", 30*time.Second, 200, "curl", now)
+
+	if d, isAI := c.ResolveIPFor(100, "160.79.104.10", 443); d == nil || *d != "api.anthropic.com" || !isAI {
+		t.Fatalf("expected asker's own answer, got %v ai=%v", d, isAI)
+	}
+	if d, _ := c.ResolveIPFor(300, "160.79.104.10", 443); d == nil || *d != "static.example.com" {
+		t.Fatalf("expected latest answer for other processes, got %v", d)
+	}
+}
@@ -0,0 +1,374 @@
+package attribution
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+const (
+	// ProcExitGrace keeps exited processes around so late events from them
+	// and their orphans still resolve.
+	ProcExitGrace = time.Minute
+	// ProcLivenessAfter is how long a process may go unobserved before the
+	// tree checks whether it is still running.
+	ProcLivenessAfter = 30 * time.Second
+	procMaxDepth      = 64
+)
+
+// procKey identifies one process incarnation; start is zero when the
+// collector could not report a start time.
+type procKey struct {
+	pid   int
+	start int64
+}
+
+type procNode struct {
+	key      procKey
+	parent   procKey
+	name     string
+	argv     []string
+	exe      string
+	agent    models.AgentID
+	lastSeen time.Time
+	exitedAt time.Time
+	// envAgent comes from a marker in the environment of the current
+	// image; marker is its scrubbed name.
+	envAgent models.AgentID
+	marker   string
+}
+
+// ProcessTree tracks parent links between observed processes so events from
+// descendants of an agent process are attributed to that agent.
+type ProcessTree struct {
+	mu    sync.Mutex
+	nodes map[procKey]*procNode
+	byPID map[int]procKey
+	// pins are processes registered as agent roots by kai exec. They are
+	// keyed by PID alone because the registration may arrive before the
+	// collector has reported the process.
+	pins  map[int]models.AgentID
+	alive func(pid int) bool
+}
+
+func NewProcessTree() *ProcessTree {
+	return &ProcessTree{nodes: map[procKey]*procNode{}, byPID: map[int]procKey{}, pins: map[int]models.AgentID{}, alive: pidAlive}
+}
+
+// Pin attributes pid and its descendants to agent until Unpin, regardless
+// of what their process names suggest.
+func (t *ProcessTree) Pin(pid int, agent models.AgentID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pins[pid] = agent
+}
+
+// Unpin removes a pin and reports whether there was one.
+func (t *ProcessTree) Unpin(pid int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.pins[pid]
+	delete(t.pins, pid)
+	return ok
+}
+
+// Pinned returns the nearest pinned process at or above pid.
+func (t *ProcessTree) Pinned(pid int) (int, models.AgentID, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pins) == 0 {
+		return 0, "", false
+	}
+	if agent, ok := t.pins[pid]; ok {
+		return pid, agent, true
+	}
+	node := t.currentLocked(pid)
+	seen := map[procKey]struct{}{}
+	for depth := 0; node != nil && depth < procMaxDepth; depth++ {
+		if _, loop := seen[node.key]; loop {
+			break
+		}
+		seen[node.key] = struct{}{}
+		if agent, ok := t.pins[node.parent.pid]; ok && node.parent.pid > 0 {
+			return node.parent.pid, agent, true
+		}
+		node = t.parentLocked(node)
+	}
+	return 0, "", false
+}
+
+// Observe records the process behind raw. A PROC_SPAWN, or a start time that
+// differs from the tracked one, starts a new incarnation of the PID.
+func (t *ProcessTree) Observe(raw models.RawEvent) {
+	if raw.PID <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := procKey{pid: raw.PID}
+	if !raw.StartTime.IsZero() {
+		key.start = raw.StartTime.UnixNano()
+	}
+	node := t.currentLocked(raw.PID)
+	if node != nil && (raw.ActionType == models.ActionProcSpawn || (key.start != 0 && node.key.start != 0 && node.key.start != key.start)) {
+		node.exitedAt = raw.Timestamp
+		node = nil
+	}
+	if node == nil {
+		node = &procNode{key: key}
+		t.nodes[key] = node
+		t.byPID[raw.PID] = key
+	} else if node.key.start == 0 && key.start != 0 {
+		delete(t.nodes, node.key)
+		node.key = key
+		t.nodes[key] = node
+		t.byPID[raw.PID] = key
+	}
+	if raw.ActionType == models.ActionExec {
+		node.envAgent, node.marker = "", ""
+	}
+	if raw.PPID > 0 {
+		if parent := t.currentLocked(raw.PPID); parent != nil {
+			node.parent = parent.key
+		} else {
+			node.parent = procKey{pid: raw.PPID}
+		}
+	}
+	if raw.ProcessName != "" || len(raw.ExecArgs) > 0 || raw.Exe != "" {
+		if raw.ProcessName != "" {
+			node.name = raw.ProcessName
+		}
+		if len(raw.ExecArgs) > 0 {
+			node.argv = raw.ExecArgs
+		}
+		if raw.Exe != "" {
+			node.exe = raw.Exe
+		}
+		var ancestors []ProcessInfo
+		if NeedsAncestors() {
+			ancestors = t.ancestorsLocked(node)
+		}
+		node.agent, _ = AgentForCommand(ProcessInfo{Name: node.name, Argv: node.argv, Exe: node.exe}, ancestors)
+	}
+	node.lastSeen = raw.Timestamp
+	node.exitedAt = time.Time{}
+}
+
+// Mark attributes pid's current image to agent because of an environment
+// marker. Observing a new exec clears it.
+func (t *ProcessTree) Mark(pid int, agent models.AgentID, marker string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if node := t.currentLocked(pid); node != nil {
+		node.envAgent, node.marker = agent, marker
+	}
+}
+
+// Exit marks pid's current incarnation as exited at the given time.
+func (t *ProcessTree) Exit(pid int, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if node := t.currentLocked(pid); node != nil && node.exitedAt.IsZero() {
+		node.exitedAt = at
+	}
+}
+
+// AgentFor walks from pid towards the root and returns the nearest agent
+// along with the ancestry of pid, nearest parent first.
+func (t *ProcessTree) AgentFor(pid int) (models.AgentID, []models.ProcessRef, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.currentLocked(pid)
+	if node == nil {
+		return models.AgentUnknown, nil, false
+	}
+	agent, found := t.agentLocked(node)
+	var chain []models.ProcessRef
+	seen := map[procKey]struct{}{node.key: {}}
+	for depth := 0; depth < procMaxDepth; depth++ {
+		parent := t.parentLocked(node)
+		if parent == nil {
+			if node.parent.pid > 0 {
+				chain = append(chain, models.ProcessRef{PID: node.parent.pid})
+			}
+			break
+		}
+		if _, loop := seen[parent.key]; loop {
+			break
+		}
+		seen[parent.key] = struct{}{}
+		chain = append(chain, models.ProcessRef{PID: parent.key.pid, ProcessName: parent.name})
+		if !found {
+			agent, found = t.agentLocked(parent)
+		}
+		node = parent
+	}
+	if !found {
+		return models.AgentUnknown, chain, false
+	}
+	return agent, chain, true
+}
+
+// Started reports whether the tracked incarnation of pid is the one that
+// started at start. It is false when either start time is unknown.
+func (t *ProcessTree) Started(pid int, start time.Time) bool {
+	if start.IsZero() {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.currentLocked(pid)
+	return node != nil && node.key.start != 0 && node.key.start == start.UnixNano()
+}
+
+// Attribute is AgentFor explaining its answer: the nearest process that
+// is pinned, carries an agent marker or matches a signature decides.
+func (t *ProcessTree) Attribute(pid int) (models.AgentID, models.Attribution, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.currentLocked(pid)
+	seen := map[procKey]struct{}{}
+	for depth := 0; node != nil && depth < procMaxDepth; depth++ {
+		if _, loop := seen[node.key]; loop {
+			break
+		}
+		seen[node.key] = struct{}{}
+		own := node.key.pid == pid
+		switch {
+		case t.pins[node.key.pid] != "":
+			return t.pins[node.key.pid], models.Attribution{Method: models.AttrPinned, Confidence: confPinned, Detail: "kai exec " + strconv.Itoa(node.key.pid)}, true
+		case node.envAgent != "" && own:
+			return node.envAgent, models.Attribution{Method: models.AttrEnv, Confidence: confEnv, Detail: node.marker}, true
+		case node.envAgent != "":
+			return node.envAgent, models.Attribution{Method: models.AttrEnv, Confidence: confInheritedEnv, Detail: node.marker}, true
+		case node.agent != "" && node.agent != models.AgentUnknown && own:
+			return node.agent, models.Attribution{Method: models.AttrProcess, Confidence: confProcess, Detail: node.name}, true
+		case node.agent != "" && node.agent != models.AgentUnknown:
+			return node.agent, models.Attribution{Method: models.AttrAncestor, Confidence: confAncestor, Detail: node.name + "(" + strconv.Itoa(node.key.pid) + ")"}, true
+		}
+		node = t.parentLocked(node)
+	}
+	return models.AgentUnknown, models.Attribution{}, false
+}
+
+// Root returns the outermost process at or above pid that is attributed
+// to agent: the agent itself rather than the tools it ran.
+func (t *ProcessTree) Root(pid int, agent models.AgentID) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.currentLocked(pid)
+	root := 0
+	seen := map[procKey]struct{}{}
+	for depth := 0; node != nil && depth < procMaxDepth; depth++ {
+		if _, loop := seen[node.key]; loop {
+			break
+		}
+		seen[node.key] = struct{}{}
+		if id, ok := t.agentLocked(node); ok && id == agent {
+			root = node.key.pid
+		}
+		node = t.parentLocked(node)
+	}
+	return root, root > 0
+}
+
+// Prune drops exited processes once their grace period has passed and no
+// tracked process still names them as parent. Processes that have not been
+// observed recently are checked for liveness first.
+func (t *ProcessTree) Prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, node := range t.nodes {
+		if node.exitedAt.IsZero() && now.Sub(node.lastSeen) > ProcLivenessAfter && t.byPID[node.key.pid] == node.key && !t.alive(node.key.pid) {
+			node.exitedAt = now
+		}
+	}
+	referenced := map[procKey]struct{}{}
+	for _, node := range t.nodes {
+		if parent := t.parentLocked(node); parent != nil {
+			referenced[parent.key] = struct{}{}
+		}
+	}
+	for key, node := range t.nodes {
+		if node.exitedAt.IsZero() || now.Sub(node.exitedAt) < ProcExitGrace {
+			continue
+		}
+		if _, ok := referenced[key]; ok {
+			continue
+		}
+		delete(t.nodes, key)
+		if t.byPID[key.pid] == key {
+			delete(t.byPID, key.pid)
+		}
+	}
+}
+
+func (t *ProcessTree) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.nodes)
+}
+
+func (t *ProcessTree) agentLocked(node *procNode) (models.AgentID, bool) {
+	if agent, ok := t.pins[node.key.pid]; ok {
+		return agent, true
+	}
+	if node.envAgent != "" {
+		return node.envAgent, true
+	}
+	return node.agent, node.agent != "" && node.agent != models.AgentUnknown
+}
+
+// ancestorsLocked lists node's known ancestors, nearest first.
+func (t *ProcessTree) ancestorsLocked(node *procNode) []ProcessInfo {
+	var res []ProcessInfo
+	seen := map[procKey]struct{}{node.key: {}}
+	for depth := 0; depth < procMaxDepth; depth++ {
+		parent := t.parentLocked(node)
+		if parent == nil {
+			break
+		}
+		if _, loop := seen[parent.key]; loop {
+			break
+		}
+		seen[parent.key] = struct{}{}
+		res = append(res, ProcessInfo{Name: parent.name, Argv: parent.argv, Exe: parent.exe})
+		node = parent
+	}
+	return res
+}
+
+func (t *ProcessTree) currentLocked(pid int) *procNode {
+	key, ok := t.byPID[pid]
+	if !ok {
+		return nil
+	}
+	return t.nodes[key]
+}
+
+// parentLocked resolves node's parent. A parent recorded before its start
+// time was known matches whichever incarnation of that PID is current.
+func (t *ProcessTree) parentLocked(node *procNode) *procNode {
+	if parent, ok := t.nodes[node.parent]; ok {
+		return parent
+	}
+	if node.parent.pid > 0 && node.parent.start == 0 {
+		return t.currentLocked(node.parent.pid)
+	}
+	return nil
+}
+
+func pidAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
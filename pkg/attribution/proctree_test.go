@@ -0,0 +1,79 @@
+package attribution
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func TestProcessTree_GrandchildResolvesToAgent(t *testing.T) {
+	tree := NewProcessTree()
+	now := time.Now()
+	tree.Observe(models.RawEvent{Timestamp: now, PID: 100, PPID: 1, ProcessName: "cursor", ActionType: models.ActionProcSpawn})
+	tree.Observe(models.RawEvent{Timestamp: now, PID: 200, PPID: 100, ProcessName: "sh", ActionType: models.ActionProcSpawn})
+	tree.Observe(models.RawEvent{Timestamp: now, PID: 300, PPID: 200, ProcessName: "npm", ActionType: models.ActionExec})
+
+	agent, chain, ok := tree.AgentFor(300)
+	if !ok || agent != models.AgentCursor {
+		t.Fatalf("expected cursor attribution, got %s ok=%v", agent, ok)
+	}
+	if len(chain) != 3 || chain[0].PID != 200 || chain[1].PID != 100 || chain[1].ProcessName != "cursor" || chain[2].PID != 1 {
+		t.Fatalf("unexpected ancestry: %+v", chain)
+	}
+}
+
+func TestProcessTree_PIDReuseStartsNewIncarnation(t *testing.T) {
+	tree := NewProcessTree()
+	t0 := time.Now()
+	tree.Observe(models.RawEvent{Timestamp: t0, PID: 100, PPID: 1, ProcessName: "codex", ActionType: models.ActionExec, StartTime: t0})
+	tree.Observe(models.RawEvent{Timestamp: t0, PID: 200, PPID: 100, ProcessName: "bash", ActionType: models.ActionExec, StartTime: t0})
+
+	// PID 200 is reused by an unrelated process with a later start time.
+	t1 := t0.Add(time.Hour)
+	tree.Observe(models.RawEvent{Timestamp: t1, PID: 200, PPID: 50, ProcessName: "vim", ActionType: models.ActionExec, StartTime: t1})
+	if agent, _, ok := tree.AgentFor(200); ok {
+		t.Fatalf("expected reused pid not to inherit %s", agent)
+	}
+}
+
+func TestProcessTree_PruneExited(t *testing.T) {
+	tree := NewProcessTree()
+	alive := map[int]bool{100: true}
+	tree.alive = func(pid int) bool { return alive[pid] }
+	t0 := time.Now()
+	tree.Observe(models.RawEvent{Timestamp: t0, PID: 100, PPID: 1, ProcessName: "claude", ActionType: models.ActionExec})
+	tree.Observe(models.RawEvent{Timestamp: t0, PID: 200, PPID: 100, ProcessName: "git", ActionType: models.ActionExec})
+	tree.Observe(models.RawEvent{Timestamp: t0, PID: 300, PPID: 100, ProcessName: "make", ActionType: models.ActionExec})
+	tree.Exit(200, t0)
+
+	// Within the grace period exited processes still resolve.
+	tree.Prune(t0.Add(ProcExitGrace / 2))
+	if _, _, ok := tree.AgentFor(200); !ok {
+		t.Fatal("expected exited process to resolve during grace period")
+	}
+
+	// 300 was never reported as exited; the liveness check catches it.
+	tree.Prune(t0.Add(ProcLivenessAfter + time.Second))
+	tree.Prune(t0.Add(ProcLivenessAfter + ProcExitGrace + 2*time.Second))
+	if _, _, ok := tree.AgentFor(200); ok {
+		t.Fatal("expected exited process to be pruned")
+	}
+	if _, _, ok := tree.AgentFor(300); ok {
+		t.Fatal("expected dead process to be pruned")
+	}
+	if got := tree.Len(); got != 1 {
+		t.Fatalf("expected only the live agent to remain, got %d nodes", got)
+	}
+}
+
+func TestProcessTree_MatchesCommandLine(t *testing.T) {
+	tree := NewProcessTree()
+	now := time.Now()
+	tree.Observe(models.RawEvent{Timestamp: now, PID: 100, PPID: 1, ProcessName: "node", ActionType: models.ActionExec, ExecArgs: []string{"node", "/usr/lib/node_modules/@anthropic-ai/claude-code/cli.js"}})
+	tree.Observe(models.RawEvent{Timestamp: now, PID: 200, PPID: 100, ProcessName: "node", ActionType: models.ActionExec, ExecArgs: []string{"node", "build.js"}})
+
+	if agent, _, ok := tree.AgentFor(200); !ok || agent != models.AgentClaude {
+		t.Fatalf("expected node script under claude code to be claude's, got %s ok=%v", agent, ok)
+	}
+}
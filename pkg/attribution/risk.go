@@ -1,8 +1,12 @@
 package attribution
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -14,14 +18,157 @@ type RiskRule struct {
 	Match func(event *models.AgentEvent) bool
 	Score int
 	Label string
+	// Severity is low, medium, high or critical; empty derives it from
+	// Score.
+	Severity string
 }
 
-var riskRules = []RiskRule{
+// Severities, from least to most severe.
+var Severities = []string{"low", "medium", "high", "critical"}
+
+// Level returns the rule's severity.
+func (r RiskRule) Level() string {
+	switch {
+	case r.Severity != "":
+		return r.Severity
+	case r.Score >= 90:
+		return "critical"
+	case r.Score >= 70:
+		return "high"
+	case r.Score >= 40:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// RuleMatch is the declarative form of a rule's condition. Every non-empty
+// field must match, and a field matches when any of its entries does.
+// Argv is matched against each simple command an EXEC runs, its arguments
+// joined by spaces. Domains are lowercase names, or suffixes starting with
+// "*.".
+type RuleMatch struct {
+	Actions []models.ActionType
+	Paths   []*regexp.Regexp
+	Argv    []*regexp.Regexp
+	Agents  []models.AgentID
+	Domains []string
+}
+
+func (m RuleMatch) Empty() bool {
+	return len(m.Actions) == 0 && len(m.Paths) == 0 && len(m.Argv) == 0 && len(m.Agents) == 0 && len(m.Domains) == 0
+}
+
+func (m RuleMatch) Match(e *models.AgentEvent) bool {
+	if len(m.Actions) > 0 && !slices.Contains(m.Actions, e.ActionType) {
+		return false
+	}
+	if len(m.Agents) > 0 && !slices.Contains(m.Agents, e.Agent) {
+		return false
+	}
+	if len(m.Paths) > 0 {
+		if !isFileWrite(e) && e.ActionType != models.ActionFileRead {
+			return false
+		}
+		if !anyMatch(m.Paths, filepath.ToSlash(e.Target)) && (e.OldPath == "" || !anyMatch(m.Paths, filepath.ToSlash(e.OldPath))) {
+			return false
+		}
+	}
+	if len(m.Argv) > 0 && !anyCommand(e, func(argv []string) bool { return anyMatch(m.Argv, strings.Join(argv, " ")) }) {
+		return false
+	}
+	if len(m.Domains) > 0 {
+		if !isNetAction(e.ActionType) {
+			return false
+		}
+		host := strings.ToLower(e.Domain)
+		if host == "" {
+			host, _ = splitHostPort(e.Target)
+			if net.ParseIP(host) != nil {
+				return false
+			}
+		}
+		if !slices.ContainsFunc(m.Domains, func(d string) bool {
+			if suffix, ok := strings.CutPrefix(d, "*"); ok {
+				return strings.HasSuffix(host, suffix)
+			}
+			return host == d
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyMatch(res []*regexp.Regexp, s string) bool {
+	return slices.ContainsFunc(res, func(re *regexp.Regexp) bool { return re.MatchString(s) })
+}
+
+var (
+	rulesMu   sync.RWMutex
+	riskRules = builtinRiskRules
+)
+
+// LoadRiskRules puts custom rules in effect alongside the built-in ones,
+// replacing any earlier custom rules. A custom rule labeled like a built-in
+// one replaces it; without Match it keeps the built-in condition, and with
+// Score 0 it removes the rule. Two custom rules may not share a label.
+func LoadRiskRules(custom []RiskRule) error {
+	rules := slices.Clone(builtinRiskRules)
+	seen := map[string]bool{}
+	for _, c := range custom {
+		if seen[c.Label] {
+			return fmt.Errorf("rule %q is defined twice", c.Label)
+		}
+		seen[c.Label] = true
+		i := slices.IndexFunc(rules, func(r RiskRule) bool { return r.Label == c.Label })
+		switch {
+		case i >= 0 && c.Score == 0:
+			rules = slices.Delete(rules, i, i+1)
+		case i >= 0:
+			if c.Match == nil {
+				c.Match = rules[i].Match
+			}
+			rules[i] = c
+		case c.Match == nil:
+			return fmt.Errorf("rule %q has no conditions", c.Label)
+		default:
+			rules = append(rules, c)
+		}
+	}
+	rulesMu.Lock()
+	riskRules = rules
+	rulesMu.Unlock()
+	return nil
+}
+
+// MatchRiskRules returns the rules event matches.
+func MatchRiskRules(event *models.AgentEvent) []RiskRule {
+	rulesMu.RLock()
+	rules := riskRules
+	rulesMu.RUnlock()
+	var matched []RiskRule
+	for _, rule := range rules {
+		if rule.Match(event) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+var builtinRiskRules = []RiskRule{
 	{Score: 90, Label: "force push", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionExec && containsAll(e.Target, "git push", "--force")
+		return anyCommand(e, func(argv []string) bool {
+			sub, args := gitSubcommand(argv)
+			return sub == "push" && (hasFlag(args, []string{"--force", "--force-with-lease", "--force-if-includes"}, "f") ||
+				slices.ContainsFunc(args, func(a string) bool { return strings.HasPrefix(a, "+") }))
+		})
 	}},
 	{Score: 65, Label: "git push", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionExec && strings.Contains(strings.ToLower(e.Target), "git push")
+		return anyCommand(e, func(argv []string) bool {
+			sub, _ := gitSubcommand(argv)
+			return sub == "push"
+		})
 	}},
 	{Score: 60, Label: "CI pipeline modified", Match: func(e *models.AgentEvent) bool {
 		return isFileWrite(e) && strings.Contains(e.Target, ".github/workflows/")
@@ -49,7 +196,9 @@ var riskRules = []RiskRule{
 		return isFileWrite(e) && strings.Contains(strings.ToLower(e.Target), ".env")
 	}},
 	{Score: 70, Label: "recursive delete", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionExec && containsAll(strings.ToLower(e.Target), "rm", "-rf")
+		return anyCommand(e, func(argv []string) bool {
+			return commandName(argv) == "rm" && hasFlag(argv[1:], []string{"--recursive"}, "rR")
+		})
 	}},
 	{Score: 60, Label: "home dir deletion", Match: func(e *models.AgentEvent) bool {
 		if e.ActionType != models.ActionFileDelete {
@@ -63,17 +212,34 @@ var riskRules = []RiskRule{
 		cleanHome := filepath.Clean(home)
 		return cleanTarget == cleanHome || strings.HasPrefix(cleanTarget, cleanHome+string(filepath.Separator))
 	}},
-	{Score: 50, Label: "sudo escalation", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionExec && strings.HasPrefix(strings.TrimSpace(strings.ToLower(e.Target)), "sudo ")
+	{Score: 50, Label: "sudo escalation", Match: func(e *models.AgentEvent) bool { return runs(e, "sudo", "doas") }},
+	{Score: 35, Label: "permission change", Match: func(e *models.AgentEvent) bool { return runs(e, "chmod") }},
+	{Score: 30, Label: "curl/wget executed", Match: func(e *models.AgentEvent) bool { return runs(e, "curl", "wget") }},
+	{Score: 25, Label: "external network", Match: func(e *models.AgentEvent) bool {
+		return e.ActionType == models.ActionNetConnect && !strings.Contains(e.Target, "127.0.0.1") && !strings.Contains(e.Target, "localhost")
+	}},
+	{Score: 50, Label: "listening on all interfaces", Match: func(e *models.AgentEvent) bool {
+		if e.ActionType != models.ActionNetListen {
+			return false
+		}
+		host, _ := splitHostPort(e.Target)
+		return host == "0.0.0.0" || host == "::"
 	}},
-	{Score: 35, Label: "permission change", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionExec && strings.HasPrefix(strings.TrimSpace(strings.ToLower(e.Target)), "chmod ")
+	{Score: 85, Label: "browser credentials read", Match: func(e *models.AgentEvent) bool {
+		return sensitiveRead(e) == readBrowser
 	}},
-	{Score: 30, Label: "curl/wget executed", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionExec && (strings.HasPrefix(strings.TrimSpace(strings.ToLower(e.Target)), "curl ") || strings.HasPrefix(strings.TrimSpace(strings.ToLower(e.Target)), "wget "))
+	{Score: 80, Label: "SSH private key read", Match: func(e *models.AgentEvent) bool {
+		// ssh itself reading its key is how git push works.
+		return sensitiveRead(e) == readSSHKey && !sshTools[e.ProcessName]
 	}},
-	{Score: 25, Label: "external network", Match: func(e *models.AgentEvent) bool {
-		return e.ActionType == models.ActionNetConnect && !strings.Contains(e.Target, "127.0.0.1") && !strings.Contains(e.Target, "localhost")
+	{Score: 75, Label: "credentials file read", Match: func(e *models.AgentEvent) bool {
+		return sensitiveRead(e) == readCredentials
+	}},
+	{Score: 60, Label: "env file read", Match: func(e *models.AgentEvent) bool {
+		return sensitiveRead(e) == readEnv
+	}},
+	{Score: 40, Label: "sensitive file read", Match: func(e *models.AgentEvent) bool {
+		return sensitiveRead(e) == readOther
 	}},
 }
 
@@ -83,35 +249,63 @@ var (
 )
 
 func ScoreEvent(event *models.AgentEvent) (int, []string) {
-	total := 0
-	labels := []string{}
-	for _, rule := range riskRules {
-		if rule.Match(event) {
-			total += rule.Score
-			labels = append(labels, rule.Label)
-		}
-	}
+	total, labels := ScoreRules(MatchRiskRules(event))
 	if massFileOperation(event) {
-		total += 55
+		total = min(total+55, 100)
 		labels = append(labels, "mass file operation")
 	}
-	if total > 100 {
-		total = 100
-	}
 	return total, labels
 }
 
+// ScoreRules totals the scores of matched rules, capped at 100, and lists
+// their labels. Unlike ScoreEvent it keeps no state between events.
+func ScoreRules(matched []RiskRule) (int, []string) {
+	total := 0
+	labels := []string{}
+	for _, rule := range matched {
+		total += rule.Score
+		labels = append(labels, rule.Label)
+	}
+	return min(total, 100), labels
+}
+
 func isFileWrite(e *models.AgentEvent) bool {
-	return e.ActionType == models.ActionFileWrite || e.ActionType == models.ActionFileCreate || e.ActionType == models.ActionFileDelete
+	return e.ActionType == models.ActionFileWrite || e.ActionType == models.ActionFileCreate || e.ActionType == models.ActionFileDelete || e.ActionType == models.ActionFileRename
 }
 
-func containsAll(s string, needles ...string) bool {
-	for _, n := range needles {
-		if !strings.Contains(strings.ToLower(s), strings.ToLower(n)) {
-			return false
-		}
+type readKind int
+
+const (
+	readNone readKind = iota
+	readBrowser
+	readSSHKey
+	readCredentials
+	readEnv
+	readOther
+)
+
+var sshTools = map[string]bool{"ssh": true, "scp": true, "sftp": true, "ssh-add": true, "ssh-agent": true, "ssh-keygen": true}
+
+// sensitiveRead classifies a FILE_READ by what kind of secret the file holds.
+func sensitiveRead(e *models.AgentEvent) readKind {
+	if e.ActionType != models.ActionFileRead {
+		return readNone
+	}
+	path := filepath.ToSlash(e.Target)
+	base := filepath.Base(path)
+	switch {
+	case base == "Cookies" || base == "Login Data" || base == "cookies.sqlite" || base == "logins.json" || base == "key4.db":
+		return readBrowser
+	case strings.Contains(path, "/.ssh/") && strings.HasPrefix(base, "id_") && !strings.HasSuffix(base, ".pub"):
+		return readSSHKey
+	case containsAny(path, "/.aws/", "/.config/gcloud/", "/.azure/", "/.kube/config", "/.docker/config.json", "/.config/gh/", "/.gnupg/") ||
+		base == ".netrc" || base == ".git-credentials" || base == ".npmrc" || base == ".pypirc":
+		return readCredentials
+	case base == ".env" || strings.HasPrefix(base, ".env."):
+		return readEnv
+	default:
+		return readOther
 	}
-	return true
 }
 
 func containsAny(s string, needles ...string) bool {
@@ -133,7 +327,7 @@ func hasExt(s string, exts ...string) bool {
 }
 
 func massFileOperation(e *models.AgentEvent) bool {
-	if !(e.ActionType == models.ActionFileWrite || e.ActionType == models.ActionFileCreate || e.ActionType == models.ActionFileDelete) {
+	if !isFileWrite(e) {
 		return false
 	}
 	riskMu.Lock()
@@ -1,6 +1,7 @@
 package attribution
 
 import (
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -17,40 +18,140 @@ const (
 	SessionMaxDuration = 4 * time.Hour
 )
 
+const (
+	// maxWorkspaceCache bounds the directory to repository lookups kept.
+	maxWorkspaceCache = 4096
+	// maxSessionCWDs bounds the working directories kept per session.
+	maxSessionCWDs = 32
+)
+
+// sessionKey separates concurrent sessions of one agent. Sessions are keyed
+// by the repository they work in, or, until one is known, by the agent's
+// root process.
+type sessionKey struct {
+	agent     models.AgentID
+	workspace string
+	root      int
+}
+
 type SessionManager struct {
 	mu     sync.Mutex
-	active map[models.AgentID]*models.Session
-	store  *storage.DB
+	active map[sessionKey]*models.Session
+	// roots remembers which session each agent root process last worked
+	// in, for its events that name no directory.
+	roots      map[int]sessionKey
+	workspaces map[string]string
+	store      *storage.DB
 }
 
 func NewSessionManager(store *storage.DB) *SessionManager {
-	return &SessionManager{store: store, active: map[models.AgentID]*models.Session{}}
+	return &SessionManager{store: store, active: map[sessionKey]*models.Session{}, roots: map[int]sessionKey{}, workspaces: map[string]string{}}
 }
 
-func (sm *SessionManager) OnEvent(event *models.AgentEvent) *models.Session {
+// OnEvent adds event to its session, starting one if needed. dir is the
+// directory the event worked in and root the agent's outermost process;
+// either may be unknown.
+func (sm *SessionManager) OnEvent(event *models.AgentEvent, dir string, root int) *models.Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	now := event.Timestamp
-	session, exists := sm.active[event.Agent]
+	key := sm.keyLocked(event.Agent, dir, sm.workspaceLocked(dir), root, now)
+	session, exists := sm.active[key]
 	if !exists || sm.isExpired(session, now) {
-		if exists {
-			sm.closeSessionLocked(session, now)
+		// Sessions of the agent's finished runs would otherwise stay open
+		// until the daemon stops.
+		for k, s := range sm.active {
+			if k.agent == key.agent && sm.isExpired(s, now) {
+				sm.endLocked(k, now)
+			}
 		}
 		session = &models.Session{ID: utils.NewID("cs"), Agent: event.Agent, StartedAt: now, LastActivity: now}
-		session.RepoRoot, session.RepoBranch = detectGitContext(event.Target)
+		if key.workspace != "" {
+			repo := key.workspace
+			session.RepoRoot, session.RepoBranch = &repo, gitBranch(repo)
+		}
 		_ = sm.store.InsertSession(session)
-		sm.active[event.Agent] = session
+		sm.active[key] = session
+	}
+	if root > 0 {
+		sm.roots[root] = key
 	}
 
 	session.LastActivity = now
 	session.Duration = now.Sub(session.StartedAt)
+	if event.ActionType == models.ActionExec {
+		addCWD(session, event.CWD)
+	}
 	sm.updateCounters(session, event)
 	_ = sm.store.UpdateSessionCounters(session)
 	event.SessionID = session.ID
 	return session
 }
 
+// keyLocked picks the session for an event. Events without a workspace
+// join the session their root process last worked in; a root new to the
+// manager gets its own. Events from no known process join the agent's
+// session owning dir, or else its most recently active one.
+func (sm *SessionManager) keyLocked(agent models.AgentID, dir, workspace string, root int, now time.Time) sessionKey {
+	if workspace != "" {
+		return sessionKey{agent: agent, workspace: workspace}
+	}
+	if root > 0 {
+		if key, ok := sm.roots[root]; ok && key.agent == agent {
+			return key
+		}
+		return sessionKey{agent: agent, root: root}
+	}
+	if key, _, ok := sm.ownerLocked(dir, now); ok && key.agent == agent {
+		return key
+	}
+	var (
+		best  sessionKey
+		found bool
+	)
+	for key, s := range sm.active {
+		if key.agent != agent || sm.isExpired(s, now) {
+			continue
+		}
+		if !found || s.LastActivity.After(sm.active[best].LastActivity) {
+			best, found = key, true
+		}
+	}
+	if found {
+		return best
+	}
+	return sessionKey{agent: agent}
+}
+
+// workspaceLocked returns the repository enclosing dir, or "" outside one.
+// The search stops below the home directory: a dotfiles repository there
+// would make home the workspace of everything.
+func (sm *SessionManager) workspaceLocked(dir string) string {
+	if dir == "" || !filepath.IsAbs(dir) {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	if ws, ok := sm.workspaces[dir]; ok {
+		return ws
+	}
+	if len(sm.workspaces) >= maxWorkspaceCache {
+		sm.workspaces = map[string]string{}
+	}
+	ws := ""
+	for d := dir; !isHomeDir(d); d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			ws = d
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	sm.workspaces[dir] = ws
+	return ws
+}
+
 func (sm *SessionManager) isExpired(s *models.Session, now time.Time) bool {
 	idle := now.Sub(s.LastActivity) > SessionIdleTimeout
 	tooOld := now.Sub(s.StartedAt) > SessionMaxDuration
@@ -58,36 +159,103 @@ func (sm *SessionManager) isExpired(s *models.Session, now time.Time) bool {
 }
 
 func (sm *SessionManager) CloseAll() {
+	sm.CloseAllAt(time.Now())
+}
+
+// CloseAllAt ends every active session at now.
+func (sm *SessionManager) CloseAllAt(now time.Time) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	now := time.Now()
 	for _, s := range sm.active {
 		sm.closeSessionLocked(s, now)
 	}
-	sm.active = map[models.AgentID]*models.Session{}
+	sm.active = map[sessionKey]*models.Session{}
+	sm.roots = map[int]sessionKey{}
 }
 
-func (sm *SessionManager) GuessActiveAgent(now time.Time) (models.AgentID, bool) {
+// Owner returns the agent whose active session works in a directory
+// containing path, along with that directory. The session with the most
+// specific directory wins. active reports whether any session is active.
+func (sm *SessionManager) Owner(path string, now time.Time) (owner models.AgentID, dir string, active bool) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	for key, s := range sm.active {
+		if sm.isExpired(s, now) {
+			sm.endLocked(key, now)
+		}
+	}
+	key, dir, ok := sm.ownerLocked(path, now)
+	if !ok {
+		return models.AgentUnknown, "", len(sm.active) > 0
+	}
+	return key.agent, dir, true
+}
+
+// ownerLocked finds the active session whose repository or a working
+// directory of its processes contains path.
+func (sm *SessionManager) ownerLocked(path string, now time.Time) (sessionKey, string, bool) {
 	var (
-		bestAgent models.AgentID
-		bestTime  time.Time
-		found     bool
+		best    sessionKey
+		bestDir string
+		found   bool
 	)
-	for agent, s := range sm.active {
+	if path == "" {
+		return best, "", false
+	}
+	for key, s := range sm.active {
 		if sm.isExpired(s, now) {
-			sm.closeSessionLocked(s, now)
-			delete(sm.active, agent)
 			continue
 		}
-		if !found || s.LastActivity.After(bestTime) {
-			bestAgent = agent
-			bestTime = s.LastActivity
-			found = true
+		dirs := s.CWDs
+		if s.RepoRoot != nil {
+			dirs = append([]string{*s.RepoRoot}, dirs...)
+		}
+		for _, dir := range dirs {
+			if !within(path, dir) {
+				continue
+			}
+			if !found || len(dir) > len(bestDir) || len(dir) == len(bestDir) && s.LastActivity.After(sm.active[best].LastActivity) {
+				best, bestDir, found = key, dir, true
+			}
+		}
+	}
+	return best, bestDir, found
+}
+
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// addCWD records dir as one the session works in. The filesystem root and
+// home directory are too broad to claim every file below them.
+func addCWD(s *models.Session, dir string) {
+	if dir == "" || !filepath.IsAbs(dir) || len(s.CWDs) >= maxSessionCWDs {
+		return
+	}
+	dir = filepath.Clean(dir)
+	if dir == filepath.Dir(dir) || isHomeDir(dir) {
+		return
+	}
+	if !contains(s.CWDs, dir) {
+		s.CWDs = append(s.CWDs, dir)
+	}
+}
+
+func isHomeDir(dir string) bool {
+	home, err := os.UserHomeDir()
+	return err == nil && dir == filepath.Clean(home)
+}
+
+// endLocked closes the session under key and forgets the roots that led
+// to it.
+func (sm *SessionManager) endLocked(key sessionKey, now time.Time) {
+	sm.closeSessionLocked(sm.active[key], now)
+	delete(sm.active, key)
+	for root, k := range sm.roots {
+		if k == key {
+			delete(sm.roots, root)
 		}
 	}
-	return bestAgent, found
 }
 
 func (sm *SessionManager) closeSessionLocked(s *models.Session, now time.Time) {
@@ -99,7 +267,7 @@ func (sm *SessionManager) closeSessionLocked(s *models.Session, now time.Time) {
 
 func (sm *SessionManager) updateCounters(s *models.Session, e *models.AgentEvent) {
 	switch e.ActionType {
-	case models.ActionFileWrite:
+	case models.ActionFileWrite, models.ActionFileRename:
 		s.FileWrites++
 	case models.ActionFileCreate:
 		s.FileCreates++
@@ -107,7 +275,7 @@ func (sm *SessionManager) updateCounters(s *models.Session, e *models.AgentEvent
 		s.FileDeletes++
 	case models.ActionExec:
 		s.ExecCount++
-	case models.ActionNetConnect:
+	case models.ActionNetConnect, models.ActionNetListen:
 		s.NetCount++
 	}
 	if e.RiskScore > s.MaxRisk {
@@ -120,25 +288,14 @@ func (sm *SessionManager) updateCounters(s *models.Session, e *models.AgentEvent
 	}
 }
 
-func detectGitContext(target string) (*string, *string) {
-	dir := target
-	if dir == "" {
-		dir = "."
-	}
-	if !strings.HasPrefix(filepath.Base(dir), ".") {
-		dir = filepath.Dir(dir)
-	}
-	rootBytes, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
-	if err != nil {
-		return nil, nil
-	}
-	branchBytes, err := exec.Command("git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+// gitBranch returns the branch checked out in repo, if git can tell.
+func gitBranch(repo string) *string {
+	out, err := exec.Command("git", "-C", repo, "rev-parse", "--abbrev-ref", "HEAD").Output()
 	if err != nil {
-		return nil, nil
+		return nil
 	}
-	root := strings.TrimSpace(string(rootBytes))
-	branch := strings.TrimSpace(string(branchBytes))
-	return &root, &branch
+	branch := strings.TrimSpace(string(out))
+	return &branch
 }
 
 func contains(items []string, v string) bool {
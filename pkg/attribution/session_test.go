@@ -0,0 +1,144 @@
+package attribution
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
+)
+
+func TestProcess_SeparatesConcurrentSessions(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repoA, repoB := t.TempDir(), t.TempDir()
+	for _, repo := range []string{repoA, repoB} {
+		if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	// One editor process with windows on two repositories.
+	e.Process(models.RawEvent{Timestamp: at(0), PID: 50, PPID: 1, ProcessName: "cursor", ActionType: models.ActionExec, StartTime: base})
+	a := e.Process(models.RawEvent{Timestamp: at(1), PID: 50, ProcessName: "cursor", ActionType: models.ActionFileWrite, Target: filepath.Join(repoA, "main.go")})
+	b := e.Process(models.RawEvent{Timestamp: at(2), PID: 50, ProcessName: "cursor", ActionType: models.ActionFileWrite, Target: filepath.Join(repoB, "pkg", "b.go")})
+	a2 := e.Process(models.RawEvent{Timestamp: at(3), PID: 51, PPID: 50, ProcessName: "go", ActionType: models.ActionExec, Target: "go test ./...", CWD: filepath.Join(repoA, "pkg"), StartTime: base})
+	if a == nil || b == nil || a2 == nil || a.SessionID == b.SessionID || a2.SessionID != a.SessionID {
+		t.Fatalf("expected one session per repository, got %v %v %v", a, b, a2)
+	}
+
+	// Two runs of one CLI outside any repository are told apart by process.
+	e.Process(models.RawEvent{Timestamp: at(4), PID: 60, PPID: 1, ProcessName: "claude", ActionType: models.ActionExec, CWD: "/nonexistent/one", StartTime: base})
+	e.Process(models.RawEvent{Timestamp: at(4), PID: 70, PPID: 1, ProcessName: "claude", ActionType: models.ActionExec, CWD: "/nonexistent/two", StartTime: base})
+	one := e.Process(models.RawEvent{Timestamp: at(5), PID: 61, PPID: 60, ProcessName: "ls", ActionType: models.ActionExec, Target: "ls", StartTime: base})
+	two := e.Process(models.RawEvent{Timestamp: at(6), PID: 71, PPID: 70, ProcessName: "ls", ActionType: models.ActionExec, Target: "ls", StartTime: base})
+	if one == nil || two == nil || one.SessionID == two.SessionID {
+		t.Fatalf("expected one session per root process, got %v %v", one, two)
+	}
+
+	// A root keeps to the repository it last worked in.
+	c := e.Process(models.RawEvent{Timestamp: at(7), PID: 60, ProcessName: "claude", ActionType: models.ActionFileWrite, Target: filepath.Join(repoB, "c.go")})
+	d := e.Process(models.RawEvent{Timestamp: at(8), PID: 62, PPID: 60, ProcessName: "cat", ActionType: models.ActionExec, Target: "cat c.go", StartTime: base})
+	if c == nil || d == nil || d.SessionID != c.SessionID || c.SessionID == one.SessionID {
+		t.Fatalf("expected the root to follow its repository, got %v %v", c, d)
+	}
+
+	sessions, err := db.GetSessions(10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := map[string]string{}
+	for _, s := range sessions {
+		if s.RepoRoot != nil {
+			repos[s.ID] = *s.RepoRoot
+		}
+	}
+	if repos[a.SessionID] != repoA || repos[b.SessionID] != repoB {
+		t.Fatalf("expected each session to keep its own repository, got %v", repos)
+	}
+}
+
+func TestProcess_AttributesFilesByWorkspace(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	human := e.Process(models.RawEvent{Timestamp: at(0), ActionType: models.ActionFileWrite, Target: "/home/dev/notes.md"})
+	run := e.Process(models.RawEvent{Timestamp: at(1), PID: 80, PPID: 1, ProcessName: "codex", ActionType: models.ActionExec, Target: "codex", CWD: "/src/api", StartTime: base})
+	inside := e.Process(models.RawEvent{Timestamp: at(2), ActionType: models.ActionFileWrite, Target: "/src/api/handler.go"})
+	outside := e.Process(models.RawEvent{Timestamp: at(3), ActionType: models.ActionFileWrite, Target: "/home/dev/notes.md"})
+	sibling := e.Process(models.RawEvent{Timestamp: at(4), ActionType: models.ActionFileCreate, Target: "/src/api-v2/main.go"})
+	if human != nil || outside != nil || sibling != nil {
+		t.Fatalf("expected files outside the agent's workspace to stay unattributed, got %v %v %v", human, outside, sibling)
+	}
+	if run == nil || inside == nil || inside.Agent != models.AgentCodex || inside.SessionID != run.SessionID || inside.Attribution.Method != models.AttrWorkspace {
+		t.Fatalf("expected a file in the agent's workspace to be its, got %+v", inside)
+	}
+
+	r, err := db.GetReplay(run.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Unattributed) != 2 || r.Unattributed[0].Path != "/home/dev/notes.md" || r.Unattributed[0].Reason != "outside agent workspaces" || r.Unattributed[1].Action != models.ActionFileCreate {
+		t.Fatalf("expected replay to list the changes left out, got %+v", r.Unattributed)
+	}
+}
+
+func TestProcess_LeavesHumanWritesInAgentWorkspaces(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return base.Add(time.Duration(s) * time.Second) }
+	run := e.Process(models.RawEvent{Timestamp: at(0), PID: 80, PPID: 1, ProcessName: "codex", ActionType: models.ActionExec, Target: "codex", CWD: "/src/api", StartTime: base})
+	e.Process(models.RawEvent{Timestamp: at(1), PID: 90, PPID: 1, ProcessName: "vim", ActionType: models.ActionExec, Target: "vim handler.go", CWD: "/src/api", StartTime: at(1)})
+	saved := e.Process(models.RawEvent{Timestamp: at(2), PID: 90, ProcessName: "vim", ActionType: models.ActionFileWrite, Target: "/src/api/handler.go", StartTime: at(1)})
+	if run == nil || saved != nil {
+		t.Fatalf("expected the editor's save to stay unattributed, got %+v", saved)
+	}
+
+	r, err := db.GetReplay(run.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Unattributed) != 1 || r.Unattributed[0].PID != 90 || r.Unattributed[0].Reason != "written by a non-agent process" {
+		t.Fatalf("expected the save to be listed as a human's, got %+v", r.Unattributed)
+	}
+}
+
+func TestWorkspace_StopsAtHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, d := range []string{".git", "proj/.git", "proj/pkg", "scratch/tmp"} {
+		if err := os.MkdirAll(filepath.Join(home, d), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm := NewSessionManager(nil)
+	for dir, want := range map[string]string{
+		filepath.Join(home, "proj", "pkg"):    filepath.Join(home, "proj"),
+		filepath.Join(home, "scratch", "tmp"): "",
+		home:                                  "",
+	} {
+		if got := sm.workspaceLocked(dir); got != want {
+			t.Errorf("workspace of %s = %q, want %q", dir, got, want)
+		}
+	}
+}
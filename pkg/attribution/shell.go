@@ -0,0 +1,320 @@
+package attribution
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// maxUnwrap bounds how deeply wrappers such as sh -c 'env timeout 5 ...'
+// are followed.
+const maxUnwrap = 8
+
+var (
+	parseMu   sync.Mutex
+	lastLine  string
+	lastParse [][]string
+)
+
+// execCommands returns the argv of every simple command an EXEC runs, with
+// wrappers like sh -c, env, xargs and timeout unwrapped. The event's argv is
+// used when the collector recorded it; otherwise Target is parsed as a
+// shell command line.
+func execCommands(e *models.AgentEvent) [][]string {
+	if e.ActionType != models.ActionExec {
+		return nil
+	}
+	return commandsOf(e.ExecArgs, e.Target)
+}
+
+func commandsOf(argv []string, line string) [][]string {
+	if len(argv) > 0 {
+		return unwrapCommand(argv, 0)
+	}
+	return shellCommands(line)
+}
+
+// shellCommands parses line and returns its simple commands: each side of a
+// pipeline or && chain, and those inside subshells and command
+// substitutions. A line that does not parse is split on whitespace.
+func shellCommands(line string) [][]string {
+	parseMu.Lock()
+	if line == lastLine && lastParse != nil {
+		cmds := lastParse
+		parseMu.Unlock()
+		return cmds
+	}
+	parseMu.Unlock()
+
+	cmds := parseCommands(line, 0)
+	parseMu.Lock()
+	lastLine, lastParse = line, cmds
+	parseMu.Unlock()
+	return cmds
+}
+
+func parseCommands(line string, depth int) [][]string {
+	f, err := syntax.NewParser().Parse(strings.NewReader(line), "")
+	if err != nil {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			return unwrapCommand(fields, depth)
+		}
+		return nil
+	}
+	var cmds [][]string
+	syntax.Walk(f, func(n syntax.Node) bool {
+		if call, ok := n.(*syntax.CallExpr); ok && len(call.Args) > 0 {
+			argv := make([]string, len(call.Args))
+			for i, w := range call.Args {
+				argv[i] = wordString(w)
+			}
+			cmds = append(cmds, unwrapCommand(argv, depth)...)
+		}
+		return true
+	})
+	return cmds
+}
+
+// redirectTargets returns the files the standard output of the named
+// programs is redirected to in a command line, or in the script of a
+// sh -c style argv.
+func redirectTargets(argv []string, line string, names ...string) []string {
+	if len(argv) > 0 {
+		script, ok := "", false
+		if shells[commandName(argv)] {
+			script, ok = shellScript(argv)
+		}
+		if !ok {
+			return nil
+		}
+		line = script
+	}
+	f, err := syntax.NewParser().Parse(strings.NewReader(line), "")
+	if err != nil {
+		return nil
+	}
+	var files []string
+	syntax.Walk(f, func(n syntax.Node) bool {
+		st, ok := n.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		call, ok := st.Cmd.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		argv := make([]string, len(call.Args))
+		for i, w := range call.Args {
+			argv[i] = wordString(w)
+		}
+		if shells[commandName(argv)] {
+			files = append(files, redirectTargets(argv, "", names...)...)
+			return true
+		}
+		if !slices.ContainsFunc(unwrapCommand(argv, 0), func(c []string) bool { return slices.Contains(names, commandName(c)) }) {
+			return true
+		}
+		for _, r := range st.Redirs {
+			if (r.Op == syntax.RdrOut || r.Op == syntax.AppOut || r.Op == syntax.ClbOut || r.Op == syntax.RdrAll) && (r.N == nil || r.N.Value == "1") && r.Word != nil {
+				files = append(files, wordString(r.Word))
+			}
+		}
+		return true
+	})
+	return files
+}
+
+// wordString returns a word as the command would receive it where that is
+// known without running anything, and as written otherwise.
+func wordString(w *syntax.Word) string {
+	var b strings.Builder
+	for _, part := range w.Parts {
+		writeWordPart(&b, part, false)
+	}
+	return b.String()
+}
+
+func writeWordPart(b *strings.Builder, part syntax.WordPart, quoted bool) {
+	switch p := part.(type) {
+	case *syntax.Lit:
+		b.WriteString(unescape(p.Value, quoted))
+	case *syntax.SglQuoted:
+		b.WriteString(p.Value)
+	case *syntax.DblQuoted:
+		for _, inner := range p.Parts {
+			writeWordPart(b, inner, true)
+		}
+	default:
+		_ = syntax.NewPrinter().Print(b, part)
+	}
+}
+
+// unescape drops the backslashes the shell would. Within double quotes only
+// \\, \", \$ and \` are escapes.
+func unescape(s string, quoted bool) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (!quoted || strings.IndexByte("\\\"$`", s[i+1]) >= 0) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// wrapperOpts lists, per wrapper, the options that take a separate value.
+var wrapperOpts = map[string][]string{
+	"env":     {"-u", "--unset", "-C", "--chdir"},
+	"timeout": {"-s", "--signal", "-k", "--kill-after"},
+	"xargs":   {"-a", "--arg-file", "-d", "--delimiter", "-E", "-I", "-L", "-n", "--max-args", "-P", "--max-procs", "-s", "--max-chars"},
+	"sudo":    {"-u", "--user", "-g", "--group", "-C", "--close-from", "-D", "--chdir", "-h", "--host", "-p", "--prompt", "-r", "--role", "-t", "--type", "-U", "--other-user"},
+	"doas":    {"-u", "-C"},
+	"nice":    {"-n", "--adjustment"},
+	"nohup":   nil,
+	"exec":    {"-a"},
+	"command": nil,
+}
+
+var shells = map[string]bool{"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true}
+
+// unwrapCommand returns the commands argv runs: argv itself, or what a
+// wrapper runs in its place. sudo and doas are kept alongside the command
+// they run, since the escalation is itself worth flagging.
+func unwrapCommand(argv []string, depth int) [][]string {
+	if len(argv) == 0 {
+		return nil
+	}
+	if depth >= maxUnwrap {
+		return [][]string{argv}
+	}
+	name := commandName(argv)
+	if shells[name] {
+		if script, ok := shellScript(argv); ok {
+			return parseCommands(script, depth+1)
+		}
+		return [][]string{argv}
+	}
+	takesValue, ok := wrapperOpts[name]
+	if !ok {
+		return [][]string{argv}
+	}
+	i := 1
+	for ; i < len(argv); i++ {
+		a := argv[i]
+		if a == "--" {
+			i++
+			break
+		}
+		if name == "env" && (a == "-S" || a == "--split-string") && i+1 < len(argv) {
+			return parseCommands(strings.Join(argv[i+1:], " "), depth+1)
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			if name == "env" && (a == "-" || strings.Contains(a, "=")) {
+				continue
+			}
+			break
+		}
+		if slices.Contains(takesValue, a) {
+			i++
+		}
+	}
+	if name == "timeout" && i < len(argv) {
+		// The duration.
+		i++
+	}
+	if i >= len(argv) {
+		return [][]string{argv}
+	}
+	inner := unwrapCommand(argv[i:], depth+1)
+	if name == "sudo" || name == "doas" {
+		return append([][]string{argv}, inner...)
+	}
+	return inner
+}
+
+// shellScript returns the script of a sh -c style invocation. The option
+// carrying c may be combined with others, as in bash -lc.
+func shellScript(argv []string) (string, bool) {
+	for i := 1; i < len(argv); i++ {
+		a := argv[i]
+		if a == "--" || !strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "+") {
+			return "", false
+		}
+		if strings.HasPrefix(a, "--") {
+			continue
+		}
+		if a == "-o" || a == "+o" || a == "-O" || a == "+O" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(a, "-") && strings.ContainsRune(a, 'c') && i+1 < len(argv) {
+			return argv[i+1], true
+		}
+	}
+	return "", false
+}
+
+// commandName is argv's program name, lowercased.
+func commandName(argv []string) string {
+	if len(argv) == 0 {
+		return ""
+	}
+	return strings.ToLower(filepath.Base(argv[0]))
+}
+
+// anyCommand reports whether some simple command e runs satisfies f.
+func anyCommand(e *models.AgentEvent, f func(argv []string) bool) bool {
+	return slices.ContainsFunc(execCommands(e), f)
+}
+
+// runs reports whether e runs one of the named programs.
+func runs(e *models.AgentEvent, names ...string) bool {
+	return anyCommand(e, func(argv []string) bool { return slices.Contains(names, commandName(argv)) })
+}
+
+// gitSubcommand returns git's subcommand and its arguments, skipping the
+// global options before it.
+func gitSubcommand(argv []string) (string, []string) {
+	if commandName(argv) != "git" {
+		return "", nil
+	}
+	for i := 1; i < len(argv); i++ {
+		switch a := argv[i]; {
+		case a == "-C" || a == "-c" || a == "--git-dir" || a == "--work-tree" || a == "--namespace":
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			return a, argv[i+1:]
+		}
+	}
+	return "", nil
+}
+
+// hasFlag reports whether args hold one of the long options, possibly with
+// a value, or a short option cluster containing one of the letters.
+func hasFlag(args []string, long []string, short string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if strings.HasPrefix(a, "--") {
+			name, _, _ := strings.Cut(a, "=")
+			if slices.Contains(long, name) {
+				return true
+			}
+			continue
+		}
+		if len(a) > 1 && a[0] == '-' && strings.ContainsAny(a[1:], short) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,63 @@
 package attribution
 
-import "strings"
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 import "github.com/kai-ai/kai/pkg/models"
 
+// AgentSignature recognizes an agent's processes. Every condition that is
+// set must hold: ProcessNames against the process name, Argv against the
+// full command line, ExePaths (filepath.Match globs) against the
+// executable, and Ancestor against some ancestor of the process.
 type AgentSignature struct {
 	ID           models.AgentID
 	ProcessNames []string
 	DisplayName  string
+	Argv         []*regexp.Regexp
+	ExePaths     []string
+	// Ancestor's own ID and Ancestor are ignored.
+	Ancestor *AgentSignature
+	// Domains, Ports and Env are only set on signatures from config;
+	// LoadAgents folds them into KnownAIDomains and EnvMarkers. Ports are
+	// local model servers; Env entries are NAME or NAME=value.
+	Domains []string
+	Ports   []int
+	Env     []string
 }
 
-var Signatures = []AgentSignature{
+// Signatures and KnownAIDomains are the built-ins until LoadAgents merges
+// in the user's agents.
+var (
+	Signatures     = builtinSignatures
+	KnownAIDomains = builtinAIDomains
+	EnvMarkers     = builtinEnvMarkers
+	// extraAIDomains are AI endpoints not tied to any agent.
+	extraAIDomains []string
+)
+
+var builtinSignatures = []AgentSignature{
 	{ID: models.AgentCursor, DisplayName: "Cursor", ProcessNames: []string{"Cursor", "cursor", "cursor-server"}},
 	{ID: models.AgentClaude, DisplayName: "Claude Desktop", ProcessNames: []string{"Claude", "claude"}},
+	{ID: models.AgentClaude, DisplayName: "Claude Code", Argv: []*regexp.Regexp{regexp.MustCompile(`@anthropic-ai/claude-code/`)}},
 	{ID: models.AgentCodex, DisplayName: "Codex CLI", ProcessNames: []string{"codex"}},
-	{ID: models.AgentCopilot, DisplayName: "GitHub Copilot", ProcessNames: []string{"Code", "code", "code-server"}},
+	{ID: models.AgentCodex, DisplayName: "Codex CLI", Argv: []*regexp.Regexp{regexp.MustCompile(`@openai/codex/`)}},
+	{ID: models.AgentGemini, DisplayName: "Gemini CLI", ProcessNames: []string{"gemini"}},
+	{ID: models.AgentGemini, DisplayName: "Gemini CLI", Argv: []*regexp.Regexp{regexp.MustCompile(`@google/gemini-cli/`)}},
+	// VS Code itself is not an agent; Copilot's language server and CLI are.
+	{ID: models.AgentCopilot, DisplayName: "GitHub Copilot", ProcessNames: []string{"copilot", "copilot-language-server"}},
+	{ID: models.AgentCopilot, DisplayName: "GitHub Copilot", Argv: []*regexp.Regexp{regexp.MustCompile(`github\.copilot(-chat)?-\d|@github/copilot`)}},
 	{ID: models.AgentOllama, DisplayName: "Ollama", ProcessNames: []string{"ollama"}},
 	{ID: models.AgentLMStudio, DisplayName: "LM Studio", ProcessNames: []string{"LM Studio", "lm-studio"}},
 }
 
-var KnownAIDomains = map[string]models.AgentID{
+var builtinAIDomains = map[string]models.AgentID{
 	"api.anthropic.com":                   models.AgentClaude,
 	"api.openai.com":                      models.AgentCodex,
 	"chat.openai.com":                     models.AgentCodex,
@@ -33,9 +71,151 @@ var KnownAIDomains = map[string]models.AgentID{
 	"localhost:1234":                      models.AgentLMStudio,
 }
 
+var (
+	agentIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// LoadAgents merges the user's agents into the built-in signatures and
+// domains. An entry reusing a built-in ID extends that agent. It must be
+// called before any engine starts.
+func LoadAgents(custom []AgentSignature, aiDomains []string) error {
+	sigs := slices.Clone(builtinSignatures)
+	domains := maps.Clone(builtinAIDomains)
+	markers := slices.Clone(builtinEnvMarkers)
+	for i, c := range custom {
+		if !agentIDPattern.MatchString(string(c.ID)) || c.ID == models.AgentUnknown {
+			return fmt.Errorf("agents[%d]: invalid id %q (use lowercase letters, digits, '-', '_' or '.')", i, c.ID)
+		}
+		for _, p := range c.Ports {
+			if p <= 0 || p > 65535 {
+				return fmt.Errorf("agents[%d] %s: invalid port %d", i, c.ID, p)
+			}
+			domains["localhost:"+strconv.Itoa(p)] = c.ID
+		}
+		for _, d := range c.Domains {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				domains[d] = c.ID
+			}
+		}
+		for _, env := range c.Env {
+			name, value, _ := strings.Cut(strings.TrimSpace(env), "=")
+			if !envNamePattern.MatchString(name) {
+				return fmt.Errorf("agents[%d] %s: invalid env marker %q", i, c.ID, env)
+			}
+			markers = append(markers, EnvMarker{Name: name, Value: value, Agent: c.ID})
+		}
+		if len(c.ProcessNames) == 0 && len(c.Argv) == 0 && len(c.ExePaths) == 0 {
+			if len(c.Domains) > 0 || len(c.Ports) > 0 || len(c.Env) > 0 {
+				continue
+			}
+			return fmt.Errorf("agents[%d] %s: needs process_names, argv, exe_paths, env, domains or ports", i, c.ID)
+		}
+		if c.DisplayName == "" {
+			c.DisplayName = string(c.ID)
+			if j := slices.IndexFunc(sigs, func(s AgentSignature) bool { return s.ID == c.ID }); j >= 0 {
+				c.DisplayName = sigs[j].DisplayName
+			}
+		}
+		c.Domains, c.Ports, c.Env = nil, nil, nil
+		sigs = append(sigs, c)
+	}
+	var extra []string
+	for _, d := range aiDomains {
+		if d = normalizeDomain(d); d != "" {
+			extra = append(extra, d)
+		}
+	}
+	Signatures, KnownAIDomains, EnvMarkers, extraAIDomains = sigs, domains, markers, extra
+	return nil
+}
+
+// ProcessInfo is what signatures match a process by.
+type ProcessInfo struct {
+	Name string
+	Argv []string
+	Exe  string
+}
+
+// AgentForProcess matches signatures by process name alone.
+func AgentForProcess(name string) (models.AgentID, bool) {
+	return AgentForCommand(ProcessInfo{Name: name}, nil)
+}
+
+// AgentForCommand matches p, whose ancestors are listed nearest first,
+// against the signatures. Signatures with command line, executable or
+// ancestor conditions are tried before plain process names, so a generic
+// runtime claimed by one agent's name does not hide a more specific match.
+func AgentForCommand(p ProcessInfo, ancestors []ProcessInfo) (models.AgentID, bool) {
+	for _, specific := range []bool{true, false} {
+		for _, sig := range Signatures {
+			if sig.specific() == specific && sig.matches(p, ancestors) {
+				return sig.ID, true
+			}
+		}
+	}
+	return models.AgentUnknown, false
+}
+
+// NeedsAncestors reports whether any signature looks at ancestors.
+func NeedsAncestors() bool {
+	return slices.ContainsFunc(Signatures, func(s AgentSignature) bool { return s.Ancestor != nil })
+}
+
+func (s AgentSignature) specific() bool {
+	return len(s.Argv) > 0 || len(s.ExePaths) > 0 || s.Ancestor != nil
+}
+
+func (s AgentSignature) matches(p ProcessInfo, ancestors []ProcessInfo) bool {
+	if len(s.ProcessNames) == 0 && len(s.Argv) == 0 && len(s.ExePaths) == 0 {
+		return false
+	}
+	if len(s.ProcessNames) > 0 && !slices.ContainsFunc(s.ProcessNames, func(n string) bool {
+		return strings.EqualFold(p.Name, n) || strings.EqualFold(filepath.Base(p.Name), n)
+	}) {
+		return false
+	}
+	if len(s.Argv) > 0 {
+		cmdline := strings.Join(p.Argv, " ")
+		if cmdline == "" || !slices.ContainsFunc(s.Argv, func(re *regexp.Regexp) bool { return re.MatchString(cmdline) }) {
+			return false
+		}
+	}
+	if len(s.ExePaths) > 0 && (p.Exe == "" || !slices.ContainsFunc(s.ExePaths, func(glob string) bool {
+		// A glob without a directory matches the executable's base name.
+		target := p.Exe
+		if !strings.Contains(glob, "/") {
+			target = filepath.Base(p.Exe)
+		}
+		ok, _ := filepath.Match(glob, target)
+		return ok
+	})) {
+		return false
+	}
+	if s.Ancestor != nil {
+		anc := *s.Ancestor
+		anc.Ancestor = nil
+		for _, a := range ancestors {
+			if anc.matches(a, nil) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// AgentForDomain returns the agent a domain belongs to. Entries with a port,
+// such as local model servers, match only that host and port.
 func AgentForDomain(domain string) (models.AgentID, bool) {
+	if agent, ok := KnownAIDomains[strings.ToLower(strings.TrimSpace(domain))]; ok {
+		return agent, true
+	}
 	d := normalizeDomain(domain)
 	for known, agent := range KnownAIDomains {
+		if _, port := splitDomainPort(known); port > 0 {
+			continue
+		}
 		k := normalizeDomain(known)
 		if d == k || strings.HasSuffix(d, "."+k) {
 			return agent, true
@@ -52,3 +232,88 @@ func normalizeDomain(v string) string {
 	}
 	return s
 }
+
+// KnownAgent reports whether id names an agent kai has signatures for.
+func KnownAgent(id models.AgentID) bool {
+	for _, sig := range Signatures {
+		if sig.ID == id {
+			return true
+		}
+	}
+	for _, domainAgent := range KnownAIDomains {
+		if domainAgent == id {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvMarker is an environment variable an agent sets for the commands it
+// runs. A marker without an Agent names the agent in its value; one with a
+// Value only counts when the variable has exactly that value.
+type EnvMarker struct {
+	Name  string
+	Value string
+	Agent models.AgentID
+}
+
+// builtinEnvMarkers are in order of precedence.
+var builtinEnvMarkers = []EnvMarker{
+	{Name: "KAI_AGENT"},
+	{Name: "CLAUDECODE", Agent: models.AgentClaude},
+	{Name: "CODEX_SANDBOX", Agent: models.AgentCodex},
+	{Name: "CODEX_SANDBOX_NETWORK_DISABLED", Agent: models.AgentCodex},
+	{Name: "CURSOR_TRACE_ID", Agent: models.AgentCursor},
+}
+
+// AgentForEnv resolves a marker variable and its value to an agent.
+func AgentForEnv(name, value string) (models.AgentID, bool) {
+	for _, m := range EnvMarkers {
+		if m.Name != name {
+			continue
+		}
+		if id, ok := m.agentFor(value); ok {
+			return id, true
+		}
+	}
+	return models.AgentUnknown, false
+}
+
+// AgentForEnviron finds the first marker set in env, a list of NAME=value
+// entries. The marker is returned scrubbed: only its name, plus the value
+// when the marker itself names one, so no secret ever leaves here.
+func AgentForEnviron(env []string) (models.AgentID, string, bool) {
+	vars := map[string]string{}
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && slices.ContainsFunc(EnvMarkers, func(m EnvMarker) bool { return m.Name == name }) {
+			vars[name] = value
+		}
+	}
+	for _, m := range EnvMarkers {
+		value, set := vars[m.Name]
+		if !set {
+			continue
+		}
+		if id, ok := m.agentFor(value); ok {
+			if m.Value != "" {
+				return id, m.Name + "=" + m.Value, true
+			}
+			return id, m.Name, true
+		}
+	}
+	return models.AgentUnknown, "", false
+}
+
+func (m EnvMarker) agentFor(value string) (models.AgentID, bool) {
+	if value == "" || (m.Value != "" && m.Value != value) {
+		return models.AgentUnknown, false
+	}
+	if m.Agent != "" {
+		return m.Agent, true
+	}
+	if id := models.AgentID(strings.ToLower(strings.TrimSpace(value))); KnownAgent(id) {
+		return id, true
+	}
+	return models.AgentUnknown, false
+}
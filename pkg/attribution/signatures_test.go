@@ -1,9 +1,13 @@
 package attribution
 
 import (
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
 )
 
 func TestAgentForDomainSuffix(t *testing.T) {
@@ -26,3 +30,154 @@ func TestAgentForDomainSuffix(t *testing.T) {
 		}
 	}
 }
+
+func TestAgentForEnv(t *testing.T) {
+	cases := []struct {
+		name, value string
+		want        models.AgentID
+		ok          bool
+	}{
+		{"CLAUDECODE", "1", models.AgentClaude, true},
+		{"KAI_AGENT", "Codex", models.AgentCodex, true},
+		{"KAI_AGENT", "nobody", models.AgentUnknown, false},
+		{"CLAUDECODE", "", models.AgentUnknown, false},
+		{"HOME", "/root", models.AgentUnknown, false},
+	}
+	for _, tc := range cases {
+		got, ok := AgentForEnv(tc.name, tc.value)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("%s=%s: got %s ok=%v, want %s ok=%v", tc.name, tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestLoadAgents_MergesWithBuiltins(t *testing.T) {
+	t.Cleanup(func() { _ = LoadAgents(nil, nil) })
+	err := LoadAgents([]AgentSignature{
+		{ID: "aider", DisplayName: "Aider", ProcessNames: []string{"aider"}, Domains: []string{"api.deepseek.com"}, Ports: []int{8080}},
+		{ID: models.AgentClaude, ProcessNames: []string{"claude-internal"}},
+	}, []string{"llm.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := AgentForProcess("aider"); !ok || id != "aider" {
+		t.Fatalf("expected custom process name to match, got %s", id)
+	}
+	if id, _ := AgentForProcess("claude-internal"); id != models.AgentClaude {
+		t.Fatalf("expected built-in agent to be extended, got %s", id)
+	}
+	if id, _ := AgentForProcess("claude"); id != models.AgentClaude {
+		t.Fatal("expected built-in process names to survive the merge")
+	}
+	if id, _ := AgentForDomain("api.deepseek.com"); id != "aider" {
+		t.Fatalf("expected custom domains, got %s", id)
+	}
+	if !KnownAgent("aider") || !isKnownAIDomain("eu.llm.example.com") {
+		t.Fatal("expected custom agent and extra AI domain to be known")
+	}
+	if _, ok := AgentForDomain("llm.example.com"); ok {
+		t.Fatal("expected extra AI domains not to name an agent")
+	}
+
+	if err := LoadAgents([]AgentSignature{{ID: "My Agent"}}, nil); err == nil {
+		t.Fatal("expected invalid id to be rejected")
+	}
+	if err := LoadAgents(nil, nil); err != nil || KnownAgent("aider") {
+		t.Fatal("expected reloading to start from the built-ins")
+	}
+}
+
+func TestClassify_LocalModelServerPorts(t *testing.T) {
+	db, err := storage.Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	t.Cleanup(func() { _ = LoadAgents(nil, nil) })
+	if err := LoadAgents([]AgentSignature{{ID: "vllm", Ports: []int{8080}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewOfflineEngine(db)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Map order varies between lookups; every one must agree.
+	for range 20 {
+		for target, want := range map[string]models.AgentID{
+			"127.0.0.1:8080":  "vllm",
+			"127.0.0.1:11434": models.AgentOllama,
+			"[::1]:1234":      models.AgentLMStudio,
+			"127.0.0.1:9999":  models.AgentUnknown,
+		} {
+			raw := models.RawEvent{Timestamp: base, PID: 40, ProcessName: "python3", ActionType: models.ActionNetConnect, Target: target}
+			if got, attr := e.classify(raw, base); got != want || want != models.AgentUnknown && attr.Method != models.AttrDomain {
+				t.Fatalf("%s: got %s by %s, want %s", target, got, attr.Method, want)
+			}
+		}
+	}
+}
+
+func TestAgentForCommand_InterpreterHostedAgents(t *testing.T) {
+	cases := []struct {
+		name string
+		p    ProcessInfo
+		want models.AgentID
+	}{
+		{"claude code", ProcessInfo{Name: "node", Argv: []string{"node", "/usr/lib/node_modules/@anthropic-ai/claude-code/cli.js"}}, models.AgentClaude},
+		{"codex via npm", ProcessInfo{Name: "node", Argv: []string{"node", "/home/dev/.npm-global/lib/node_modules/@openai/codex/bin/codex.js"}}, models.AgentCodex},
+		{"copilot server", ProcessInfo{Name: "node", Argv: []string{"/usr/share/code/code", "/home/dev/.vscode/extensions/github.copilot-1.250.0/dist/language-server.js"}}, models.AgentCopilot},
+		{"plain node", ProcessInfo{Name: "node", Argv: []string{"node", "server.js"}}, models.AgentUnknown},
+		{"vs code", ProcessInfo{Name: "code", Argv: []string{"/usr/share/code/code", "."}}, models.AgentUnknown},
+	}
+	for _, tc := range cases {
+		if got, _ := AgentForCommand(tc.p, nil); got != tc.want {
+			t.Fatalf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAgentForCommand_SpecificConditionsWinOverNames(t *testing.T) {
+	t.Cleanup(func() { _ = LoadAgents(nil, nil) })
+	err := LoadAgents([]AgentSignature{
+		{ID: "runtime", ProcessNames: []string{"python3"}},
+		{ID: "aider", ExePaths: []string{"/opt/aider/*/python3"}},
+		{ID: "helper", ProcessNames: []string{"python3"}, Ancestor: &AgentSignature{Argv: []*regexp.Regexp{regexp.MustCompile(`--helper-host`)}}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := AgentForCommand(ProcessInfo{Name: "python3", Exe: "/opt/aider/venv/python3"}, nil); id != "aider" {
+		t.Fatalf("expected exe glob to win over the bare name, got %s", id)
+	}
+	if id, _ := AgentForCommand(ProcessInfo{Name: "python3"}, []ProcessInfo{{Name: "host", Argv: []string{"host", "--helper-host"}}}); id != "helper" {
+		t.Fatalf("expected ancestor condition to match, got %s", id)
+	}
+	if id, _ := AgentForCommand(ProcessInfo{Name: "python3"}, nil); id != "runtime" {
+		t.Fatalf("expected name-only fallback, got %s", id)
+	}
+}
+
+func TestAgentForEnviron_ScrubsValues(t *testing.T) {
+	t.Cleanup(func() { _ = LoadAgents(nil, nil) })
+	if err := LoadAgents([]AgentSignature{{ID: "zed", Env: []string{"TERM_PROGRAM=zed"}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		env    []string
+		want   models.AgentID
+		marker string
+	}{
+		{[]string{"OPENAI_API_KEY=sk-secret", "CLAUDECODE=1"}, models.AgentClaude, "CLAUDECODE"},
+		{[]string{"CURSOR_TRACE_ID=4f1c9e", "KAI_AGENT=codex"}, models.AgentCodex, "KAI_AGENT"},
+		{[]string{"TERM_PROGRAM=zed"}, "zed", "TERM_PROGRAM=zed"},
+		{[]string{"TERM_PROGRAM=iTerm.app", "CLAUDECODE="}, models.AgentUnknown, ""},
+	}
+	for _, tc := range cases {
+		id, marker, _ := AgentForEnviron(tc.env)
+		if id != tc.want || marker != tc.marker {
+			t.Fatalf("%v: got %s %q, want %s %q", tc.env, id, marker, tc.want, tc.marker)
+		}
+	}
+	if err := LoadAgents([]AgentSignature{{ID: "bad", Env: []string{"NOT A NAME"}}}, nil); err == nil {
+		t.Fatal("expected invalid marker name to be rejected")
+	}
+}
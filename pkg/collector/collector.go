@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"net"
 	"runtime"
 
 	"github.com/kai-ai/kai/pkg/collector/linux"
@@ -14,15 +15,38 @@ type Collector interface {
 	Start(ctx context.Context, out chan<- models.RawEvent) error
 }
 
-func NewCollector() Collector {
+type Config struct {
+	// WatchRoots are always watched for file events. When empty the daemon's
+	// working directory is used.
+	WatchRoots []string
+	// IsAgentProcess, when set, lets collectors that support it also watch
+	// the workspace of every running agent process.
+	IsAgentProcess func(processName string, argv []string, exe string) bool
+	// SensitivePaths are watched for reads by collectors that support it;
+	// see config.Config.
+	SensitivePaths []string
+}
+
+func NewCollector(cfg Config) Collector {
 	switch runtime.GOOS {
 	case "darwin":
-		return macos.New()
+		return macos.New(cfg.WatchRoots)
 	case "linux":
-		return linux.New()
+		c := linux.New(cfg.WatchRoots, cfg.IsAgentProcess)
+		c.WatchReads(cfg.SensitivePaths)
+		return c
 	case "windows":
 		return windows.New()
 	default:
 		return windows.New()
 	}
 }
+
+// SocketOwner names the local process holding the socket bound to addr, on
+// platforms that can tell. It returns 0 and "" otherwise.
+func SocketOwner(network string, addr net.Addr) (int, string) {
+	if runtime.GOOS == "linux" {
+		return linux.SocketOwner(network, addr)
+	}
+	return 0, ""
+}
@@ -0,0 +1,202 @@
+package linux
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// containerIDPattern matches the 64-hex container ID that Docker, containerd,
+// CRI-O and Podman put in cgroup paths, e.g. docker-<id>.scope,
+// /docker/<id>, cri-containerd-<id>.scope or libpod-<id>.scope.
+var containerIDPattern = regexp.MustCompile(`(?:^|[/\-])([0-9a-f]{64})(?:\.scope)?$`)
+
+// maxContainers bounds the container cache; it is simply reset when full.
+const maxContainers = 256
+
+// containerInfo describes the container a process runs in.
+type containerInfo struct {
+	ID    string
+	Image string
+	// mounts is the container's mount table and host ours. Both are nil
+	// when the process shares the daemon's mount namespace.
+	mounts []mountEntry
+	host   []mountEntry
+}
+
+// mountEntry is one /proc/<pid>/mountinfo row: the directory root of the
+// filesystem on device dev appears at point.
+type mountEntry struct {
+	dev, root, point string
+}
+
+// containerID returns the container pid runs in, or "" for host processes.
+func (p *procFS) containerID(pid int) string {
+	data, err := os.ReadFile(p.path(pid, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	return containerIDFromCgroup(string(data))
+}
+
+func containerIDFromCgroup(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		// hierarchy-ID:controllers:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, seg := range strings.Split(parts[2], "/") {
+			if m := containerIDPattern.FindStringSubmatch("/" + seg); m != nil {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// mountTables returns pid's mount table and the daemon's when pid lives in
+// a different mount namespace. ok is false when they could not be read,
+// typically because pid has already exited.
+func (p *procFS) mountTables(pid int) (container, host []mountEntry, ok bool) {
+	ns, err := os.Readlink(p.path(pid, "ns/mnt"))
+	if err != nil {
+		return nil, nil, false
+	}
+	self, err := os.Readlink(filepath.Join(p.root, "self", "ns", "mnt"))
+	if err != nil {
+		return nil, nil, false
+	}
+	if ns == self {
+		return nil, nil, true
+	}
+	cdata, err := os.ReadFile(p.path(pid, "mountinfo"))
+	if err != nil {
+		return nil, nil, false
+	}
+	hdata, err := os.ReadFile(filepath.Join(p.root, "self", "mountinfo"))
+	if err != nil {
+		return nil, nil, false
+	}
+	return parseMountInfo(string(cdata)), parseMountInfo(string(hdata)), true
+}
+
+func parseMountInfo(data string) []mountEntry {
+	var out []mountEntry
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		out = append(out, mountEntry{dev: fields[2], root: unescapeMount(fields[3]), point: unescapeMount(fields[4])})
+	}
+	return out
+}
+
+// unescapeMount undoes the octal escaping mountinfo applies to spaces,
+// tabs, newlines and backslashes.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	r := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	return r.Replace(s)
+}
+
+// hostPath maps a path as the container sees it to the same file as the
+// daemon sees it. It finds the container mount holding path, then a host
+// mount of the same device whose root contains that mount's root. Paths on
+// mounts with no host counterpart are returned unchanged.
+func (ci containerInfo) hostPath(path string) string {
+	if ci.mounts == nil || path == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	var cm *mountEntry
+	for i := range ci.mounts {
+		m := &ci.mounts[i]
+		if within(path, m.point) && (cm == nil || len(m.point) >= len(cm.point)) {
+			cm = m
+		}
+	}
+	if cm == nil {
+		return path
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, cm.point), "/")
+	var best *mountEntry
+	for i := range ci.host {
+		h := &ci.host[i]
+		if h.dev != cm.dev || !within(cm.root, h.root) {
+			continue
+		}
+		if best == nil || len(h.root) > len(best.root) {
+			best = h
+		}
+	}
+	if best == nil {
+		return path
+	}
+	sub := strings.TrimPrefix(strings.TrimPrefix(cm.root, best.root), "/")
+	return filepath.Join(best.point, sub, rel)
+}
+
+// dockerImage reads the image a Docker container was started from.
+func dockerImage(dockerRoot, id string) string {
+	data, err := os.ReadFile(filepath.Join(dockerRoot, "containers", id, "config.v2.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg struct {
+		Config struct {
+			Image string
+		}
+	}
+	if json.Unmarshal(data, &cfg) != nil {
+		return ""
+	}
+	return cfg.Config.Image
+}
+
+// container returns what is known about the container pid runs in. Results
+// are cached per container, since a container's image and mounts do not
+// change while it runs; mounts that could not be read are tried again with
+// the next process.
+func (c *collector) container(pid int) (containerInfo, bool) {
+	id := c.proc.containerID(pid)
+	if id == "" {
+		return containerInfo{}, false
+	}
+	c.containersMu.Lock()
+	defer c.containersMu.Unlock()
+	if ci, ok := c.containers[id]; ok {
+		return ci, true
+	}
+	if len(c.containers) >= maxContainers {
+		c.containers = map[string]containerInfo{}
+	}
+	ci := containerInfo{ID: id, Image: dockerImage(c.dockerRoot, id)}
+	var ok bool
+	if ci.mounts, ci.host, ok = c.proc.mountTables(pid); ok {
+		c.containers[id] = ci
+	}
+	return ci, true
+}
+
+// tagContainer marks ev as coming from a container and rewrites its working
+// directory to the host path, so workspace and snapshot lookups still work.
+func (c *collector) tagContainer(ev models.RawEvent) models.RawEvent {
+	if ev.PID <= 0 {
+		return ev
+	}
+	ci, ok := c.container(ev.PID)
+	if !ok {
+		return ev
+	}
+	ev.ContainerID = ci.ID
+	ev.ContainerImage = ci.Image
+	ev.CWD = ci.hostPath(ev.CWD)
+	return ev
+}
@@ -0,0 +1,145 @@
+package linux
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+const testContainerID = "3f2a1b9c0d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+
+func TestContainerIDFromCgroup(t *testing.T) {
+	cases := map[string]string{
+		"0::/system.slice/docker-" + testContainerID + ".scope\n":                             testContainerID,
+		"12:memory:/docker/" + testContainerID + "\n0::/\n":                                   testContainerID,
+		"0::/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + testContainerID + ".scope": testContainerID,
+		"0::/machine.slice/libpod-" + testContainerID + ".scope/container":                    testContainerID,
+		"0::/user.slice/user-1000.slice/session-2.scope\n":                                    "",
+		"0::/init.scope\n": "",
+	}
+	for in, want := range cases {
+		if got := containerIDFromCgroup(in); got != want {
+			t.Errorf("containerIDFromCgroup(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestContainerInfo_HostPath(t *testing.T) {
+	ci := containerInfo{
+		mounts: parseMountInfo(strings.Join([]string{
+			"600 500 0:55 / / rw,relatime - overlay overlay rw",
+			"601 600 8:1 /home/dev/proj /workspaces/proj rw,relatime - ext4 /dev/sda1 rw",
+			"602 600 8:2 /cache /root/.cache rw - ext4 /dev/sdb1 rw",
+			"603 600 8:1 /home/dev/my\\040notes /notes rw - ext4 /dev/sda1 rw",
+		}, "\n")),
+		host: parseMountInfo(strings.Join([]string{
+			"22 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw",
+			"30 22 0:55 / /var/lib/docker/overlay2/abc/merged rw - overlay overlay rw",
+			"31 22 8:2 / /mnt/data rw - ext4 /dev/sdb1 rw",
+		}, "\n")),
+	}
+	cases := map[string]string{
+		"/workspaces/proj":             "/home/dev/proj",
+		"/workspaces/proj/src/main.go": "/home/dev/proj/src/main.go",
+		"/root/.cache/go-build":        "/mnt/data/cache/go-build",
+		"/notes/todo.md":               "/home/dev/my notes/todo.md",
+		"/etc/hosts":                   "/var/lib/docker/overlay2/abc/merged/etc/hosts",
+		"relative":                     "relative",
+	}
+	for in, want := range cases {
+		if got := ci.hostPath(in); got != want {
+			t.Errorf("hostPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := (containerInfo{}).hostPath("/workspaces/proj"); got != "/workspaces/proj" {
+		t.Fatalf("a process in our mount namespace should keep its paths, got %q", got)
+	}
+}
+
+func TestScanProc_TagsContainerProcesses(t *testing.T) {
+	root := newFakeProcFS(t)
+	addFakeProc(t, root, fakeProc{pid: 20, ppid: 1, comm: "node", argv: []string{"node", "agent.js"}, cwd: "/workspaces/proj", uid: 1000, ticks: 100})
+	addFakeProc(t, root, fakeProc{pid: 21, ppid: 1, comm: "bash", argv: []string{"bash"}, cwd: "/home/dev", uid: 1000, ticks: 100})
+	writeFile(t, filepath.Join(root, "20", "cgroup"), "0::/system.slice/docker-"+testContainerID+".scope\n")
+	writeFile(t, filepath.Join(root, "21", "cgroup"), "0::/user.slice/user-1000.slice\n")
+	writeFile(t, filepath.Join(root, "20", "mountinfo"), "601 600 8:1 /home/dev/proj /workspaces/proj rw - ext4 /dev/sda1 rw\n")
+	writeFile(t, filepath.Join(root, "self", "mountinfo"), "22 1 8:1 / / rw - ext4 /dev/sda1 rw\n")
+	for pid, ns := range map[string]string{"20": "mnt:[4026532001]", "self": "mnt:[4026531840]"} {
+		if err := os.MkdirAll(filepath.Join(root, pid, "ns"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(ns, filepath.Join(root, pid, "ns", "mnt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docker := t.TempDir()
+	writeFile(t, filepath.Join(docker, "containers", testContainerID, "config.v2.json"), `{"ID":"`+testContainerID+`","Config":{"Image":"mcr.microsoft.com/devcontainers/go:1"}}`)
+
+	c := New(nil, nil)
+	c.proc = newProcFS(root)
+	c.dockerRoot = docker
+	out := make(chan models.RawEvent, 16)
+	c.scanProc(context.Background(), out)
+
+	tagged := 0
+	for _, ev := range drain(out) {
+		switch ev.PID {
+		case 20:
+			tagged++
+			if ev.ContainerID != testContainerID || ev.ContainerImage != "mcr.microsoft.com/devcontainers/go:1" || ev.CWD != "/home/dev/proj" {
+				t.Fatalf("expected container process to be tagged with host cwd, got %+v", ev)
+			}
+		case 21:
+			if ev.ContainerID != "" || ev.CWD != "/home/dev" {
+				t.Fatalf("expected host process to be untouched, got %+v", ev)
+			}
+		}
+	}
+	if tagged != 2 {
+		t.Fatalf("expected spawn and exec for the container process, got %d", tagged)
+	}
+}
+
+func TestContainer_RetriesMountsThatCouldNotBeRead(t *testing.T) {
+	root := newFakeProcFS(t)
+	addFakeProc(t, root, fakeProc{pid: 20, ppid: 1, comm: "sh", argv: []string{"sh"}, cwd: "/workspaces/proj", uid: 1000, ticks: 100})
+	addFakeProc(t, root, fakeProc{pid: 22, ppid: 1, comm: "node", argv: []string{"node"}, cwd: "/workspaces/proj", uid: 1000, ticks: 100})
+	for _, pid := range []string{"20", "22"} {
+		writeFile(t, filepath.Join(root, pid, "cgroup"), "0::/system.slice/docker-"+testContainerID+".scope\n")
+	}
+	// pid 20 exited before its namespace could be read.
+	writeFile(t, filepath.Join(root, "22", "mountinfo"), "601 600 8:1 /home/dev/proj /workspaces/proj rw - ext4 /dev/sda1 rw\n")
+	writeFile(t, filepath.Join(root, "self", "mountinfo"), "22 1 8:1 / / rw - ext4 /dev/sda1 rw\n")
+	for pid, ns := range map[string]string{"22": "mnt:[4026532001]", "self": "mnt:[4026531840]"} {
+		if err := os.MkdirAll(filepath.Join(root, pid, "ns"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(ns, filepath.Join(root, pid, "ns", "mnt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := New(nil, nil)
+	c.proc = newProcFS(root)
+	c.dockerRoot = t.TempDir()
+	if ev := c.tagContainer(models.RawEvent{PID: 20, CWD: "/workspaces/proj"}); ev.ContainerID != testContainerID || ev.CWD != "/workspaces/proj" {
+		t.Fatalf("expected the container without a host path, got %+v", ev)
+	}
+	if ev := c.tagContainer(models.RawEvent{PID: 22, CWD: "/workspaces/proj"}); ev.CWD != "/home/dev/proj" {
+		t.Fatalf("expected the mounts to be read from the next process, got %+v", ev)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,215 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/collector/rename"
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// Constants from <linux/fanotify.h>.
+const (
+	fanMetadataVersion  = 3
+	fanMetadataLen      = 24
+	fanInfoTypeDFIDName = 0x2
+	fanModify           = 0x2
+	fanOpen             = 0x20
+	fanMovedFrom        = 0x40
+	fanMovedTo          = 0x80
+	fanCreate           = 0x100
+	fanDelete           = 0x200
+	fanQOverflow        = 0x4000
+	fanRecvBuffer       = 1 << 16
+)
+
+// fileEventSource yields raw fanotify event buffers and resolves the directory
+// file handles they carry back to paths. Recv follows procEventSource's
+// contract of returning nil, nil on an idle poll interval. Watch makes events
+// from the filesystem holding root visible and WatchOpen reports opens of
+// one file, or of the files in one directory. Both may be called
+// concurrently with Recv and Resolve.
+type fileEventSource interface {
+	Recv() ([]byte, error)
+	Resolve(ev fanEvent) (string, error)
+	Watch(root string) error
+	WatchOpen(path string) error
+	Close() error
+}
+
+type fanEvent struct {
+	mask       uint64
+	pid        int
+	fsid       [2]int32
+	handleType int32
+	handle     []byte
+	name       string
+}
+
+// parseFanotifyEvents decodes FAN_REPORT_DFID_NAME events. Events without a
+// directory-and-name record (including queue overflow) are skipped.
+func parseFanotifyEvents(buf []byte) []fanEvent {
+	ne := binary.NativeEndian
+	var events []fanEvent
+	for len(buf) >= fanMetadataLen {
+		eventLen := int(ne.Uint32(buf[0:4]))
+		if eventLen < fanMetadataLen || eventLen > len(buf) {
+			break
+		}
+		metaLen := int(ne.Uint16(buf[6:8]))
+		if buf[4] == fanMetadataVersion && metaLen >= fanMetadataLen && metaLen <= eventLen {
+			ev := fanEvent{mask: ne.Uint64(buf[8:16]), pid: int(int32(ne.Uint32(buf[20:24])))}
+			if ev.mask&fanQOverflow == 0 && parseFanInfo(buf[metaLen:eventLen], &ev) {
+				events = append(events, ev)
+			}
+		}
+		buf = buf[eventLen:]
+	}
+	return events
+}
+
+func parseFanInfo(b []byte, ev *fanEvent) bool {
+	ne := binary.NativeEndian
+	for len(b) >= 4 {
+		infoType := b[0]
+		infoLen := int(ne.Uint16(b[2:4]))
+		if infoLen < 4 || infoLen > len(b) {
+			return false
+		}
+		rec := b[:infoLen]
+		b = b[infoLen:]
+		if infoType != fanInfoTypeDFIDName || len(rec) < 20 {
+			continue
+		}
+		ev.fsid = [2]int32{int32(ne.Uint32(rec[4:8])), int32(ne.Uint32(rec[8:12]))}
+		handleLen := int(ne.Uint32(rec[12:16]))
+		ev.handleType = int32(ne.Uint32(rec[16:20]))
+		if 20+handleLen > len(rec) {
+			return false
+		}
+		ev.handle = append([]byte(nil), rec[20:20+handleLen]...)
+		name := rec[20+handleLen:]
+		if i := strings.IndexByte(string(name), 0); i >= 0 {
+			name = name[:i]
+		}
+		ev.name = string(name)
+		return true
+	}
+	return false
+}
+
+// fanActions maps a possibly merged event mask to actions in the same order
+// consumeFS emits them for a combined fsnotify op. Moves map to the rename
+// halves; consumeFileEvents pairs them.
+func fanActions(mask uint64) []models.ActionType {
+	var actions []models.ActionType
+	if mask&fanCreate != 0 {
+		actions = append(actions, models.ActionFileCreate)
+	}
+	if mask&fanMovedTo != 0 {
+		actions = append(actions, actionMovedTo)
+	}
+	if mask&fanModify != 0 {
+		actions = append(actions, models.ActionFileWrite)
+	}
+	if mask&fanDelete != 0 {
+		actions = append(actions, models.ActionFileDelete)
+	}
+	if mask&fanMovedFrom != 0 {
+		actions = append(actions, actionMovedFrom)
+	}
+	if mask&fanOpen != 0 {
+		actions = append(actions, models.ActionFileRead)
+	}
+	return actions
+}
+
+// Rename halves, never emitted as such.
+const (
+	actionMovedFrom models.ActionType = "moved-from"
+	actionMovedTo   models.ActionType = "moved-to"
+)
+
+func (c *collector) consumeFileEvents(ctx context.Context, src fileEventSource, out chan<- models.RawEvent) {
+	defer src.Close()
+	self := os.Getpid()
+	var renames rename.Pairer
+	emit := func(evs []models.RawEvent) {
+		for _, ev := range evs {
+			out <- ev
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		buf, err := src.Recv()
+		if err != nil {
+			return
+		}
+		if len(buf) == 0 {
+			emit(renames.Flush())
+		}
+		for _, ev := range parseFanotifyEvents(buf) {
+			if ev.pid == self {
+				continue
+			}
+			actions := fanActions(ev.mask)
+			if len(actions) == 0 {
+				continue
+			}
+			dir, err := src.Resolve(ev)
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(dir, ev.name)
+			roots := c.currentRoots()
+			info, _ := c.proc.read(ev.pid)
+			for _, action := range actions {
+				// Sensitive files live outside the workspace; everything
+				// else must be inside it.
+				if action == models.ActionFileRead {
+					if !c.isSensitive(path) || c.seenRead(ev.pid, path, time.Now()) {
+						continue
+					}
+				} else if !underRoots(path, roots) {
+					continue
+				}
+				raw := c.tagContainer(models.RawEvent{Timestamp: time.Now(), PID: ev.pid, PPID: info.PPID, ProcessName: info.Comm, ActionType: action, Target: path, CWD: info.CWD, UID: info.UID, Platform: "linux", StartTime: info.StartTime})
+				switch action {
+				case actionMovedFrom:
+					emit(renames.From(raw))
+				case actionMovedTo:
+					emit(renames.To(raw))
+				default:
+					emit(renames.Flush())
+					out <- raw
+				}
+			}
+		}
+	}
+}
+
+// underRoots reports whether path lies inside one of roots and outside the
+// directories addRecursive never watches.
+func underRoots(path string, roots []string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+			if skipDir(part) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
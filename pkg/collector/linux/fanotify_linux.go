@@ -0,0 +1,139 @@
+package linux
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const fanotifyMask = unix.FAN_MODIFY | unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO
+
+type fanotifySource struct {
+	fd  int
+	buf []byte
+
+	mu sync.Mutex
+	// mounts holds a descriptor per filesystem for resolving handles;
+	// marked records which filesystems have a filesystem-wide mark.
+	mounts map[[2]int32]int
+	marked map[[2]int32]bool
+}
+
+// dialFanotify opens a fanotify group reporting directory handles and names.
+// Filesystem marks need CAP_SYS_ADMIN and resolving handles needs
+// CAP_DAC_READ_SEARCH, so the group is probed with a mark on the working
+// directory; callers fall back to fsnotify on error.
+func dialFanotify() (fileEventSource, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_LARGEFILE)
+	if err != nil {
+		return nil, err
+	}
+	s := &fanotifySource{fd: fd, buf: make([]byte, fanRecvBuffer), mounts: map[[2]int32]int{}, marked: map[[2]int32]bool{}}
+	if err := s.Watch("."); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fanotifySource) Watch(root string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fsid, mfd, err := s.mount(root)
+	if err != nil {
+		return err
+	}
+	if s.marked[fsid] {
+		return nil
+	}
+	if err := unix.FanotifyMark(s.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyMask, mfd, ""); err != nil {
+		return err
+	}
+	s.marked[fsid] = true
+	return nil
+}
+
+func (s *fanotifySource) WatchOpen(path string) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dir, mask := filepath.Dir(path), uint64(unix.FAN_OPEN)
+	if st.IsDir() {
+		dir, mask = path, mask|unix.FAN_EVENT_ON_CHILD
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, _, err := s.mount(dir); err != nil {
+		return err
+	}
+	return unix.FanotifyMark(s.fd, unix.FAN_MARK_ADD, mask, unix.AT_FDCWD, path)
+}
+
+// mount returns the filesystem holding dir and a descriptor on it, opening
+// one the first time the filesystem is seen. s.mu must be held.
+func (s *fanotifySource) mount(dir string) ([2]int32, int, error) {
+	mfd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return [2]int32{}, -1, err
+	}
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(mfd, &st); err != nil {
+		_ = unix.Close(mfd)
+		return [2]int32{}, -1, err
+	}
+	if old, ok := s.mounts[st.Fsid.Val]; ok {
+		_ = unix.Close(mfd)
+		return st.Fsid.Val, old, nil
+	}
+	s.mounts[st.Fsid.Val] = mfd
+	return st.Fsid.Val, mfd, nil
+}
+
+func (s *fanotifySource) Recv() ([]byte, error) {
+	fds := []unix.PollFd{{Fd: int32(s.fd), Events: unix.POLLIN}}
+	if _, err := unix.Poll(fds, 1000); err != nil {
+		if errors.Is(err, unix.EINTR) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	n, err := unix.Read(s.fd, s.buf)
+	if err != nil {
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.buf[:n], nil
+}
+
+func (s *fanotifySource) Resolve(ev fanEvent) (string, error) {
+	s.mu.Lock()
+	mfd, ok := s.mounts[ev.fsid]
+	s.mu.Unlock()
+	if !ok {
+		return "", errors.New("event from unwatched filesystem")
+	}
+	fd, err := unix.OpenByHandleAt(mfd, unix.NewFileHandle(ev.handleType, ev.handle), unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+	return os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+}
+
+func (s *fanotifySource) Close() error {
+	s.mu.Lock()
+	for _, mfd := range s.mounts {
+		_ = unix.Close(mfd)
+	}
+	s.mounts = map[[2]int32]int{}
+	s.marked = map[[2]int32]bool{}
+	s.mu.Unlock()
+	return unix.Close(s.fd)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package linux
+
+import "errors"
+
+func dialFanotify() (fileEventSource, error) {
+	return nil, errors.New("fanotify requires linux")
+}
@@ -0,0 +1,153 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+type fakeFileSource struct {
+	msgs  [][]byte
+	dirs  map[string]string
+	opens []string
+}
+
+func (f *fakeFileSource) Recv() ([]byte, error) {
+	if len(f.msgs) == 0 {
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}
+	m := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	return m, nil
+}
+
+func (f *fakeFileSource) Resolve(ev fanEvent) (string, error) {
+	dir, ok := f.dirs[string(ev.handle)]
+	if !ok {
+		return "", errors.New("stale handle")
+	}
+	return dir, nil
+}
+
+func (f *fakeFileSource) Watch(string) error { return nil }
+
+func (f *fakeFileSource) WatchOpen(path string) error {
+	f.opens = append(f.opens, path)
+	return nil
+}
+
+func (f *fakeFileSource) Close() error { return nil }
+
+func fanMsg(mask uint64, pid int32, handle, name string) []byte {
+	ne := binary.NativeEndian
+	info := make([]byte, 20+len(handle)+len(name)+1)
+	info[0] = fanInfoTypeDFIDName
+	ne.PutUint16(info[2:4], uint16(len(info)))
+	ne.PutUint32(info[4:8], 7)
+	ne.PutUint32(info[12:16], uint32(len(handle)))
+	ne.PutUint32(info[16:20], 1)
+	copy(info[20:], handle)
+	copy(info[20+len(handle):], name)
+
+	buf := make([]byte, fanMetadataLen+len(info))
+	ne.PutUint32(buf[0:4], uint32(len(buf)))
+	buf[4] = fanMetadataVersion
+	ne.PutUint16(buf[6:8], fanMetadataLen)
+	ne.PutUint64(buf[8:16], mask)
+	ne.PutUint32(buf[16:20], ^uint32(0))
+	ne.PutUint32(buf[20:24], uint32(pid))
+	copy(buf[fanMetadataLen:], info)
+	return buf
+}
+
+func TestParseFanotifyEvents(t *testing.T) {
+	buf := append(fanMsg(fanModify, 321, "h1", "main.go"), fanMsg(fanQOverflow, 0, "", "")...)
+	buf = append(buf, fanMsg(fanCreate, 322, "h2", "new.go")...)
+	evs := parseFanotifyEvents(buf)
+	if len(evs) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(evs), evs)
+	}
+	if evs[0].pid != 321 || evs[0].name != "main.go" || string(evs[0].handle) != "h1" || evs[0].fsid[0] != 7 {
+		t.Fatalf("unexpected first event: %+v", evs[0])
+	}
+	if evs[1].mask&fanCreate == 0 || evs[1].name != "new.go" {
+		t.Fatalf("unexpected second event: %+v", evs[1])
+	}
+}
+
+func TestConsumeFileEvents_AttributesPIDWithinRoots(t *testing.T) {
+	root := t.TempDir()
+	src := &fakeFileSource{
+		msgs: [][]byte{
+			fanMsg(fanModify, 4001, "inside", "main.go"),
+			fanMsg(fanModify, 4002, "outside", "notes.md"),
+			fanMsg(fanCreate, 4003, "git", "index.lock"),
+			fanMsg(fanDelete, 4004, "inside", "old.go"),
+		},
+		dirs: map[string]string{
+			"inside":  root,
+			"outside": "/elsewhere",
+			"git":     filepath.Join(root, ".git"),
+		},
+	}
+	c := New([]string{root}, nil)
+	c.refreshRoots(fanotifySink{src: src}, nil)
+	out := make(chan models.RawEvent, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.consumeFileEvents(ctx, src, out)
+	}()
+
+	write := <-out
+	if write.ActionType != models.ActionFileWrite || write.PID != 4001 || write.Target != filepath.Join(root, "main.go") {
+		t.Fatalf("unexpected write event: %+v", write)
+	}
+	del := <-out
+	if del.ActionType != models.ActionFileDelete || del.PID != 4004 {
+		t.Fatalf("unexpected delete event: %+v", del)
+	}
+	cancel()
+	<-done
+	select {
+	case ev := <-out:
+		t.Fatalf("unexpected extra event: %+v", ev)
+	default:
+	}
+}
+
+func TestConsumeFileEvents_PairsRenames(t *testing.T) {
+	root := t.TempDir()
+	src := &fakeFileSource{
+		msgs: [][]byte{
+			append(fanMsg(fanMovedFrom, 4001, "inside", "a.go"), fanMsg(fanMovedTo, 4001, "inside", "b.go")...),
+			append(fanMsg(fanMovedFrom, 4002, "inside", "gone.go"), fanMsg(fanMovedTo, 4002, "outside", "gone.go")...),
+			fanMsg(fanMovedTo, 4003, "inside", "in.go"),
+		},
+		dirs: map[string]string{"inside": root, "outside": "/elsewhere"},
+	}
+	c := New([]string{root}, nil)
+	c.refreshRoots(fanotifySink{src: src}, nil)
+	out := make(chan models.RawEvent, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.consumeFileEvents(ctx, src, out)
+
+	ren := <-out
+	if ren.ActionType != models.ActionFileRename || ren.OldPath != filepath.Join(root, "a.go") || ren.Target != filepath.Join(root, "b.go") {
+		t.Fatalf("expected paired rename, got %+v", ren)
+	}
+	if del := <-out; del.ActionType != models.ActionFileDelete || del.Target != filepath.Join(root, "gone.go") {
+		t.Fatalf("expected a move out of the roots to be a delete, got %+v", del)
+	}
+	if cr := <-out; cr.ActionType != models.ActionFileCreate || cr.Target != filepath.Join(root, "in.go") {
+		t.Fatalf("expected a move into the roots to be a create, got %+v", cr)
+	}
+}
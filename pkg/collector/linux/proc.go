@@ -6,54 +6,142 @@ import (
 	"encoding/hex"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
+	"github.com/kai-ai/kai/pkg/collector/rename"
 	"github.com/kai-ai/kai/pkg/models"
 )
 
 type collector struct {
-	seenProc map[int]struct{}
-	seenConn map[string]time.Time
+	proc     *procFS
+	seenProc map[int]time.Time
+	flows    map[string]*netFlow
+	netScan  uint64
+
+	openProcEvents func() (procEventSource, error)
+	openFileEvents func() (fileEventSource, error)
+	openSockDiag   func() (sockDiagSource, error)
+	procLive       atomic.Bool
+	diag           sockDiagSource
+
+	dockerRoot   string
+	containersMu sync.Mutex
+	containers   map[string]containerInfo
+
+	isAgent     func(processName string, argv []string, exe string) bool
+	staticRoots []string
+	rootsMu     sync.Mutex
+	roots       []string
+
+	readPatterns []string
+	readPaths    []string
+	lastRead     map[string]time.Time
 }
 
-func New() *collector {
-	return &collector{seenProc: map[int]struct{}{}, seenConn: map[string]time.Time{}}
+// New returns the Linux collector. File events are collected under
+// watchRoots (the daemon's working directory when empty) and under the
+// workspace of every running process for which isAgent reports true.
+func New(watchRoots []string, isAgent func(processName string, argv []string, exe string) bool) *collector {
+	if len(watchRoots) == 0 {
+		if cwd, err := os.Getwd(); err == nil {
+			watchRoots = []string{cwd}
+		}
+	}
+	return &collector{
+		proc:           newProcFS("/proc"),
+		seenProc:       map[int]time.Time{},
+		flows:          map[string]*netFlow{},
+		containers:     map[string]containerInfo{},
+		lastRead:       map[string]time.Time{},
+		dockerRoot:     "/var/lib/docker",
+		openProcEvents: dialProcConnector,
+		openFileEvents: dialFanotify,
+		openSockDiag:   dialSockDiag,
+		isAgent:        isAgent,
+		staticRoots:    watchRoots,
+	}
 }
 
 func (c *collector) Start(ctx context.Context, out chan<- models.RawEvent) error {
-	watcher, err := fsnotify.NewWatcher()
-	if err == nil {
+	// fanotify reports the writing PID; fsnotify only knows the path.
+	var sink rootSink
+	var reads fileEventSource
+	if src, err := c.openFileEvents(); err == nil {
+		sink = fanotifySink{src: src}
+		reads = src
+		go c.consumeFileEvents(ctx, src, out)
+	} else if watcher, err := fsnotify.NewWatcher(); err == nil {
 		defer watcher.Close()
-		if cwd, e := os.Getwd(); e == nil {
-			_ = addRecursive(watcher, cwd)
-		}
+		sink = fsnotifySink{w: watcher}
 		go c.consumeFS(ctx, watcher, out)
 	}
+	if sink != nil {
+		c.refreshRoots(sink, c.scanAgentRoots())
+	}
+	// Only fanotify can see opens; fsnotify has no reader PID to attribute.
+	if reads != nil {
+		c.markReads(reads)
+	}
+
+	// Inventory already-running processes once, then rely on kernel proc
+	// events when available so short-lived commands are not missed.
+	c.scanProc(ctx, out)
+	if src, err := c.openProcEvents(); err == nil {
+		c.procLive.Store(true)
+		go c.consumeProcEvents(ctx, src, out)
+	}
+	if diag, err := c.openSockDiag(); err == nil {
+		defer diag.Close()
+		c.diag = diag
+	}
 
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
+	rootTicker := time.NewTicker(5 * time.Second)
+	defer rootTicker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-rootTicker.C:
+			if sink != nil {
+				c.refreshRoots(sink, c.scanAgentRoots())
+			}
+			if reads != nil {
+				c.markReads(reads)
+			}
 		case <-ticker.C:
-			c.scanProc(ctx, out)
+			if !c.procLive.Load() {
+				c.scanProc(ctx, out)
+			}
 			c.scanNet(ctx, out)
 		}
 	}
 }
 
 func (c *collector) consumeFS(ctx context.Context, watcher *fsnotify.Watcher, out chan<- models.RawEvent) {
+	// fsnotify reports a rename as Rename on the old name followed by Create
+	// on the new one.
+	var renames rename.Pairer
+	var renameTimeout <-chan time.Time
+	emit := func(evs []models.RawEvent) {
+		for _, ev := range evs {
+			out <- ev
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-renameTimeout:
+			emit(renames.Flush())
 		case ev := <-watcher.Events:
 			if ev.Name == "" {
 				continue
@@ -62,13 +150,19 @@ func (c *collector) consumeFS(ctx context.Context, watcher *fsnotify.Watcher, ou
 				if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
 					_ = addRecursive(watcher, ev.Name)
 				}
-				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileCreate, Target: ev.Name, Platform: "linux"}
+				emit(renames.To(models.RawEvent{Timestamp: time.Now(), Target: ev.Name, UID: -1, Platform: "linux"}))
 			}
 			if ev.Op&fsnotify.Write == fsnotify.Write {
-				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileWrite, Target: ev.Name, Platform: "linux"}
+				emit(renames.Flush())
+				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileWrite, Target: ev.Name, UID: -1, Platform: "linux"}
+			}
+			if ev.Op&fsnotify.Remove == fsnotify.Remove {
+				emit(renames.Flush())
+				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileDelete, Target: ev.Name, UID: -1, Platform: "linux"}
 			}
-			if ev.Op&fsnotify.Remove == fsnotify.Remove || ev.Op&fsnotify.Rename == fsnotify.Rename {
-				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileDelete, Target: ev.Name, Platform: "linux"}
+			if ev.Op&fsnotify.Rename == fsnotify.Rename {
+				emit(renames.From(models.RawEvent{Timestamp: time.Now(), Target: ev.Name, UID: -1, Platform: "linux"}))
+				renameTimeout = time.After(rename.Window)
 			}
 		case <-watcher.Errors:
 		}
@@ -83,8 +177,7 @@ func addRecursive(w *fsnotify.Watcher, root string) error {
 		if !d.IsDir() {
 			return nil
 		}
-		name := d.Name()
-		if name == ".git" || name == ".cache" || name == "node_modules" {
+		if skipDir(d.Name()) {
 			return filepath.SkipDir
 		}
 		_ = w.Add(path)
@@ -92,51 +185,82 @@ func addRecursive(w *fsnotify.Watcher, root string) error {
 	})
 }
 
+func skipDir(name string) bool {
+	return name == ".git" || name == ".cache" || name == "node_modules"
+}
+
+// scanProc reports processes that appeared since the previous scan and
+// forgets those that have exited. A PID seen again with a different start
+// time is a new process.
 func (c *collector) scanProc(ctx context.Context, out chan<- models.RawEvent) {
-	scanCtx, cancel := context.WithTimeout(ctx, 800*time.Millisecond)
-	defer cancel()
-	cmd := exec.CommandContext(scanCtx, "ps", "-axo", "pid=,ppid=,comm=,args=")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return
-	}
-	if err := cmd.Start(); err != nil {
-		return
-	}
-	s := bufio.NewScanner(stdout)
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		if line == "" {
+	live := map[int]struct{}{}
+	for _, pid := range c.proc.pids() {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		_, start, ok := c.proc.stat(pid)
+		if !ok {
 			continue
 		}
-		fields := strings.Fields(line)
-		if len(fields) < 4 {
+		live[pid] = struct{}{}
+		prev, seen := c.seenProc[pid]
+		if seen && prev.Equal(start) {
 			continue
 		}
-		pid, _ := strconv.Atoi(fields[0])
-		ppid, _ := strconv.Atoi(fields[1])
-		proc := fields[2]
-		args := strings.Join(fields[3:], " ")
-		if _, ok := c.seenProc[pid]; ok {
+		if seen {
+			out <- models.RawEvent{Timestamp: time.Now(), PID: pid, ActionType: models.ActionProcExit, ExitCode: -1, UID: -1, Platform: "linux", StartTime: prev}
+		}
+		info, ok := c.proc.read(pid)
+		if !ok {
 			continue
 		}
-		c.seenProc[pid] = struct{}{}
-		out <- models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: ppid, ProcessName: proc, ActionType: models.ActionProcSpawn, Target: args, Platform: "linux"}
+		c.seenProc[pid] = info.StartTime
+		args := commandLine(info.Argv)
+		out <- c.tagContainer(models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: info.PPID, ProcessName: info.Comm, ActionType: models.ActionProcSpawn, Target: args, CWD: info.CWD, UID: info.UID, Platform: "linux", StartTime: info.StartTime})
 		if args != "" {
-			out <- models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: ppid, ProcessName: proc, ActionType: models.ActionExec, Target: args, Platform: "linux"}
+			out <- c.tagContainer(models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: info.PPID, ProcessName: info.Comm, ActionType: models.ActionExec, Target: args, ExecArgs: info.Argv, Exe: info.Exe, CWD: info.CWD, UID: info.UID, Platform: "linux", StartTime: info.StartTime})
+		}
+	}
+	for pid, start := range c.seenProc {
+		if _, ok := live[pid]; !ok {
+			delete(c.seenProc, pid)
+			// Polling only sees that the process is gone, not how it ended.
+			out <- models.RawEvent{Timestamp: time.Now(), PID: pid, ActionType: models.ActionProcExit, ExitCode: -1, UID: -1, Platform: "linux", StartTime: start}
 		}
 	}
-	_ = cmd.Wait()
 }
 
+// netFlow is one socket seen in /proc/net. It lives for as long as the
+// socket keeps showing up in scans, so a long connection is one event.
+type netFlow struct {
+	start      models.RawEvent
+	sent, recv int64
+	scan       uint64
+}
+
+// scanNet reports sockets that appeared since the previous scan and closes
+// flows whose socket is gone. TCP byte counts come from sock_diag when it is
+// available; they are sampled each scan, so the final reading can trail the
+// real total by up to one scan interval.
 func (c *collector) scanNet(ctx context.Context, out chan<- models.RawEvent) {
 	inodePID := c.buildInodePIDMap()
-	c.scanProcNetFile(ctx, "/proc/net/tcp", inodePID, out)
-	c.scanProcNetFile(ctx, "/proc/net/tcp6", inodePID, out)
-	c.gcConnCache()
+	var counters map[string]tcpCounters
+	if c.diag != nil {
+		counters, _ = c.diag.TCPCounters()
+	}
+	c.netScan++
+	for _, f := range []struct{ name, proto string }{{"tcp", "tcp"}, {"tcp6", "tcp"}, {"udp", "udp"}, {"udp6", "udp"}} {
+		c.scanProcNetFile(ctx, filepath.Join(c.proc.root, "net", f.name), f.proto, inodePID, counters, out)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	c.closeFlows(out)
 }
 
-func (c *collector) scanProcNetFile(ctx context.Context, path string, inodePID map[string]int, out chan<- models.RawEvent) {
+func (c *collector) scanProcNetFile(ctx context.Context, path, proto string, inodePID map[string]int, counters map[string]tcpCounters, out chan<- models.RawEvent) {
 	f, err := os.Open(path)
 	if err != nil {
 		return
@@ -162,45 +286,103 @@ func (c *collector) scanProcNetFile(ctx context.Context, path string, inodePID m
 		if len(fields) < 10 {
 			continue
 		}
-		state := fields[3]
-		if state != "01" { // ESTABLISHED
-			continue
-		}
-		remoteIP, remotePort, ok := parseHexAddr(fields[2])
-		if !ok || remoteIP == "0.0.0.0" || remoteIP == "::" {
+		action, target, ok := c.netRow(proto, fields)
+		if !ok {
 			continue
 		}
 		inode := fields[9]
-		key := inode + "|" + remoteIP + ":" + strconv.Itoa(remotePort)
-		if _, seen := c.seenConn[key]; seen {
+		key := string(action) + "|" + proto + "|" + inode + "|" + target
+		fl, seen := c.flows[key]
+		if !seen {
+			pid := inodePID[inode]
+			// The start time lets the engine tell the socket's process
+			// from a later one reusing its PID.
+			var start time.Time
+			if pid > 0 {
+				_, start, _ = c.proc.stat(pid)
+			}
+			fl = &netFlow{start: models.RawEvent{
+				Timestamp:   time.Now(),
+				PID:         pid,
+				ProcessName: c.proc.comm(pid),
+				ActionType:  action,
+				Target:      target,
+				Protocol:    proto,
+				UID:         -1,
+				Platform:    "linux",
+				FlowID:      key,
+				StartTime:   start,
+			}}
+			c.flows[key] = fl
+			out <- fl.start
+		}
+		fl.scan = c.netScan
+		if cnt, ok := counters[inode]; ok && proto == "tcp" {
+			fl.sent, fl.recv = cnt.sent, cnt.recv
+		}
+	}
+}
+
+// closeFlows emits NET_CLOSE for every flow the latest scan did not see.
+func (c *collector) closeFlows(out chan<- models.RawEvent) {
+	for key, fl := range c.flows {
+		if fl.scan == c.netScan {
 			continue
 		}
-		c.seenConn[key] = time.Now()
-		pid := inodePID[inode]
-		procName := processName(pid)
-		out <- models.RawEvent{
-			Timestamp:   time.Now(),
-			PID:         pid,
-			ProcessName: procName,
-			ActionType:  models.ActionNetConnect,
-			Target:      remoteIP + ":" + strconv.Itoa(remotePort),
-			Platform:    "linux",
+		delete(c.flows, key)
+		ev := fl.start
+		ev.Timestamp = time.Now()
+		ev.ActionType = models.ActionNetClose
+		ev.BytesSent = fl.sent
+		ev.BytesRecv = fl.recv
+		out <- ev
+	}
+}
+
+// netRow decides what a /proc/net/{tcp,udp}[6] row means. TCP rows are
+// connections when ESTABLISHED and listeners when LISTEN. UDP has no listen
+// state, so a connected socket is a connection and an unconnected one bound
+// outside the ephemeral port range is treated as a listener.
+func (c *collector) netRow(proto string, fields []string) (models.ActionType, string, bool) {
+	state := fields[3]
+	localIP, localPort, ok := parseHexAddr(fields[1])
+	if !ok {
+		return "", "", false
+	}
+	remoteIP, remotePort, ok := parseHexAddr(fields[2])
+	if !ok {
+		return "", "", false
+	}
+	remote := net.JoinHostPort(remoteIP, strconv.Itoa(remotePort))
+	local := net.JoinHostPort(localIP, strconv.Itoa(localPort))
+	unspecified := remoteIP == "0.0.0.0" || remoteIP == "::"
+	switch proto {
+	case "tcp":
+		switch state {
+		case "01": // ESTABLISHED
+			if unspecified {
+				return "", "", false
+			}
+			return models.ActionNetConnect, remote, true
+		case "0A": // LISTEN
+			return models.ActionNetListen, local, true
+		}
+	case "udp":
+		if !unspecified && remotePort != 0 {
+			return models.ActionNetConnect, remote, true
+		}
+		lo, hi := c.proc.ephemeralPorts()
+		if state == "07" && localPort > 0 && (localPort < lo || localPort > hi) {
+			return models.ActionNetListen, local, true
 		}
 	}
+	return "", "", false
 }
 
 func (c *collector) buildInodePIDMap() map[string]int {
 	res := map[string]int{}
-	ents, err := os.ReadDir("/proc")
-	if err != nil {
-		return res
-	}
-	for _, ent := range ents {
-		pid, err := strconv.Atoi(ent.Name())
-		if err != nil {
-			continue
-		}
-		fdDir := filepath.Join("/proc", ent.Name(), "fd")
+	for _, pid := range c.proc.pids() {
+		fdDir := c.proc.path(pid, "fd")
 		fds, err := os.ReadDir(fdDir)
 		if err != nil {
 			continue
@@ -221,17 +403,6 @@ func (c *collector) buildInodePIDMap() map[string]int {
 	return res
 }
 
-func processName(pid int) string {
-	if pid <= 0 {
-		return ""
-	}
-	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
-	if err != nil {
-		return ""
-	}
-	return strings.TrimSpace(string(b))
-}
-
 func parseHexAddr(v string) (string, int, bool) {
 	parts := strings.Split(v, ":")
 	if len(parts) != 2 {
@@ -261,12 +432,3 @@ func parseHexAddr(v string) (string, int, bool) {
 	}
 	return "", 0, false
 }
-
-func (c *collector) gcConnCache() {
-	cut := time.Now().Add(-2 * time.Minute)
-	for k, t := range c.seenConn {
-		if t.Before(cut) {
-			delete(c.seenConn, k)
-		}
-	}
-}
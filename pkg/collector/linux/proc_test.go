@@ -0,0 +1,84 @@
+package linux
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func TestNetRow(t *testing.T) {
+	c := New(nil, nil)
+	c.proc = newProcFS(newFakeProcFS(t))
+	cases := []struct {
+		name, proto, row string
+		action           models.ActionType
+		target           string
+	}{
+		{"tcp established", "tcp", "0: 0100007F:A1B2 0E01A8C0:01BB 01", models.ActionNetConnect, "192.168.1.14:443"},
+		{"tcp listen any", "tcp", "1: 00000000:0BB8 00000000:0000 0A", models.ActionNetListen, "0.0.0.0:3000"},
+		{"tcp6 listen", "tcp", "2: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A", models.ActionNetListen, "[::]:8080"},
+		{"tcp time wait", "tcp", "3: 0100007F:A1B2 0E01A8C0:01BB 06", "", ""},
+		{"udp connected", "udp", "4: 0100007F:C350 08080808:01BB 01", models.ActionNetConnect, "8.8.8.8:443"},
+		{"udp bound", "udp", "5: 0100007F:14E9 00000000:0000 07", models.ActionNetListen, "127.0.0.1:5353"},
+		{"udp ephemeral", "udp", "6: 00000000:9C40 00000000:0000 07", "", ""},
+	}
+	for _, tc := range cases {
+		fields := strings.Fields(tc.row + " 00000000:00000000 00:00000000 00000000 1000 0 12345")
+		action, target, ok := c.netRow(tc.proto, fields)
+		if ok != (tc.action != "") || action != tc.action || target != tc.target {
+			t.Errorf("%s: got (%q, %q, %v), want (%q, %q)", tc.name, action, target, ok, tc.action, tc.target)
+		}
+	}
+}
+
+type fakeSockDiag map[string]tcpCounters
+
+func (f fakeSockDiag) TCPCounters() (map[string]tcpCounters, error) { return f, nil }
+func (f fakeSockDiag) Close() error                                 { return nil }
+
+func TestScanNet_OneFlowPerConnection(t *testing.T) {
+	root := newFakeProcFS(t)
+	if err := os.MkdirAll(filepath.Join(root, "net"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	header := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	row := "   0: 0100007F:A1B2 0E01A8C0:01BB 01 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0 20 4 30 10 -1\n"
+	writeTCP := func(rows string) {
+		if err := os.WriteFile(filepath.Join(root, "net", "tcp"), []byte(header+rows), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diag := fakeSockDiag{"4242": {sent: 100, recv: 10}}
+	c := New(nil, nil)
+	c.proc = newProcFS(root)
+	c.diag = diag
+	out := make(chan models.RawEvent, 16)
+
+	writeTCP(row)
+	c.scanNet(context.Background(), out)
+	got := drain(out)
+	if len(got) != 1 || got[0].ActionType != models.ActionNetConnect || got[0].FlowID == "" {
+		t.Fatalf("expected one connect event with a flow id, got %+v", got)
+	}
+	flowID := got[0].FlowID
+
+	diag["4242"] = tcpCounters{sent: 1_200_000, recv: 3_000}
+	c.scanNet(context.Background(), out)
+	if got := drain(out); len(got) != 0 {
+		t.Fatalf("expected a still-open connection to stay one flow, got %+v", got)
+	}
+
+	writeTCP("")
+	c.scanNet(context.Background(), out)
+	got = drain(out)
+	if len(got) != 1 || got[0].ActionType != models.ActionNetClose || got[0].FlowID != flowID {
+		t.Fatalf("expected close for the flow, got %+v", got)
+	}
+	if got[0].BytesSent != 1_200_000 || got[0].BytesRecv != 3_000 || got[0].Target != "192.168.1.14:443" {
+		t.Fatalf("unexpected close event: %+v", got[0])
+	}
+}
@@ -0,0 +1,201 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// Constants from <linux/connector.h> and <linux/cn_proc.h>.
+const (
+	cnIdxProc          = 0x1
+	cnValProc          = 0x1
+	procCnMcastListen  = 1
+	procEventFork      = 0x00000001
+	procEventExec      = 0x00000002
+	procEventExit      = 0x80000000
+	nlmsgHdrLen        = 16
+	cnMsgHdrLen        = 20
+	procEventHdrLen    = 16
+	nlmsgDone          = 0x3
+	procConnRecvBuffer = 1 << 16
+)
+
+// procEventSource yields raw NETLINK_CONNECTOR datagrams. Recv returns a nil
+// slice and nil error when nothing arrived within its poll interval, so the
+// reader can observe context cancellation. Tests substitute a fake source.
+type procEventSource interface {
+	Recv() ([]byte, error)
+	Close() error
+}
+
+type procEvent struct {
+	what       uint32
+	pid        int
+	tgid       int
+	parentPID  int
+	parentTGID int
+	exitCode   uint32
+	exitSignal uint32
+}
+
+// procConnectorListenMsg builds the PROC_CN_MCAST_LISTEN subscription request.
+func procConnectorListenMsg() []byte {
+	buf := make([]byte, nlmsgHdrLen+cnMsgHdrLen+4)
+	ne := binary.NativeEndian
+	ne.PutUint32(buf[0:4], uint32(len(buf)))
+	ne.PutUint16(buf[4:6], nlmsgDone)
+	ne.PutUint32(buf[12:16], uint32(os.Getpid()))
+	cn := buf[nlmsgHdrLen:]
+	ne.PutUint32(cn[0:4], cnIdxProc)
+	ne.PutUint32(cn[4:8], cnValProc)
+	ne.PutUint16(cn[16:18], 4)
+	ne.PutUint32(cn[cnMsgHdrLen:], procCnMcastListen)
+	return buf
+}
+
+// parseProcMessages decodes every proc_event carried in one netlink datagram.
+func parseProcMessages(buf []byte) []procEvent {
+	ne := binary.NativeEndian
+	var events []procEvent
+	for len(buf) >= nlmsgHdrLen {
+		msgLen := int(ne.Uint32(buf[0:4]))
+		if msgLen < nlmsgHdrLen || msgLen > len(buf) {
+			break
+		}
+		if ev, ok := parseCnMsg(buf[nlmsgHdrLen:msgLen]); ok {
+			events = append(events, ev)
+		}
+		next := (msgLen + 3) &^ 3
+		if next > len(buf) {
+			break
+		}
+		buf = buf[next:]
+	}
+	return events
+}
+
+func parseCnMsg(b []byte) (procEvent, bool) {
+	ne := binary.NativeEndian
+	if len(b) < cnMsgHdrLen {
+		return procEvent{}, false
+	}
+	if ne.Uint32(b[0:4]) != cnIdxProc || ne.Uint32(b[4:8]) != cnValProc {
+		return procEvent{}, false
+	}
+	dataLen := int(ne.Uint16(b[16:18]))
+	data := b[cnMsgHdrLen:]
+	if dataLen > len(data) {
+		return procEvent{}, false
+	}
+	data = data[:dataLen]
+	if len(data) < procEventHdrLen {
+		return procEvent{}, false
+	}
+	ev := procEvent{what: ne.Uint32(data[0:4])}
+	body := data[procEventHdrLen:]
+	switch ev.what {
+	case procEventFork:
+		if len(body) < 16 {
+			return procEvent{}, false
+		}
+		ev.parentPID = int(ne.Uint32(body[0:4]))
+		ev.parentTGID = int(ne.Uint32(body[4:8]))
+		ev.pid = int(ne.Uint32(body[8:12]))
+		ev.tgid = int(ne.Uint32(body[12:16]))
+	case procEventExec:
+		if len(body) < 8 {
+			return procEvent{}, false
+		}
+		ev.pid = int(ne.Uint32(body[0:4]))
+		ev.tgid = int(ne.Uint32(body[4:8]))
+	case procEventExit:
+		if len(body) < 16 {
+			return procEvent{}, false
+		}
+		ev.pid = int(ne.Uint32(body[0:4]))
+		ev.tgid = int(ne.Uint32(body[4:8]))
+		ev.exitCode = ne.Uint32(body[8:12])
+		ev.exitSignal = ne.Uint32(body[12:16])
+	default:
+		return procEvent{}, false
+	}
+	return ev, true
+}
+
+// consumeProcEvents forwards fork/exec notifications until ctx is done or the
+// source fails; procLive is cleared on return so Start resumes polling.
+func (c *collector) consumeProcEvents(ctx context.Context, src procEventSource, out chan<- models.RawEvent) {
+	defer c.procLive.Store(false)
+	defer src.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		buf, err := src.Recv()
+		if err != nil {
+			return
+		}
+		for _, ev := range parseProcMessages(buf) {
+			if !c.handleProcEvent(ctx, ev, out) {
+				return
+			}
+		}
+	}
+}
+
+// handleProcEvent forwards one notification. It returns false once ctx is
+// done, as the consumer may be gone.
+func (c *collector) handleProcEvent(ctx context.Context, ev procEvent, out chan<- models.RawEvent) bool {
+	send := func(raw models.RawEvent) bool {
+		select {
+		case out <- raw:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	switch ev.what {
+	case procEventFork:
+		// Thread creation also reports as fork; only new thread groups are processes.
+		if ev.pid != ev.tgid {
+			return true
+		}
+		info, _ := c.proc.read(ev.tgid)
+		return send(c.tagContainer(models.RawEvent{Timestamp: time.Now(), PID: ev.tgid, PPID: ev.parentTGID, ProcessName: info.Comm, ActionType: models.ActionProcSpawn, Target: info.Comm, CWD: info.CWD, UID: info.UID, Platform: "linux", StartTime: info.StartTime}))
+	case procEventExec:
+		info, ok := c.proc.read(ev.tgid)
+		if !ok || (info.Comm == "" && len(info.Argv) == 0) {
+			return true
+		}
+		args := commandLine(info.Argv)
+		if args == "" {
+			args = info.Comm
+		}
+		return send(c.tagContainer(models.RawEvent{Timestamp: time.Now(), PID: ev.tgid, PPID: info.PPID, ProcessName: info.Comm, ActionType: models.ActionExec, Target: args, ExecArgs: info.Argv, Exe: info.Exe, CWD: info.CWD, UID: info.UID, Platform: "linux", StartTime: info.StartTime}))
+	case procEventExit:
+		// Threads exit too; the process ends with its group leader.
+		if ev.pid != ev.tgid {
+			return true
+		}
+		// The exiting task is still a zombie, so stat is readable.
+		ppid, start, _ := c.proc.stat(ev.tgid)
+		code, sig := waitStatus(ev.exitCode)
+		return send(models.RawEvent{Timestamp: time.Now(), PID: ev.tgid, PPID: ppid, ProcessName: c.proc.comm(ev.tgid), ActionType: models.ActionProcExit, ExitCode: code, ExitSignal: sig, UID: -1, Platform: "linux", StartTime: start})
+	}
+	return true
+}
+
+// waitStatus decodes the kernel's exit_code, which is a wait(2) status
+// (exit_signal in the event is the signal sent to the parent, not the cause).
+func waitStatus(status uint32) (code, signal int) {
+	if sig := int(status & 0x7f); sig != 0 {
+		return -1, sig
+	}
+	return int(status>>8) & 0xff, 0
+}
@@ -0,0 +1,50 @@
+package linux
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+type netlinkProcSource struct {
+	fd  int
+	buf []byte
+}
+
+// dialProcConnector subscribes to kernel proc events. Binding to the proc
+// multicast group needs CAP_NET_ADMIN; callers fall back to polling on error.
+func dialProcConnector() (procEventSource, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 1<<20)
+	tv := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	if err := unix.Sendto(fd, procConnectorListenMsg(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return &netlinkProcSource{fd: fd, buf: make([]byte, procConnRecvBuffer)}, nil
+}
+
+func (s *netlinkProcSource) Recv() ([]byte, error) {
+	n, _, err := unix.Recvfrom(s.fd, s.buf, 0)
+	if err != nil {
+		// ENOBUFS means the kernel dropped events under load; keep listening.
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) || errors.Is(err, unix.ENOBUFS) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.buf[:n], nil
+}
+
+func (s *netlinkProcSource) Close() error { return unix.Close(s.fd) }
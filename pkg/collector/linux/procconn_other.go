@@ -0,0 +1,9 @@
+//go:build !linux
+
+package linux
+
+import "errors"
+
+func dialProcConnector() (procEventSource, error) {
+	return nil, errors.New("proc connector requires linux")
+}
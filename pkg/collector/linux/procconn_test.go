@@ -0,0 +1,143 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+type fakeProcSource struct {
+	msgs [][]byte
+}
+
+func (f *fakeProcSource) Recv() ([]byte, error) {
+	if len(f.msgs) == 0 {
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}
+	m := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	return m, nil
+}
+
+func (f *fakeProcSource) Close() error { return nil }
+
+func procMsg(what uint32, body ...uint32) []byte {
+	ne := binary.NativeEndian
+	data := make([]byte, procEventHdrLen+4*len(body))
+	ne.PutUint32(data[0:4], what)
+	for i, v := range body {
+		ne.PutUint32(data[procEventHdrLen+4*i:], v)
+	}
+	buf := make([]byte, nlmsgHdrLen+cnMsgHdrLen+len(data))
+	ne.PutUint32(buf[0:4], uint32(len(buf)))
+	cn := buf[nlmsgHdrLen:]
+	ne.PutUint32(cn[0:4], cnIdxProc)
+	ne.PutUint32(cn[4:8], cnValProc)
+	ne.PutUint16(cn[16:18], uint16(len(data)))
+	copy(cn[cnMsgHdrLen:], data)
+	return buf
+}
+
+func TestParseProcMessages(t *testing.T) {
+	buf := append(procMsg(procEventFork, 100, 100, 200, 200), procMsg(procEventExec, 200, 200)...)
+	buf = append(buf, procMsg(procEventExit, 200, 200, 256, 17)...)
+	evs := parseProcMessages(buf)
+	if len(evs) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(evs))
+	}
+	if evs[0].what != procEventFork || evs[0].parentTGID != 100 || evs[0].tgid != 200 {
+		t.Fatalf("unexpected fork event: %+v", evs[0])
+	}
+	if evs[1].what != procEventExec || evs[1].tgid != 200 {
+		t.Fatalf("unexpected exec event: %+v", evs[1])
+	}
+	if evs[2].what != procEventExit || evs[2].exitCode != 256 || evs[2].exitSignal != 17 {
+		t.Fatalf("unexpected exit event: %+v", evs[2])
+	}
+}
+
+func TestParseProcMessages_IgnoresTruncated(t *testing.T) {
+	msg := procMsg(procEventFork, 1, 1, 2, 2)
+	if evs := parseProcMessages(msg[:len(msg)-4]); len(evs) != 0 {
+		t.Fatalf("expected truncated message to be dropped, got %+v", evs)
+	}
+}
+
+func TestConsumeProcEvents(t *testing.T) {
+	self := uint32(os.Getpid())
+	src := &fakeProcSource{msgs: [][]byte{
+		procMsg(procEventFork, 1, 1, 4242, 4241), // thread, ignored
+		procMsg(procEventFork, 1, 1, 4242, 4242),
+		procMsg(procEventExit, 4243, 4242, 0, 0), // thread, ignored
+		procMsg(procEventExit, 4242, 4242, 1<<8, 17),
+		procMsg(procEventExec, self, self),
+	}}
+	c := New(nil, nil)
+	c.procLive.Store(true)
+	out := make(chan models.RawEvent, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.consumeProcEvents(ctx, src, out)
+	}()
+
+	spawn := <-out
+	if spawn.ActionType != models.ActionProcSpawn || spawn.PID != 4242 || spawn.PPID != 1 {
+		t.Fatalf("unexpected spawn event: %+v", spawn)
+	}
+	exit := <-out
+	if exit.ActionType != models.ActionProcExit || exit.PID != 4242 || exit.ExitCode != 1 || exit.ExitSignal != 0 {
+		t.Fatalf("unexpected exit event: %+v", exit)
+	}
+	if _, err := os.Stat("/proc/self/cmdline"); err == nil {
+		exec := <-out
+		if exec.ActionType != models.ActionExec || exec.PID != int(self) || len(exec.ExecArgs) == 0 {
+			t.Fatalf("unexpected exec event: %+v", exec)
+		}
+	}
+	cancel()
+	<-done
+	if c.procLive.Load() {
+		t.Fatal("expected procLive to be cleared after consumer exits")
+	}
+}
+
+func TestConsumeProcEvents_StopsWithoutConsumer(t *testing.T) {
+	src := &fakeProcSource{msgs: [][]byte{procMsg(procEventFork, 1, 1, 4242, 4242)}}
+	c := New(nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.consumeProcEvents(ctx, src, make(chan models.RawEvent))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the consumer to return once cancelled, blocked sending instead")
+	}
+}
+
+func TestWaitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status    uint32
+		code, sig int
+	}{
+		{0, 0, 0},
+		{2 << 8, 2, 0},
+		{9, -1, 9},
+		{0x80 | 11, -1, 11}, // core dumped
+	} {
+		if code, sig := waitStatus(tc.status); code != tc.code || sig != tc.sig {
+			t.Errorf("waitStatus(%#x) = (%d, %d), want (%d, %d)", tc.status, code, sig, tc.code, tc.sig)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicks is USER_HZ, which is 100 on every mainstream Linux build.
+const clockTicks = 100
+
+// procInfo is what the scanner learns about one process from procfs.
+type procInfo struct {
+	PID       int
+	PPID      int
+	Comm      string
+	Argv      []string
+	Exe       string
+	CWD       string
+	UID       int
+	StartTime time.Time
+}
+
+// procFS reads process state from a procfs mount. Tests point root at a
+// fake directory tree.
+type procFS struct {
+	root string
+
+	bootOnce sync.Once
+	bootTime time.Time
+
+	portsOnce   sync.Once
+	ephemeralLo int
+	ephemeralHi int
+}
+
+func newProcFS(root string) *procFS { return &procFS{root: root} }
+
+func (p *procFS) path(pid int, name string) string {
+	return filepath.Join(p.root, strconv.Itoa(pid), name)
+}
+
+func (p *procFS) pids() []int {
+	ents, err := os.ReadDir(p.root)
+	if err != nil {
+		return nil
+	}
+	pids := make([]int, 0, len(ents))
+	for _, ent := range ents {
+		if pid, err := strconv.Atoi(ent.Name()); err == nil && pid > 0 {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// read gathers everything the scanner needs for pid. It fails only when the
+// process is gone; fields the caller may not access (cwd of another user's
+// process) are left empty.
+func (p *procFS) read(pid int) (procInfo, bool) {
+	ppid, start, ok := p.stat(pid)
+	if !ok {
+		return procInfo{}, false
+	}
+	return procInfo{
+		PID:       pid,
+		PPID:      ppid,
+		Comm:      p.comm(pid),
+		Argv:      p.argv(pid),
+		Exe:       p.exe(pid),
+		CWD:       p.cwd(pid),
+		UID:       p.uid(pid),
+		StartTime: start,
+	}, true
+}
+
+func (p *procFS) comm(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	b, err := os.ReadFile(p.path(pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (p *procFS) argv(pid int) []string {
+	b, err := os.ReadFile(p.path(pid, "cmdline"))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+}
+
+func (p *procFS) exe(pid int) string {
+	exe, err := os.Readlink(p.path(pid, "exe"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(exe, " (deleted)")
+}
+
+func (p *procFS) cwd(pid int) string {
+	dir, err := os.Readlink(p.path(pid, "cwd"))
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// uid returns the real UID from the status file, or -1 if unknown.
+func (p *procFS) uid(pid int) int {
+	b, err := os.ReadFile(p.path(pid, "status"))
+	if err != nil {
+		return -1
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, "Uid:"); ok {
+			fields := strings.Fields(v)
+			if len(fields) > 0 {
+				if uid, err := strconv.Atoi(fields[0]); err == nil {
+					return uid
+				}
+			}
+			break
+		}
+	}
+	return -1
+}
+
+// stat reads the parent PID and start time from the stat file.
+func (p *procFS) stat(pid int) (int, time.Time, bool) {
+	if pid <= 0 {
+		return 0, time.Time{}, false
+	}
+	b, err := os.ReadFile(p.path(pid, "stat"))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	// comm is parenthesised and may contain spaces; fields resume after ')'.
+	s := string(b)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return 0, time.Time{}, false
+	}
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 20 {
+		return 0, time.Time{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return ppid, time.Time{}, true
+	}
+	return ppid, p.startTime(ticks), true
+}
+
+func (p *procFS) startTime(ticks int64) time.Time {
+	p.bootOnce.Do(func() {
+		b, err := os.ReadFile(filepath.Join(p.root, "stat"))
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if v, ok := strings.CutPrefix(line, "btime "); ok {
+				if sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+					p.bootTime = time.Unix(sec, 0)
+				}
+				return
+			}
+		}
+	})
+	if p.bootTime.IsZero() {
+		return time.Time{}
+	}
+	return p.bootTime.Add(time.Duration(ticks) * time.Second / clockTicks)
+}
+
+// ephemeralPorts returns the local port range the kernel hands out to
+// unbound sockets, defaulting to Linux's stock 32768-60999.
+func (p *procFS) ephemeralPorts() (int, int) {
+	p.portsOnce.Do(func() {
+		p.ephemeralLo, p.ephemeralHi = 32768, 60999
+		b, err := os.ReadFile(filepath.Join(p.root, "sys", "net", "ipv4", "ip_local_port_range"))
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 {
+			return
+		}
+		lo, err1 := strconv.Atoi(fields[0])
+		hi, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil && lo > 0 && lo <= hi {
+			p.ephemeralLo, p.ephemeralHi = lo, hi
+		}
+	})
+	return p.ephemeralLo, p.ephemeralHi
+}
+
+// commandLine renders argv for display, quoting arguments that would
+// otherwise be ambiguous once joined with spaces.
+func commandLine(argv []string) string {
+	parts := make([]string, len(argv))
+	for i, a := range argv {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`|&;<>()*?[]{}~#") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		parts[i] = a
+	}
+	return strings.Join(parts, " ")
+}
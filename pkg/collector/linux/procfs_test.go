@@ -0,0 +1,145 @@
+package linux
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+const fakeBootTime = 1700000000
+
+type fakeProc struct {
+	pid, ppid int
+	comm      string
+	argv      []string
+	cwd       string
+	uid       int
+	ticks     int64
+}
+
+func newFakeProcFS(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	stat := "cpu  1 2 3\nbtime " + strconv.Itoa(fakeBootTime) + "\nprocesses 10\n"
+	if err := os.WriteFile(filepath.Join(root, "stat"), []byte(stat), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func addFakeProc(t *testing.T, root string, p fakeProc) {
+	t.Helper()
+	dir := filepath.Join(root, strconv.Itoa(p.pid))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	stat := strconv.Itoa(p.pid) + " (" + p.comm + ") S " + strconv.Itoa(p.ppid) + " 1 1 0 -1 4194304 0 0 0 0 0 0 0 0 20 0 1 0 " + strconv.FormatInt(p.ticks, 10) + " 0 0\n"
+	cmdline := ""
+	for _, a := range p.argv {
+		cmdline += a + "\x00"
+	}
+	status := "Name:\t" + p.comm + "\nUid:\t" + strconv.Itoa(p.uid) + "\t" + strconv.Itoa(p.uid) + "\t0\t0\n"
+	files := map[string]string{"stat": stat, "cmdline": cmdline, "comm": p.comm + "\n", "status": status}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.cwd != "" {
+		if err := os.Symlink(p.cwd, filepath.Join(dir, "cwd")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcFS_Read(t *testing.T) {
+	root := newFakeProcFS(t)
+	addFakeProc(t, root, fakeProc{pid: 42, ppid: 7, comm: "tmux: server", argv: []string{"git", "commit", "-m", "fix the bug"}, cwd: "/work/repo", uid: 1000, ticks: 250})
+
+	info, ok := newProcFS(root).read(42)
+	if !ok {
+		t.Fatal("expected process to be readable")
+	}
+	if info.PPID != 7 || info.Comm != "tmux: server" || info.CWD != "/work/repo" || info.UID != 1000 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if !reflect.DeepEqual(info.Argv, []string{"git", "commit", "-m", "fix the bug"}) {
+		t.Fatalf("unexpected argv: %q", info.Argv)
+	}
+	if want := time.Unix(fakeBootTime, 0).Add(2500 * time.Millisecond); !info.StartTime.Equal(want) {
+		t.Fatalf("start time got %v, want %v", info.StartTime, want)
+	}
+	if _, ok := newProcFS(root).read(43); ok {
+		t.Fatal("expected missing process to be unreadable")
+	}
+}
+
+func TestCommandLine_QuotesAmbiguousArgs(t *testing.T) {
+	got := commandLine([]string{"git", "commit", "-m", "it's done", ""})
+	if want := `git commit -m 'it'\''s done' ''`; got != want {
+		t.Fatalf("commandLine got %q, want %q", got, want)
+	}
+}
+
+func TestScanProc_ForgetsExitedAndDetectsReuse(t *testing.T) {
+	root := newFakeProcFS(t)
+	addFakeProc(t, root, fakeProc{pid: 10, ppid: 1, comm: "codex", argv: []string{"codex"}, cwd: "/work", uid: 1000, ticks: 100})
+	addFakeProc(t, root, fakeProc{pid: 11, ppid: 10, comm: "kworker", ticks: 100})
+	c := New(nil, nil)
+	c.proc = newProcFS(root)
+	out := make(chan models.RawEvent, 16)
+
+	c.scanProc(context.Background(), out)
+	got := drain(out)
+	if len(got) != 3 {
+		t.Fatalf("expected spawn+exec for codex and spawn for kernel thread, got %+v", got)
+	}
+	exec := got[1]
+	if exec.ActionType != models.ActionExec || exec.CWD != "/work" || exec.UID != 1000 || !reflect.DeepEqual(exec.ExecArgs, []string{"codex"}) || exec.StartTime.IsZero() {
+		t.Fatalf("unexpected exec event: %+v", exec)
+	}
+
+	c.scanProc(context.Background(), out)
+	if got := drain(out); len(got) != 0 {
+		t.Fatalf("expected no events for unchanged processes, got %+v", got)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "11")); err != nil {
+		t.Fatal(err)
+	}
+	c.scanProc(context.Background(), out)
+	if _, ok := c.seenProc[11]; ok {
+		t.Fatal("expected exited process to be forgotten")
+	}
+	if got := drain(out); len(got) != 1 || got[0].ActionType != models.ActionProcExit || got[0].PID != 11 || got[0].ExitCode != -1 {
+		t.Fatalf("expected an exit with unknown status for the vanished process, got %+v", got)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "10")); err != nil {
+		t.Fatal(err)
+	}
+	addFakeProc(t, root, fakeProc{pid: 10, ppid: 1, comm: "sh", argv: []string{"sh", "-c", "make test"}, ticks: 900})
+	c.scanProc(context.Background(), out)
+	got = drain(out)
+	if len(got) != 3 || got[0].ActionType != models.ActionProcExit || got[2].Target != "sh -c 'make test'" {
+		t.Fatalf("expected old incarnation to exit and reused pid to be reported again, got %+v", got)
+	}
+}
+
+func drain(ch chan models.RawEvent) []models.RawEvent {
+	var evs []models.RawEvent
+	for {
+		select {
+		case ev := <-ch:
+			evs = append(evs, ev)
+		default:
+			return evs
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readDedupWindow collapses a process opening the same file over and over,
+// as ssh and credential helpers do, into one read.
+const readDedupWindow = 10 * time.Second
+
+// WatchReads records reads of the files patterns name; see
+// config.Config.Collection.SensitivePaths. Call it before Start.
+func (c *collector) WatchReads(patterns []string) {
+	c.readPatterns = patterns
+}
+
+// markReads marks every sensitive path that currently exists for open
+// events. Marks go away with the file, so this runs again whenever the
+// roots are refreshed.
+func (c *collector) markReads(src fileEventSource) {
+	if len(c.readPatterns) == 0 {
+		return
+	}
+	var marked []string
+	for _, p := range expandSensitive(c.readPatterns, c.currentRoots(), homeDirs()) {
+		if src.WatchOpen(p) == nil {
+			marked = append(marked, p)
+		}
+	}
+	c.rootsMu.Lock()
+	c.readPaths = marked
+	c.rootsMu.Unlock()
+}
+
+// isSensitive reports whether path is a marked file or directly inside a
+// marked directory.
+func (c *collector) isSensitive(path string) bool {
+	c.rootsMu.Lock()
+	defer c.rootsMu.Unlock()
+	for _, p := range c.readPaths {
+		if path == p || filepath.Dir(path) == p {
+			return true
+		}
+	}
+	return false
+}
+
+// seenRead reports whether pid already read path within readDedupWindow,
+// and remembers this read otherwise.
+func (c *collector) seenRead(pid int, path string, now time.Time) bool {
+	key := path + "|" + strconv.Itoa(pid)
+	if last, ok := c.lastRead[key]; ok && now.Sub(last) < readDedupWindow {
+		return true
+	}
+	if len(c.lastRead) > 4096 {
+		c.lastRead = map[string]time.Time{}
+	}
+	c.lastRead[key] = now
+	return false
+}
+
+// expandSensitive turns patterns into the existing paths they match: "~/"
+// is tried under every home, relative patterns under every root.
+func expandSensitive(patterns, roots, homes []string) []string {
+	var out []string
+	seen := map[string]struct{}{}
+	for _, pat := range patterns {
+		var candidates []string
+		switch {
+		case strings.HasPrefix(pat, "~/"):
+			for _, h := range homes {
+				candidates = append(candidates, filepath.Join(h, pat[2:]))
+			}
+		case filepath.IsAbs(pat):
+			candidates = []string{pat}
+		default:
+			for _, r := range roots {
+				candidates = append(candidates, filepath.Join(r, pat))
+			}
+		}
+		for _, cand := range candidates {
+			matches, _ := filepath.Glob(cand)
+			for _, m := range matches {
+				if _, ok := seen[m]; !ok {
+					seen[m] = struct{}{}
+					out = append(out, m)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// homeDirs returns the daemon user's home and, since the daemon usually
+// runs as root on behalf of someone else, every directory in /home.
+func homeDirs() []string {
+	var homes []string
+	if h, err := os.UserHomeDir(); err == nil {
+		homes = append(homes, h)
+	}
+	entries, _ := os.ReadDir("/home")
+	for _, e := range entries {
+		if e.IsDir() {
+			homes = append(homes, filepath.Join("/home", e.Name()))
+		}
+	}
+	return homes
+}
@@ -0,0 +1,65 @@
+package linux
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func TestExpandSensitive(t *testing.T) {
+	tmp := t.TempDir()
+	home, work := filepath.Join(tmp, "home"), filepath.Join(tmp, "work")
+	for _, p := range []string{"home/.ssh/id_ed25519", "home/.aws/credentials", "home/.mozilla/firefox/abc.default/cookies.sqlite", "work/.env", "work/.env.local"} {
+		writeFile(t, filepath.Join(tmp, p), "secret")
+	}
+	got := expandSensitive([]string{"~/.ssh", "~/.aws/credentials", "~/.kube/config", "~/.mozilla/firefox/*/cookies.sqlite", ".env", ".env.*"}, []string{work}, []string{home, home})
+	want := []string{
+		filepath.Join(home, ".ssh"),
+		filepath.Join(home, ".aws/credentials"),
+		filepath.Join(home, ".mozilla/firefox/abc.default/cookies.sqlite"),
+		filepath.Join(work, ".env"),
+		filepath.Join(work, ".env.local"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expandSensitive got %q, want %q", got, want)
+	}
+}
+
+func TestConsumeFileEvents_ReportsSensitiveReadsOnce(t *testing.T) {
+	tmp := t.TempDir()
+	ssh := filepath.Join(tmp, ".ssh")
+	writeFile(t, filepath.Join(ssh, "id_ed25519"), "key")
+	if err := os.MkdirAll(filepath.Join(tmp, "docs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	src := &fakeFileSource{
+		msgs: [][]byte{
+			fanMsg(fanOpen, 5001, "ssh", "id_ed25519"),
+			fanMsg(fanOpen, 5001, "ssh", "id_ed25519"),
+			fanMsg(fanOpen, 5002, "docs", "readme.md"),
+			fanMsg(fanOpen, 5003, "ssh", "id_ed25519"),
+		},
+		dirs: map[string]string{"ssh": ssh, "docs": filepath.Join(tmp, "docs")},
+	}
+	c := New([]string{filepath.Join(tmp, "work")}, nil)
+	c.WatchReads([]string{ssh})
+	c.markReads(src)
+	if !reflect.DeepEqual(src.opens, []string{ssh}) {
+		t.Fatalf("expected the ssh directory to be marked, got %q", src.opens)
+	}
+	out := make(chan models.RawEvent, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.consumeFileEvents(ctx, src, out)
+
+	for _, pid := range []int{5001, 5003} {
+		ev := <-out
+		if ev.ActionType != models.ActionFileRead || ev.PID != pid || ev.Target != filepath.Join(ssh, "id_ed25519") {
+			t.Fatalf("expected a read by %d, got %+v", pid, ev)
+		}
+	}
+}
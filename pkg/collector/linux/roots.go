@@ -0,0 +1,169 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// rootSink is the file backend's side of watch-root changes.
+type rootSink interface {
+	watchRoot(root string)
+	unwatchRoot(root string)
+}
+
+type fsnotifySink struct{ w *fsnotify.Watcher }
+
+func (s fsnotifySink) watchRoot(root string) { _ = addRecursive(s.w, root) }
+
+func (s fsnotifySink) unwatchRoot(root string) {
+	for _, p := range s.w.WatchList() {
+		if within(p, root) {
+			_ = s.w.Remove(p)
+		}
+	}
+}
+
+// fanotifySink only needs to mark new filesystems; consumeFileEvents filters
+// by currentRoots, so dropping a root takes effect without unmarking.
+type fanotifySink struct{ src fileEventSource }
+
+func (s fanotifySink) watchRoot(root string) { _ = s.src.Watch(root) }
+
+func (s fanotifySink) unwatchRoot(string) {}
+
+func (c *collector) currentRoots() []string {
+	c.rootsMu.Lock()
+	defer c.rootsMu.Unlock()
+	return append([]string(nil), c.roots...)
+}
+
+// refreshRoots recomputes the effective roots from the configured roots and
+// the workspaces of live agent processes, then applies the difference.
+func (c *collector) refreshRoots(sink rootSink, agentRoots map[int][]string) {
+	want := append([]string(nil), c.staticRoots...)
+	for _, roots := range agentRoots {
+		want = append(want, roots...)
+	}
+	want = minimalRoots(want)
+
+	c.rootsMu.Lock()
+	old := c.roots
+	c.roots = want
+	c.rootsMu.Unlock()
+
+	for _, r := range old {
+		if !containsRoot(want, r) {
+			sink.unwatchRoot(r)
+		}
+	}
+	for _, r := range want {
+		if !containsRoot(old, r) {
+			sink.watchRoot(r)
+		}
+	}
+}
+
+// scanAgentRoots maps each running agent process to its workspace roots.
+func (c *collector) scanAgentRoots() map[int][]string {
+	res := map[int][]string{}
+	if c.isAgent == nil {
+		return res
+	}
+	self := os.Getpid()
+	for _, pid := range c.proc.pids() {
+		if pid == self || !c.isAgent(c.proc.comm(pid), c.proc.argv(pid), c.proc.exe(pid)) {
+			continue
+		}
+		cwd := c.proc.cwd(pid)
+		if ci, ok := c.container(pid); ok {
+			cwd = ci.hostPath(cwd)
+		}
+		if cwd == "" {
+			continue
+		}
+		if roots := workspaceRoots(cwd); len(roots) > 0 {
+			res[pid] = roots
+		}
+	}
+	return res
+}
+
+// workspaceRoots returns cwd and its enclosing git root. Roots that would
+// mean watching the whole disk or home directory are refused.
+func workspaceRoots(cwd string) []string {
+	cwd = filepath.Clean(cwd)
+	if !watchableRoot(cwd) {
+		return nil
+	}
+	roots := []string{cwd}
+	if root := gitRoot(cwd); root != "" && root != cwd && watchableRoot(root) {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+func watchableRoot(dir string) bool {
+	if dir == "" || dir == string(filepath.Separator) {
+		return false
+	}
+	if home, err := os.UserHomeDir(); err == nil && filepath.Clean(home) == dir {
+		return false
+	}
+	st, err := os.Stat(dir)
+	return err == nil && st.IsDir()
+}
+
+func gitRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// minimalRoots drops duplicates and roots nested inside another root.
+func minimalRoots(roots []string) []string {
+	cleaned := make([]string, 0, len(roots))
+	for _, r := range roots {
+		if r != "" {
+			cleaned = append(cleaned, filepath.Clean(r))
+		}
+	}
+	sort.Strings(cleaned)
+	out := make([]string, 0, len(cleaned))
+	for _, r := range cleaned {
+		nested := false
+		for _, kept := range out {
+			if within(r, kept) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func within(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func containsRoot(roots []string, r string) bool {
+	for _, v := range roots {
+		if v == r {
+			return true
+		}
+	}
+	return false
+}
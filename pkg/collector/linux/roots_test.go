@@ -0,0 +1,67 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type recordingSink struct {
+	added, removed []string
+}
+
+func (s *recordingSink) watchRoot(root string)   { s.added = append(s.added, root) }
+func (s *recordingSink) unwatchRoot(root string) { s.removed = append(s.removed, root) }
+
+func TestMinimalRoots(t *testing.T) {
+	got := minimalRoots([]string{"/a/b/c", "/a/b-c", "/a/b", "/x/", "/a/b"})
+	want := []string{"/a/b", "/a/b-c", "/x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("minimalRoots got %v, want %v", got, want)
+	}
+}
+
+func TestWorkspaceRoots_IncludesGitRoot(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(repo, "pkg", "api")
+	if err := os.MkdirAll(sub, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	got := workspaceRoots(sub)
+	want := []string{sub, repo}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("workspaceRoots got %v, want %v", got, want)
+	}
+	if roots := workspaceRoots("/"); roots != nil {
+		t.Fatalf("expected filesystem root to be refused, got %v", roots)
+	}
+}
+
+func TestRefreshRoots_TracksAgentLifetime(t *testing.T) {
+	static := t.TempDir()
+	agentRepo := t.TempDir()
+	c := New([]string{static}, nil)
+	sink := &recordingSink{}
+
+	c.refreshRoots(sink, map[int][]string{42: {agentRepo, filepath.Join(agentRepo, "src")}})
+	want := minimalRoots([]string{static, agentRepo})
+	if !reflect.DeepEqual(c.currentRoots(), want) {
+		t.Fatalf("roots got %v, want %v", c.currentRoots(), want)
+	}
+	if len(sink.added) != 2 || len(sink.removed) != 0 {
+		t.Fatalf("unexpected sink calls added=%v removed=%v", sink.added, sink.removed)
+	}
+
+	sink.added, sink.removed = nil, nil
+	c.refreshRoots(sink, map[int][]string{})
+	if !reflect.DeepEqual(c.currentRoots(), []string{static}) {
+		t.Fatalf("expected only static root after agent exit, got %v", c.currentRoots())
+	}
+	if !reflect.DeepEqual(sink.removed, []string{agentRepo}) || len(sink.added) != 0 {
+		t.Fatalf("unexpected sink calls added=%v removed=%v", sink.added, sink.removed)
+	}
+}
@@ -0,0 +1,120 @@
+package linux
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// Constants from <linux/sock_diag.h>, <linux/inet_diag.h> and <linux/tcp.h>.
+const (
+	sockDiagByFamily    = 20
+	nlmsgError          = 0x2
+	nlmFRequest         = 0x1
+	nlmFDump            = 0x300
+	inetDiagInfo        = 2
+	inetDiagReqLen      = 56
+	inetDiagMsgLen      = 72
+	inetDiagInodeOff    = 68
+	tcpInfoBytesAcked   = 120
+	tcpInfoBytesRecv    = 128
+	sockDiagRecvBuffer  = 1 << 16
+	ipprotoTCP          = 6
+	sockDiagAllStates   = 0xffffffff
+	rtattrHdrLen        = 4
+	tcpInfoMinCountered = tcpInfoBytesRecv + 8
+)
+
+// tcpCounters are the cumulative payload byte counts of one TCP socket.
+type tcpCounters struct {
+	sent, recv int64
+}
+
+// sockDiagSource dumps tcp_info counters for every TCP socket, keyed by
+// socket inode as it appears in /proc/net/tcp. Tests substitute a fake.
+type sockDiagSource interface {
+	TCPCounters() (map[string]tcpCounters, error)
+	Close() error
+}
+
+// inetDiagRequest builds a SOCK_DIAG_BY_FAMILY dump request for TCP sockets
+// of one address family, asking for INET_DIAG_INFO (struct tcp_info).
+func inetDiagRequest(family uint8, seq uint32) []byte {
+	buf := make([]byte, nlmsgHdrLen+inetDiagReqLen)
+	ne := binary.NativeEndian
+	ne.PutUint32(buf[0:4], uint32(len(buf)))
+	ne.PutUint16(buf[4:6], sockDiagByFamily)
+	ne.PutUint16(buf[6:8], nlmFRequest|nlmFDump)
+	ne.PutUint32(buf[8:12], seq)
+	req := buf[nlmsgHdrLen:]
+	req[0] = family
+	req[1] = ipprotoTCP
+	req[2] = 1 << (inetDiagInfo - 1)
+	ne.PutUint32(req[4:8], sockDiagAllStates)
+	return buf
+}
+
+// parseInetDiagMessages adds the counters carried in one dump datagram to
+// into. It reports done once NLMSG_DONE or NLMSG_ERROR is seen.
+func parseInetDiagMessages(buf []byte, into map[string]tcpCounters) (done bool) {
+	ne := binary.NativeEndian
+	for len(buf) >= nlmsgHdrLen {
+		msgLen := int(ne.Uint32(buf[0:4]))
+		if msgLen < nlmsgHdrLen || msgLen > len(buf) {
+			break
+		}
+		switch ne.Uint16(buf[4:6]) {
+		case nlmsgDone, nlmsgError:
+			return true
+		case sockDiagByFamily:
+			if inode, c, ok := parseInetDiagMsg(buf[nlmsgHdrLen:msgLen]); ok {
+				into[inode] = c
+			}
+		}
+		next := (msgLen + 3) &^ 3
+		if next > len(buf) {
+			break
+		}
+		buf = buf[next:]
+	}
+	return false
+}
+
+func parseInetDiagMsg(msg []byte) (string, tcpCounters, bool) {
+	if len(msg) < inetDiagMsgLen {
+		return "", tcpCounters{}, false
+	}
+	ne := binary.NativeEndian
+	inode := ne.Uint32(msg[inetDiagInodeOff:])
+	if inode == 0 {
+		return "", tcpCounters{}, false
+	}
+	attrs := msg[inetDiagMsgLen:]
+	for len(attrs) >= rtattrHdrLen {
+		attrLen := int(ne.Uint16(attrs[0:2]))
+		if attrLen < rtattrHdrLen || attrLen > len(attrs) {
+			break
+		}
+		if ne.Uint16(attrs[2:4]) == inetDiagInfo {
+			info := attrs[rtattrHdrLen:attrLen]
+			// Kernels before 4.1 have no byte counters in tcp_info.
+			if len(info) < tcpInfoMinCountered {
+				return "", tcpCounters{}, false
+			}
+			c := tcpCounters{
+				sent: int64(ne.Uint64(info[tcpInfoBytesAcked:])),
+				recv: int64(ne.Uint64(info[tcpInfoBytesRecv:])),
+			}
+			// bytes_acked counts the acknowledged SYN as well.
+			if c.sent > 0 {
+				c.sent--
+			}
+			return strconv.FormatUint(uint64(inode), 10), c, true
+		}
+		next := (attrLen + 3) &^ 3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	return "", tcpCounters{}, false
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package linux
+
+import "errors"
+
+func dialSockDiag() (sockDiagSource, error) {
+	return nil, errors.New("sock_diag requires linux")
+}
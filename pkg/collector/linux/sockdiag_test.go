@@ -0,0 +1,56 @@
+package linux
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func diagMsg(inode uint32, sent, recv uint64) []byte {
+	ne := binary.NativeEndian
+	info := make([]byte, 232)
+	ne.PutUint64(info[tcpInfoBytesAcked:], sent)
+	ne.PutUint64(info[tcpInfoBytesRecv:], recv)
+	attr := make([]byte, rtattrHdrLen+len(info))
+	ne.PutUint16(attr[0:2], uint16(len(attr)))
+	ne.PutUint16(attr[2:4], inetDiagInfo)
+	copy(attr[rtattrHdrLen:], info)
+	body := make([]byte, inetDiagMsgLen)
+	ne.PutUint32(body[inetDiagInodeOff:], inode)
+	body = append(body, attr...)
+	hdr := make([]byte, nlmsgHdrLen)
+	ne.PutUint32(hdr[0:4], uint32(nlmsgHdrLen+len(body)))
+	ne.PutUint16(hdr[4:6], sockDiagByFamily)
+	return append(hdr, body...)
+}
+
+func TestParseInetDiagMessages(t *testing.T) {
+	done := make([]byte, nlmsgHdrLen+4)
+	binary.NativeEndian.PutUint32(done[0:4], uint32(len(done)))
+	binary.NativeEndian.PutUint16(done[4:6], nlmsgDone)
+
+	res := map[string]tcpCounters{}
+	buf := append(diagMsg(4242, 1_000_001, 500), diagMsg(0, 9, 9)...)
+	if parseInetDiagMessages(buf, res) {
+		t.Fatal("expected dump to continue without NLMSG_DONE")
+	}
+	if !parseInetDiagMessages(done, res) {
+		t.Fatal("expected NLMSG_DONE to end the dump")
+	}
+	if len(res) != 1 || res["4242"] != (tcpCounters{sent: 1_000_000, recv: 500}) {
+		t.Fatalf("unexpected counters: %+v", res)
+	}
+}
+
+func TestInetDiagRequest(t *testing.T) {
+	req := inetDiagRequest(10, 7)
+	ne := binary.NativeEndian
+	if len(req) != nlmsgHdrLen+inetDiagReqLen || ne.Uint32(req[0:4]) != uint32(len(req)) {
+		t.Fatalf("bad length in %x", req)
+	}
+	if ne.Uint16(req[4:6]) != sockDiagByFamily || ne.Uint16(req[6:8]) != nlmFRequest|nlmFDump || ne.Uint32(req[8:12]) != 7 {
+		t.Fatalf("bad header in %x", req[:nlmsgHdrLen])
+	}
+	if body := req[nlmsgHdrLen:]; body[0] != 10 || body[1] != ipprotoTCP || body[2] != 1<<(inetDiagInfo-1) {
+		t.Fatalf("bad request body %x", body)
+	}
+}
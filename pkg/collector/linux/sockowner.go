@@ -0,0 +1,82 @@
+package linux
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SocketOwner names the process holding the local socket bound to addr,
+// for network "tcp" or "udp". It reads /proc, so it finds nothing on other
+// platforms or for sockets in another network namespace.
+func SocketOwner(network string, addr net.Addr) (pid int, processName string) {
+	return newProcFS("/proc").socketOwner(network, addr)
+}
+
+func (p *procFS) socketOwner(network string, addr net.Addr) (int, string) {
+	host, port, ok := splitAddr(addr)
+	if !ok {
+		return 0, ""
+	}
+	inode := ""
+	for _, name := range []string{network, network + "6"} {
+		if inode = p.socketInode(filepath.Join(p.root, "net", name), host, port); inode != "" {
+			break
+		}
+	}
+	if inode == "" {
+		return 0, ""
+	}
+	want := "socket:[" + inode + "]"
+	for _, pid := range p.pids() {
+		fdDir := p.path(pid, "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && link == want {
+				return pid, p.comm(pid)
+			}
+		}
+	}
+	return 0, ""
+}
+
+// socketInode finds the row of a /proc/net table whose local address is
+// host:port. IPv4 sockets on a dual-stack socket show up as ::ffff:a.b.c.d.
+func (p *procFS) socketInode(path string, host net.IP, port int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Scan()
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		ip, lport, ok := parseHexAddr(fields[1])
+		if !ok || lport != port {
+			continue
+		}
+		if local := net.ParseIP(ip); local != nil && (local.Equal(host) || local.IsUnspecified()) {
+			return fields[9]
+		}
+	}
+	return ""
+}
+
+func splitAddr(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port, true
+	case *net.TCPAddr:
+		return a.IP, a.Port, true
+	}
+	return nil, 0, false
+}
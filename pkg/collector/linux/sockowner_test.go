@@ -0,0 +1,36 @@
+package linux
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSocketOwner(t *testing.T) {
+	root := newFakeProcFS(t)
+	addFakeProc(t, root, fakeProc{pid: 77, ppid: 1, comm: "node", ticks: 100})
+	if err := os.MkdirAll(filepath.Join(root, "77", "fd"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("socket:[5150]", filepath.Join(root, "77", "fd", "9")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "net"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	udp := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n" +
+		"  1: 0100007F:D431 9900007F:0035 01 00000000:00000000 00:00000000 00000000  1000        0 5150 2 0 0\n"
+	if err := os.WriteFile(filepath.Join(root, "net", "udp"), []byte(udp), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := newProcFS(root)
+
+	pid, name := p.socketOwner("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0xD431})
+	if pid != 77 || name != "node" {
+		t.Fatalf("socketOwner got (%d, %q)", pid, name)
+	}
+	if pid, _ := p.socketOwner("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}); pid != 0 {
+		t.Fatalf("expected no owner for unknown port, got %d", pid)
+	}
+}
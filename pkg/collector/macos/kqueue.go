@@ -1,3 +1,5 @@
+//go:build darwin
+
 package macos
 
 import (
@@ -15,23 +17,26 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 
+	"github.com/kai-ai/kai/pkg/collector/rename"
 	"github.com/kai-ai/kai/pkg/models"
 )
 
 type collector struct {
-	mu       sync.Mutex
-	seenProc map[int]struct{}
-	seenConn map[string]time.Time
-	watched  map[int]struct{}
-	kq       int
+	mu         sync.Mutex
+	seenProc   map[int]struct{}
+	seenConn   map[string]time.Time
+	watched    map[int]struct{}
+	kq         int
+	watchRoots []string
 }
 
-func New() *collector {
+func New(watchRoots []string) *collector {
 	return &collector{
-		seenProc: map[int]struct{}{},
-		seenConn: map[string]time.Time{},
-		watched:  map[int]struct{}{},
-		kq:       -1,
+		seenProc:   map[int]struct{}{},
+		seenConn:   map[string]time.Time{},
+		watched:    map[int]struct{}{},
+		kq:         -1,
+		watchRoots: watchRoots,
 	}
 }
 
@@ -39,8 +44,14 @@ func (c *collector) Start(ctx context.Context, out chan<- models.RawEvent) error
 	watcher, err := fsnotify.NewWatcher()
 	if err == nil {
 		defer watcher.Close()
-		if cwd, e := os.Getwd(); e == nil {
-			_ = addRecursive(watcher, cwd)
+		roots := c.watchRoots
+		if len(roots) == 0 {
+			if cwd, e := os.Getwd(); e == nil {
+				roots = []string{cwd}
+			}
+		}
+		for _, root := range roots {
+			_ = addRecursive(watcher, root)
 		}
 		go c.consumeFS(ctx, watcher, out)
 	}
@@ -107,12 +118,12 @@ func (c *collector) runKqueue(ctx context.Context, out chan<- models.RawEvent) {
 				if child > 0 {
 					c.registerPID(child)
 					proc, args := procInfo(ctx, child)
-					out <- models.RawEvent{Timestamp: time.Now(), PID: child, PPID: pid, ProcessName: proc, ActionType: models.ActionProcSpawn, Target: args, Platform: "macos"}
+					out <- models.RawEvent{Timestamp: time.Now(), PID: child, PPID: pid, ProcessName: proc, ActionType: models.ActionProcSpawn, Target: args, UID: -1, Platform: "macos"}
 				}
 			}
 			if ev.Fflags&syscall.NOTE_EXEC != 0 {
 				proc, args := procInfo(ctx, pid)
-				out <- models.RawEvent{Timestamp: time.Now(), PID: pid, ProcessName: proc, ActionType: models.ActionExec, Target: args, Platform: "macos"}
+				out <- models.RawEvent{Timestamp: time.Now(), PID: pid, ProcessName: proc, ActionType: models.ActionExec, Target: args, UID: -1, Platform: "macos"}
 				c.registerPID(pid)
 			}
 			if ev.Fflags&syscall.NOTE_EXIT != 0 {
@@ -198,10 +209,21 @@ func procInfo(ctx context.Context, pid int) (string, string) {
 }
 
 func (c *collector) consumeFS(ctx context.Context, watcher *fsnotify.Watcher, out chan<- models.RawEvent) {
+	// fsnotify reports a rename as Rename on the old name followed by Create
+	// on the new one.
+	var renames rename.Pairer
+	var renameTimeout <-chan time.Time
+	emit := func(evs []models.RawEvent) {
+		for _, ev := range evs {
+			out <- ev
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-renameTimeout:
+			emit(renames.Flush())
 		case ev := <-watcher.Events:
 			if ev.Name == "" {
 				continue
@@ -210,13 +232,19 @@ func (c *collector) consumeFS(ctx context.Context, watcher *fsnotify.Watcher, ou
 				if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
 					_ = addRecursive(watcher, ev.Name)
 				}
-				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileCreate, Target: ev.Name, Platform: "macos"}
+				emit(renames.To(models.RawEvent{Timestamp: time.Now(), Target: ev.Name, UID: -1, Platform: "macos"}))
 			}
 			if ev.Op&fsnotify.Write == fsnotify.Write {
-				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileWrite, Target: ev.Name, Platform: "macos"}
+				emit(renames.Flush())
+				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileWrite, Target: ev.Name, UID: -1, Platform: "macos"}
+			}
+			if ev.Op&fsnotify.Remove == fsnotify.Remove {
+				emit(renames.Flush())
+				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileDelete, Target: ev.Name, UID: -1, Platform: "macos"}
 			}
-			if ev.Op&fsnotify.Remove == fsnotify.Remove || ev.Op&fsnotify.Rename == fsnotify.Rename {
-				out <- models.RawEvent{Timestamp: time.Now(), ActionType: models.ActionFileDelete, Target: ev.Name, Platform: "macos"}
+			if ev.Op&fsnotify.Rename == fsnotify.Rename {
+				emit(renames.From(models.RawEvent{Timestamp: time.Now(), Target: ev.Name, UID: -1, Platform: "macos"}))
+				renameTimeout = time.After(rename.Window)
 			}
 		case <-watcher.Errors:
 		}
@@ -269,9 +297,9 @@ func (c *collector) scanProc(ctx context.Context, out chan<- models.RawEvent) {
 			continue
 		}
 		c.seenProc[pid] = struct{}{}
-		out <- models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: ppid, ProcessName: proc, ActionType: models.ActionProcSpawn, Target: args, Platform: "macos"}
+		out <- models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: ppid, ProcessName: proc, ActionType: models.ActionProcSpawn, Target: args, UID: -1, Platform: "macos"}
 		if args != "" {
-			out <- models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: ppid, ProcessName: proc, ActionType: models.ActionExec, Target: args, Platform: "macos"}
+			out <- models.RawEvent{Timestamp: time.Now(), PID: pid, PPID: ppid, ProcessName: proc, ActionType: models.ActionExec, Target: args, UID: -1, Platform: "macos"}
 		}
 	}
 	_ = cmd.Wait()
@@ -327,6 +355,8 @@ func (c *collector) scanNetTCP(ctx context.Context, out chan<- models.RawEvent)
 				ProcessName: proc,
 				ActionType:  models.ActionNetConnect,
 				Target:      remote,
+				Protocol:    "tcp",
+				UID:         -1,
 				Platform:    "macos",
 			}
 		}
@@ -385,6 +415,8 @@ func (c *collector) scanNetUDP(ctx context.Context, out chan<- models.RawEvent)
 				ProcessName: proc,
 				ActionType:  models.ActionNetConnect,
 				Target:      remote,
+				Protocol:    "udp",
+				UID:         -1,
 				Platform:    "macos",
 			}
 		}
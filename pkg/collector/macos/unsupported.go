@@ -0,0 +1,20 @@
+//go:build !darwin
+
+package macos
+
+import (
+	"context"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// collector is a no-op stand-in so the package builds on non-darwin hosts;
+// collector.NewCollector only selects it when runtime.GOOS is "darwin".
+type collector struct{}
+
+func New(watchRoots []string) *collector { return &collector{} }
+
+func (c *collector) Start(ctx context.Context, out chan<- models.RawEvent) error {
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// A recording holds one JSON object per line. Lines without a Kind are
+// RawEvents; the others are inputs the engine gets from elsewhere than the
+// collector.
+const (
+	KindRoot = "root"
+	KindDNS  = "dns"
+)
+
+// Entry is one line of a recording; exactly one field is set.
+type Entry struct {
+	Event *models.RawEvent
+	Root  *RootEntry
+	DNS   *DNSEntry
+}
+
+// RootEntry is a process kai exec registered as the root of an agent.
+type RootEntry struct {
+	At    time.Time
+	PID   int
+	Agent models.AgentID
+}
+
+// DNSEntry is an answer seen by the DNS forwarder.
+type DNSEntry struct {
+	At          time.Time
+	IP          string
+	Name        string
+	TTL         time.Duration
+	PID         int
+	ProcessName string
+}
+
+func (e Entry) at() time.Time {
+	switch {
+	case e.Event != nil:
+		return e.Event.Timestamp
+	case e.Root != nil:
+		return e.Root.At
+	case e.DNS != nil:
+		return e.DNS.At
+	}
+	return time.Time{}
+}
+
+// Recorder passes events through from another Collector and writes each one
+// to w as a line of JSON, in the format Replay reads. Write adds the inputs
+// that do not come from the collector.
+type Recorder struct {
+	inner Collector
+	mu    sync.Mutex
+	enc   *json.Encoder
+}
+
+func NewRecorder(inner Collector, w io.Writer) *Recorder {
+	return &Recorder{inner: inner, enc: json.NewEncoder(w)}
+}
+
+// Write appends e to the recording.
+func (r *Recorder) Write(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case e.Event != nil:
+		_ = r.enc.Encode(e.Event)
+	case e.Root != nil:
+		_ = r.enc.Encode(struct {
+			Kind string
+			*RootEntry
+		}{KindRoot, e.Root})
+	case e.DNS != nil:
+		_ = r.enc.Encode(struct {
+			Kind string
+			*DNSEntry
+		}{KindDNS, e.DNS})
+	}
+}
+
+func (r *Recorder) Start(ctx context.Context, out chan<- models.RawEvent) error {
+	tap := make(chan models.RawEvent, cap(out))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	forward := func(ev models.RawEvent) {
+		r.Write(Entry{Event: &ev})
+		select {
+		case out <- ev:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-tap:
+				forward(ev)
+			case <-stop:
+				for {
+					select {
+					case ev := <-tap:
+						forward(ev)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	err := r.inner.Start(ctx, tap)
+	close(stop)
+	<-done
+	return err
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+type fixedCollector []models.RawEvent
+
+func (f fixedCollector) Start(ctx context.Context, out chan<- models.RawEvent) error {
+	for _, ev := range f {
+		out <- ev
+	}
+	return nil
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := []models.RawEvent{
+		{Timestamp: base, PID: 10, ProcessName: "claude", ActionType: models.ActionExec, Target: "git status", ExecArgs: []string{"git", "status"}, UID: 1000, StartTime: base.Add(-time.Second)},
+		{Timestamp: base.Add(20 * time.Millisecond), PID: 11, PPID: 10, ActionType: models.ActionFileWrite, Target: "/work/main.go"},
+		{Timestamp: base.Add(40 * time.Millisecond), PID: 10, ActionType: models.ActionNetClose, Target: "1.2.3.4:443", FlowID: "f1", BytesSent: 1200},
+	}
+	root := &RootEntry{At: base.Add(10 * time.Millisecond), PID: 10, Agent: models.AgentClaude}
+	answer := &DNSEntry{At: base.Add(30 * time.Millisecond), IP: "1.2.3.4", Name: "api.example.com", TTL: time.Minute, PID: 10, ProcessName: "claude"}
+	var buf bytes.Buffer
+	rec := NewRecorder(fixedCollector(want[:1]), &buf)
+	out := make(chan models.RawEvent, len(want))
+	if err := rec.Start(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	rec.Write(Entry{Root: root})
+	rec.Write(Entry{Event: &want[1]})
+	rec.Write(Entry{DNS: answer})
+	rec.Write(Entry{Event: &want[2]})
+	if len(out) != 1 {
+		t.Fatalf("recorder passed through %d events, want 1", len(out))
+	}
+	wantEntries := []Entry{{Event: &want[0]}, {Root: root}, {Event: &want[1]}, {DNS: answer}, {Event: &want[2]}}
+
+	for _, realtime := range []bool{false, true} {
+		var got []Entry
+		start := time.Now()
+		err := readEntries(context.Background(), bytes.NewReader(buf.Bytes()), realtime, func(e Entry) error {
+			got = append(got, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		elapsed := time.Since(start)
+		if realtime && elapsed < 40*time.Millisecond {
+			t.Fatalf("realtime replay took %v, want at least the recorded 40ms", elapsed)
+		}
+		if !reflect.DeepEqual(got, wantEntries) {
+			t.Fatalf("realtime=%v: replay mismatch\n got %+v\nwant %+v", realtime, got, wantEntries)
+		}
+	}
+
+	// Replay, as a collector, emits only the events.
+	path := filepath.Join(t.TempDir(), "rec.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	replayed := make(chan models.RawEvent, len(want))
+	if err := NewReplay(path, false).Start(context.Background(), replayed); err != nil {
+		t.Fatal(err)
+	}
+	close(replayed)
+	var got []models.RawEvent
+	for ev := range replayed {
+		got = append(got, ev)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("replay mismatch\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+// Package rename pairs the two halves of a file rename that file watchers
+// report separately: the old name going away and the new name appearing.
+package rename
+
+import (
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// Window is how long the old half of a rename waits for the new half. The
+// kernel reports both back to back, so anything slower is a move into or
+// out of the watched tree.
+const Window = 100 * time.Millisecond
+
+// Pairer holds at most one unpaired old name.
+type Pairer struct {
+	from *models.RawEvent
+}
+
+// From holds ev, the old name of a rename. Any event already held is
+// returned as a delete.
+func (p *Pairer) From(ev models.RawEvent) []models.RawEvent {
+	out := p.Flush()
+	p.from = &ev
+	return out
+}
+
+// To reports ev, a new name. Paired with the held old name from the same
+// process it becomes a FILE_RENAME; otherwise the file was moved in from
+// elsewhere and ev is a create.
+func (p *Pairer) To(ev models.RawEvent) []models.RawEvent {
+	from := p.from
+	if from != nil && from.PID == ev.PID && ev.Timestamp.Sub(from.Timestamp) <= Window {
+		p.from = nil
+		ev.ActionType = models.ActionFileRename
+		ev.OldPath = from.Target
+		return []models.RawEvent{ev}
+	}
+	out := p.Flush()
+	ev.ActionType = models.ActionFileCreate
+	return append(out, ev)
+}
+
+// Flush returns the held old name, if any, as a delete: the file was moved
+// out of the watched tree.
+func (p *Pairer) Flush() []models.RawEvent {
+	if p.from == nil {
+		return nil
+	}
+	ev := *p.from
+	p.from = nil
+	ev.ActionType = models.ActionFileDelete
+	return []models.RawEvent{ev}
+}
+
+// Pending reports whether an old name is waiting for its pair.
+func (p *Pairer) Pending() bool {
+	return p.from != nil
+}
@@ -0,0 +1,38 @@
+package rename
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func TestPairer(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	var p Pairer
+
+	if out := p.From(models.RawEvent{Timestamp: t0, PID: 7, Target: "/w/a.go"}); len(out) != 0 {
+		t.Fatalf("expected nothing to be released yet, got %+v", out)
+	}
+	out := p.To(models.RawEvent{Timestamp: t0, PID: 7, Target: "/w/b.go"})
+	if len(out) != 1 || out[0].ActionType != models.ActionFileRename || out[0].OldPath != "/w/a.go" || out[0].Target != "/w/b.go" {
+		t.Fatalf("expected a rename, got %+v", out)
+	}
+
+	p.From(models.RawEvent{Timestamp: t0, PID: 7, Target: "/w/c.go"})
+	out = p.To(models.RawEvent{Timestamp: t0, PID: 8, Target: "/w/d.go"})
+	if len(out) != 2 || out[0].ActionType != models.ActionFileDelete || out[0].Target != "/w/c.go" || out[1].ActionType != models.ActionFileCreate {
+		t.Fatalf("expected halves from different processes to stay apart, got %+v", out)
+	}
+
+	p.From(models.RawEvent{Timestamp: t0, PID: 7, Target: "/w/e.go"})
+	out = p.To(models.RawEvent{Timestamp: t0.Add(2 * Window), PID: 7, Target: "/w/f.go"})
+	if len(out) != 2 || out[0].ActionType != models.ActionFileDelete || out[1].ActionType != models.ActionFileCreate {
+		t.Fatalf("expected a late new name to be a create, got %+v", out)
+	}
+
+	p.From(models.RawEvent{Timestamp: t0, PID: 7, Target: "/w/g.go"})
+	if out = p.Flush(); len(out) != 1 || out[0].ActionType != models.ActionFileDelete || p.Pending() {
+		t.Fatalf("expected flush to release a delete, got %+v", out)
+	}
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// Replay is a Collector that emits the events of a recording made by
+// Recorder. Start returns once the whole recording has been delivered.
+type Replay struct {
+	path     string
+	realtime bool
+}
+
+// NewReplay reads the recording at path. With realtime the gaps between
+// events are kept as recorded; otherwise events are delivered as fast as
+// the consumer takes them.
+func NewReplay(path string, realtime bool) *Replay {
+	return &Replay{path: path, realtime: realtime}
+}
+
+// Start emits the recording's collector events; the other entries are
+// skipped.
+func (r *Replay) Start(ctx context.Context, out chan<- models.RawEvent) error {
+	return ReadRecording(ctx, r.path, r.realtime, func(e Entry) error {
+		if e.Event == nil {
+			return nil
+		}
+		select {
+		case out <- *e.Event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// ReadRecording calls fn with each entry of the recording at path, in order,
+// stopping at the first error fn returns. With realtime the gaps between
+// entries are kept as recorded.
+func ReadRecording(ctx context.Context, path string, realtime bool, fn func(Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readEntries(ctx, f, realtime, fn)
+}
+
+func readEntries(ctx context.Context, src io.Reader, realtime bool, fn func(Entry) error) error {
+	s := bufio.NewScanner(src)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var prev time.Time
+	line := 0
+	for s.Scan() {
+		line++
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		e, err := decodeEntry(s.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		at := e.at()
+		if realtime && !prev.IsZero() {
+			if gap := at.Sub(prev); gap > 0 {
+				t := time.NewTimer(gap)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return ctx.Err()
+				case <-t.C:
+				}
+			}
+		}
+		if at.After(prev) {
+			prev = at
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+func decodeEntry(b []byte) (Entry, error) {
+	var head struct{ Kind string }
+	if err := json.Unmarshal(b, &head); err != nil {
+		return Entry{}, err
+	}
+	switch head.Kind {
+	case "":
+		// Entries written without a UID must not read as root's.
+		ev := models.RawEvent{UID: -1}
+		if err := json.Unmarshal(b, &ev); err != nil {
+			return Entry{}, err
+		}
+		return Entry{Event: &ev}, nil
+	case KindRoot:
+		var r RootEntry
+		if err := json.Unmarshal(b, &r); err != nil {
+			return Entry{}, err
+		}
+		return Entry{Root: &r}, nil
+	case KindDNS:
+		var d DNSEntry
+		if err := json.Unmarshal(b, &d); err != nil {
+			return Entry{}, err
+		}
+		return Entry{DNS: &d}, nil
+	}
+	return Entry{}, fmt.Errorf("unknown entry kind %q", head.Kind)
+}
@@ -16,8 +16,14 @@ type Config struct {
 		SocketPath    string `toml:"socket_path"`
 	} `toml:"daemon"`
 	Collection struct {
-		PollIntervalMS  int  `toml:"poll_interval_ms"`
-		ActiveAgentOnly bool `toml:"active_agent_only"`
+		PollIntervalMS  int      `toml:"poll_interval_ms"`
+		ActiveAgentOnly bool     `toml:"active_agent_only"`
+		WatchRoots      []string `toml:"watch_roots"`
+		// SensitivePaths are files whose reads are recorded. "~/" matches
+		// every user's home, relative entries match inside watched
+		// workspaces, and shell globs are allowed. A directory covers the
+		// files directly inside it.
+		SensitivePaths []string `toml:"sensitive_paths"`
 	} `toml:"collection"`
 	Snapshot struct {
 		Enabled        bool     `toml:"enabled"`
@@ -26,13 +32,48 @@ type Config struct {
 	} `toml:"snapshot"`
 	Risk struct {
 		MinDisplayScore int `toml:"min_display_score"`
+		// RulesFile holds extra risk rules; see RiskRule. The daemon
+		// reloads it whenever it changes.
+		RulesFile string `toml:"rules_file"`
 	} `toml:"risk"`
 	Privacy struct {
 		ExtraSkipPaths []string `toml:"extra_skip_paths"`
 	} `toml:"privacy"`
 	Network struct {
 		ExtraAIDomains []string `toml:"extra_ai_domains"`
+		// DNS runs a local forwarder that learns which names processes
+		// resolve. Point resolv.conf (or an agent's resolver) at Listen.
+		DNS struct {
+			Enabled  bool   `toml:"enabled"`
+			Listen   string `toml:"listen"`
+			Upstream string `toml:"upstream"`
+		} `toml:"dns"`
 	} `toml:"network"`
+	// Agents adds agents to, or extends, the built-in signatures.
+	Agents []Agent `toml:"agents"`
+}
+
+// Agent is one [[agents]] entry. Ports are local model server ports.
+type Agent struct {
+	ID   string `toml:"id"`
+	Name string `toml:"name"`
+	ProcessMatch
+	Domains []string `toml:"domains"`
+	Ports   []int    `toml:"ports"`
+	// Env lists marker variables, NAME or NAME=value, the agent sets for
+	// the processes it starts.
+	Env []string `toml:"env"`
+	// Ancestor, when set, must match one of the process's ancestors.
+	Ancestor *ProcessMatch `toml:"ancestor"`
+}
+
+// ProcessMatch recognizes a process. Every condition given must hold:
+// Argv holds regular expressions for the full command line and ExePaths
+// globs for the executable path.
+type ProcessMatch struct {
+	ProcessNames []string `toml:"process_names"`
+	Argv         []string `toml:"argv"`
+	ExePaths     []string `toml:"exe_paths"`
 }
 
 func Default() Config {
@@ -44,13 +85,30 @@ func Default() Config {
 	cfg.Daemon.SocketPath = filepath.Join(home, ".kai", "kai.sock")
 	cfg.Collection.PollIntervalMS = 1000
 	cfg.Collection.ActiveAgentOnly = true
+	cfg.Collection.SensitivePaths = DefaultSensitivePaths()
 	cfg.Snapshot.Enabled = true
 	cfg.Snapshot.MaxFileKB = 50
 	cfg.Snapshot.SkipExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".mp4", ".zip", ".tar", ".gz", ".wasm", ".so", ".dylib", ".dll", ".exe"}
 	cfg.Risk.MinDisplayScore = 0
+	cfg.Risk.RulesFile = filepath.Join(home, ".kai", "rules.toml")
+	cfg.Network.DNS.Listen = "127.0.0.153:53"
 	return cfg
 }
 
+// DefaultSensitivePaths lists credential stores agents have no business
+// reading.
+func DefaultSensitivePaths() []string {
+	return []string{
+		"~/.ssh", "~/.aws/credentials", "~/.aws/config", "~/.config/gcloud", "~/.azure",
+		"~/.kube/config", "~/.docker/config.json", "~/.netrc", "~/.git-credentials",
+		"~/.npmrc", "~/.pypirc", "~/.config/gh/hosts.yml", "~/.gnupg/private-keys-v1.d",
+		"~/.config/google-chrome/*/Cookies", "~/.config/google-chrome/*/Login Data",
+		"~/.config/chromium/*/Cookies", "~/.config/chromium/*/Login Data",
+		"~/.mozilla/firefox/*/cookies.sqlite", "~/.mozilla/firefox/*/logins.json", "~/.mozilla/firefox/*/key4.db",
+		".env", ".env.*",
+	}
+}
+
 func Load(path string) (Config, error) {
 	cfg := Default()
 	if path == "" {
@@ -70,6 +128,10 @@ func expand(cfg Config) Config {
 	cfg.Daemon.DBPath = expandHome(cfg.Daemon.DBPath)
 	cfg.Daemon.LogPath = expandHome(cfg.Daemon.LogPath)
 	cfg.Daemon.SocketPath = expandHome(cfg.Daemon.SocketPath)
+	cfg.Risk.RulesFile = expandHome(cfg.Risk.RulesFile)
+	for i, root := range cfg.Collection.WatchRoots {
+		cfg.Collection.WatchRoots[i] = expandHome(root)
+	}
 	return cfg
 }
 
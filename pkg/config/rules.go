@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// RiskRule is one [[rules]] entry of the risk rules file. Every condition
+// given must hold, and a list holds when any of its entries does: actions
+// are action types such as EXEC or FILE_WRITE, paths are globs where **
+// spans directories, argv holds regular expressions for each simple command
+// a command line runs, once wrappers like sh -c and env are unwrapped, and
+// domains may start with "*." to cover subdomains.
+//
+// A rule with the label of a built-in rule replaces it; with no conditions
+// it only changes its score, and with score 0 it turns it off.
+type RiskRule struct {
+	Label    string   `toml:"label"`
+	Score    int      `toml:"score"`
+	Severity string   `toml:"severity"`
+	Actions  []string `toml:"actions"`
+	Paths    []string `toml:"paths"`
+	Argv     []string `toml:"argv"`
+	Agents   []string `toml:"agents"`
+	Domains  []string `toml:"domains"`
+}
+
+// LoadRules reads a risk rules file. Unknown keys are errors, so a typo
+// cannot quietly turn a condition off.
+func LoadRules(path string) ([]RiskRule, error) {
+	var f struct {
+		Rules []RiskRule `toml:"rules"`
+	}
+	md, err := toml.DecodeFile(path, &f)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %s", undecoded[0])
+	}
+	return f.Rules, nil
+}
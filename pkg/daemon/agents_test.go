@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/config"
+)
+
+func TestLoadAgents_FromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	toml := `
+[[agents]]
+id = "Inhouse"
+process_names = ["node"]
+argv = ['agent/dist/main\.js']
+ancestor = { process_names = ["tmux"] }
+`
+	if err := os.WriteFile(path, []byte(toml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = attribution.LoadAgents(nil, nil) })
+	if err := LoadAgents(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	p := attribution.ProcessInfo{Name: "node", Argv: []string{"node", "/srv/agent/dist/main.js"}}
+	if id, ok := attribution.AgentForCommand(p, []attribution.ProcessInfo{{Name: "bash"}, {Name: "tmux"}}); !ok || id != "inhouse" {
+		t.Fatalf("expected configured agent under tmux, got %s", id)
+	}
+	if _, ok := attribution.AgentForCommand(p, []attribution.ProcessInfo{{Name: "bash"}}); ok {
+		t.Fatal("expected ancestor condition to be enforced")
+	}
+
+	cfg.Agents[0].Argv = []string{"("}
+	if err := LoadAgents(cfg); err == nil {
+		t.Fatal("expected invalid argv pattern to be rejected")
+	}
+}
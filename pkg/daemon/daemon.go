@@ -10,6 +10,8 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -18,6 +20,7 @@ import (
 	"github.com/kai-ai/kai/pkg/attribution"
 	"github.com/kai-ai/kai/pkg/collector"
 	"github.com/kai-ai/kai/pkg/config"
+	"github.com/kai-ai/kai/pkg/dnsproxy"
 	"github.com/kai-ai/kai/pkg/models"
 	"github.com/kai-ai/kai/pkg/snapshot"
 	"github.com/kai-ai/kai/pkg/storage"
@@ -37,6 +40,8 @@ type Daemon struct {
 	engine    *attribution.Engine
 	snap      *snapshot.Manager
 	listener  net.Listener
+	record    io.Closer
+	recorder  *collector.Recorder
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -45,8 +50,12 @@ type Daemon struct {
 	events atomic.Int64
 	start  time.Time
 
-	watchMu     sync.RWMutex
-	rawWatchers []chan models.RawEvent
+	pipe *pipeline
+
+	watchMu         sync.RWMutex
+	rawWatchers     []chan models.RawEvent
+	rawWatchSent    atomic.Int64
+	rawWatchDropped atomic.Int64
 }
 
 func (d *Daemon) registerRawWatcher(ch chan models.RawEvent) {
@@ -62,12 +71,60 @@ func (d *Daemon) broadcastRaw(ev models.RawEvent) {
 	for _, w := range watchers {
 		select {
 		case w <- ev:
+			d.rawWatchSent.Add(1)
 		default:
+			d.rawWatchDropped.Add(1)
+		}
+	}
+}
+
+// LoadAgents merges the configured agents and AI domains into attribution's
+// built-ins.
+func LoadAgents(cfg config.Config) error {
+	custom := make([]attribution.AgentSignature, 0, len(cfg.Agents))
+	for i, a := range cfg.Agents {
+		sig, err := processSignature(a.ProcessMatch)
+		if err != nil {
+			return fmt.Errorf("agents[%d] %s: %w", i, a.ID, err)
+		}
+		if a.Ancestor != nil {
+			anc, err := processSignature(*a.Ancestor)
+			if err != nil {
+				return fmt.Errorf("agents[%d] %s: ancestor: %w", i, a.ID, err)
+			}
+			sig.Ancestor = &anc
 		}
+		sig.ID = models.AgentID(strings.ToLower(strings.TrimSpace(a.ID)))
+		sig.DisplayName, sig.Domains, sig.Ports, sig.Env = a.Name, a.Domains, a.Ports, a.Env
+		custom = append(custom, sig)
 	}
+	return attribution.LoadAgents(custom, cfg.Network.ExtraAIDomains)
+}
+
+func processSignature(m config.ProcessMatch) (attribution.AgentSignature, error) {
+	sig := attribution.AgentSignature{ProcessNames: m.ProcessNames, ExePaths: m.ExePaths}
+	for _, p := range m.Argv {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return sig, fmt.Errorf("argv %q: %w", p, err)
+		}
+		sig.Argv = append(sig.Argv, re)
+	}
+	for _, g := range m.ExePaths {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return sig, fmt.Errorf("exe_paths %q: %w", g, err)
+		}
+	}
+	return sig, nil
 }
 
 func New(cfg config.Config) (*Daemon, error) {
+	if err := LoadAgents(cfg); err != nil {
+		return nil, err
+	}
+	if _, err := LoadRiskRules(cfg.Risk.RulesFile); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Risk.RulesFile, err)
+	}
 	st, err := storage.Open(cfg.Daemon.DBPath)
 	if err != nil {
 		return nil, err
@@ -78,11 +135,16 @@ func New(cfg config.Config) (*Daemon, error) {
 		snapCfg.SkipExtensions[ext] = struct{}{}
 	}
 
+	collCfg := collector.Config{WatchRoots: cfg.Collection.WatchRoots, SensitivePaths: cfg.Collection.SensitivePaths, IsAgentProcess: func(name string, argv []string, exe string) bool {
+		_, ok := attribution.AgentForCommand(attribution.ProcessInfo{Name: name, Argv: argv, Exe: exe}, nil)
+		return ok
+	}}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Daemon{
-		cfg: cfg, store: st, collector: collector.NewCollector(),
+		cfg: cfg, store: st, collector: collector.NewCollector(collCfg),
 		engine: attribution.NewEngine(st), snap: snapshot.NewManager(st, snapCfg),
-		ctx: ctx, cancel: cancel,
+		pipe: newPipeline(), ctx: ctx, cancel: cancel,
 	}, nil
 }
 
@@ -93,35 +155,44 @@ func (d *Daemon) Start() error {
 	}
 	_ = os.Remove(d.cfg.Daemon.SocketPath)
 
-	rawEvents := make(chan models.RawEvent, 2048)
-	d.wg.Add(1)
+	d.wg.Add(2)
 	go func() {
 		defer d.wg.Done()
-		_ = d.collector.Start(d.ctx, rawEvents)
+		_ = d.collector.Start(d.ctx, d.pipe.intake.ch)
+	}()
+	go func() {
+		defer d.wg.Done()
+		d.pipe.sort(d.ctx)
 	}()
 
+	if d.cfg.Network.DNS.Enabled {
+		d.startDNSForwarder()
+	}
+	d.watchRules()
+
 	d.wg.Add(1)
 	go func() {
 		defer d.wg.Done()
 		for {
-			select {
-			case <-d.ctx.Done():
+			ev, ok := d.pipe.next(d.ctx)
+			if !ok {
 				return
-			case ev := <-rawEvents:
-				d.broadcastRaw(ev)
-				agentEv := d.engine.Process(ev)
-				if agentEv == nil {
-					continue
-				}
-				d.events.Add(1)
-				switch agentEv.ActionType {
-				case models.ActionFileCreate:
-					d.snap.OnFileEvent(agentEv.SessionID, agentEv.Target, models.FileCreated)
-				case models.ActionFileWrite:
-					d.snap.OnFileEvent(agentEv.SessionID, agentEv.Target, models.FileModified)
-				case models.ActionFileDelete:
-					d.snap.OnFileDelete(agentEv.SessionID, agentEv.Target)
-				}
+			}
+			d.broadcastRaw(ev)
+			agentEv := d.engine.Process(ev)
+			if agentEv == nil {
+				continue
+			}
+			d.events.Add(1)
+			switch agentEv.ActionType {
+			case models.ActionFileCreate:
+				d.snap.OnFileEvent(agentEv.SessionID, agentEv.Target, models.FileCreated, agentEv.Attribution)
+			case models.ActionFileWrite:
+				d.snap.OnFileEvent(agentEv.SessionID, agentEv.Target, models.FileModified, agentEv.Attribution)
+			case models.ActionFileDelete:
+				d.snap.OnFileDelete(agentEv.SessionID, agentEv.Target, agentEv.Attribution)
+			case models.ActionFileRename:
+				d.snap.OnFileRename(agentEv.SessionID, agentEv.OldPath, agentEv.Target, agentEv.Attribution)
 			}
 		}
 	}()
@@ -150,6 +221,30 @@ func (d *Daemon) Start() error {
 	return nil
 }
 
+// startDNSForwarder runs the optional local resolver. Failing to bind (the
+// port is taken, or binding port 53 needs privileges) leaves it off.
+func (d *Daemon) startDNSForwarder() {
+	cache := d.engine.DNSCache()
+	fwd := dnsproxy.New(dnsproxy.Config{
+		Listen:   d.cfg.Network.DNS.Listen,
+		Upstream: d.cfg.Network.DNS.Upstream,
+		Owner:    collector.SocketOwner,
+		OnAnswer: func(a dnsproxy.Answer) {
+			d.recordInput(collector.Entry{DNS: &collector.DNSEntry{At: a.At, IP: a.IP, Name: a.Name, TTL: a.TTL, PID: a.PID, ProcessName: a.ProcessName}})
+			cache.RecordAnswer(a.IP, a.Name, a.TTL, a.PID, a.ProcessName, a.At)
+		},
+	})
+	if err := fwd.Start(d.ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "kai: dns forwarder disabled: %v\n", err)
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		fwd.Wait()
+	}()
+}
+
 func (d *Daemon) serve(listener net.Listener) {
 	defer d.wg.Done()
 	defer listener.Close()
@@ -186,7 +281,13 @@ func (d *Daemon) handleConn(c net.Conn) {
 	case "debug_classify_net":
 		d.handleDebugClassifyNet(req, enc)
 	case "status":
-		_ = enc.Encode(RPCResponse{OK: true, Status: &RPCStatus{Running: true, PID: os.Getpid(), Uptime: time.Since(d.start), Events: d.events.Load()}})
+		_ = enc.Encode(RPCResponse{OK: true, Status: d.status()})
+	case "exec_start":
+		_ = enc.Encode(d.execStart(req))
+	case "exec_end":
+		_ = enc.Encode(d.execEnd(req))
+	case "ingest_exec":
+		_ = enc.Encode(d.ingestExec(req))
 	case "sessions":
 		limit := req.Limit
 		if limit <= 0 {
@@ -243,6 +344,18 @@ func (d *Daemon) handleConn(c net.Conn) {
 	}
 }
 
+func (d *Daemon) status() *RPCStatus {
+	st := &RPCStatus{Running: true, PID: os.Getpid(), Uptime: time.Since(d.start), Events: d.events.Load()}
+	st.Stages = d.pipe.stats()
+	st.Stages = append(st.Stages, StageStats{Name: "raw watchers", In: d.rawWatchSent.Load(), Dropped: d.rawWatchDropped.Load()})
+	sent, dropped := d.engine.WatcherStats()
+	st.Stages = append(st.Stages, StageStats{Name: "event watchers", In: sent, Dropped: dropped})
+	for _, s := range st.Stages {
+		st.Dropped += s.Dropped
+	}
+	return st
+}
+
 func (d *Daemon) handleDebugNet(enc *json.Encoder) {
 	ch := make(chan models.RawEvent, 256)
 	d.registerRawWatcher(ch)
@@ -251,7 +364,7 @@ func (d *Daemon) handleDebugNet(enc *json.Encoder) {
 		case <-d.ctx.Done():
 			return
 		case ev := <-ch:
-			if ev.ActionType != models.ActionNetConnect {
+			if ev.ActionType != models.ActionNetConnect && ev.ActionType != models.ActionNetListen {
 				continue
 			}
 			if err := enc.Encode(RPCResponse{OK: true, RawEvent: &ev}); err != nil {
@@ -275,7 +388,7 @@ func (d *Daemon) handleDebugClassifyNet(req RPCRequest, enc *json.Encoder) {
 			if raw.ActionType != models.ActionNetConnect {
 				continue
 			}
-			agent := d.engine.PeekClassify(raw)
+			agent, attr := d.engine.PeekClassify(raw)
 			if req.UnknownOnly && agent != models.AgentUnknown {
 				continue
 			}
@@ -283,6 +396,7 @@ func (d *Daemon) handleDebugClassifyNet(req RPCRequest, enc *json.Encoder) {
 				ID:          "",
 				Timestamp:   raw.Timestamp,
 				Agent:       agent,
+				Attribution: attr,
 				ActionType:  raw.ActionType,
 				Target:      raw.Target,
 				PID:         raw.PID,
@@ -313,6 +427,9 @@ func (d *Daemon) handleWatch(req RPCRequest, enc *json.Encoder) {
 			if req.MinRisk > 0 && ev.RiskScore < req.MinRisk {
 				continue
 			}
+			if req.MinConfidence > 0 && ev.Attribution.Confidence < req.MinConfidence {
+				continue
+			}
 			if err := enc.Encode(RPCResponse{OK: true, Event: &ev}); err != nil {
 				if !errors.Is(err, io.EOF) {
 					_ = err
@@ -336,9 +453,34 @@ func (d *Daemon) Stop() error {
 	d.wg.Wait()
 	_ = os.Remove(d.cfg.Daemon.SocketPath)
 	_ = os.Remove(d.pidPath())
+	if d.record != nil {
+		_ = d.record.Close()
+	}
 	return d.store.Close()
 }
 
+// Record appends every raw event the collector produces to path as JSON
+// lines, for `kai daemon replay`, along with the kai exec roots, hook
+// reports and DNS answers the engine is given. Call it before Start.
+func (d *Daemon) Record(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	d.recorder = collector.NewRecorder(d.collector, f)
+	d.collector = d.recorder
+	d.record = f
+	return nil
+}
+
+// recordInput adds an engine input that does not come from the collector to
+// the recording, if there is one.
+func (d *Daemon) recordInput(e collector.Entry) {
+	if d.recorder != nil {
+		d.recorder.Write(e)
+	}
+}
+
 func (d *Daemon) writePID() error {
 	return os.WriteFile(d.pidPath(), []byte(fmt.Sprintf("%d", os.Getpid())), 0o600)
 }
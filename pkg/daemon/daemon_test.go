@@ -33,6 +33,9 @@ func TestHandleConn_StatusSessionsReplay(t *testing.T) {
 	if !statusResp.OK || statusResp.Status == nil || !statusResp.Status.Running {
 		t.Fatalf("unexpected status response: %+v", statusResp)
 	}
+	if len(statusResp.Status.Stages) == 0 || statusResp.Status.Dropped != 0 {
+		t.Fatalf("expected pipeline stages and no drops: %+v", statusResp.Status)
+	}
 
 	sessionsResp := runRPC(t, d, RPCRequest{Action: "sessions", Limit: 10})
 	if !sessionsResp.OK || len(sessionsResp.Sessions) == 0 {
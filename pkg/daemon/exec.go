@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/collector"
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/utils"
+)
+
+// execStart pins a kai exec process as the root of an agent's tree.
+func (d *Daemon) execStart(req RPCRequest) RPCResponse {
+	if req.Exec == nil || req.Exec.PID <= 0 || req.Agent == nil {
+		return RPCResponse{OK: false, Error: "exec_start needs an agent and a pid"}
+	}
+	if !attribution.KnownAgent(*req.Agent) {
+		return RPCResponse{OK: false, Error: "unknown agent " + string(*req.Agent)}
+	}
+	d.recordInput(collector.Entry{Root: &collector.RootEntry{At: time.Now(), PID: req.Exec.PID, Agent: *req.Agent}})
+	d.engine.RegisterRoot(req.Exec.PID, *req.Agent)
+	return RPCResponse{OK: true}
+}
+
+// execEnd unpins the root and files its transcript with every session the
+// agent's processes took part in.
+func (d *Daemon) execEnd(req RPCRequest) RPCResponse {
+	if req.Exec == nil || req.Exec.PID <= 0 || req.Agent == nil {
+		return RPCResponse{OK: false, Error: "exec_end needs an agent and a pid"}
+	}
+	run := req.Exec
+	var sessions []models.Session
+	for _, id := range d.engine.FinishRoot(run.PID) {
+		t := &models.Transcript{
+			ID:        utils.NewID("tr"),
+			SessionID: id,
+			Agent:     *req.Agent,
+			PID:       run.PID,
+			Command:   run.Command,
+			StartedAt: run.StartedAt,
+			EndedAt:   run.EndedAt,
+			ExitCode:  run.ExitCode,
+			Content:   run.Transcript,
+			Marks:     run.Marks,
+			Truncated: run.Truncated,
+		}
+		if err := d.store.InsertTranscript(t); err != nil {
+			return RPCResponse{OK: false, Error: err.Error()}
+		}
+		sessions = append(sessions, models.Session{ID: id, Agent: *req.Agent})
+	}
+	return RPCResponse{OK: true, Sessions: sessions}
+}
+
+// ingestExec queues a command reported by a shell hook for the engine,
+// like the collector's events.
+func (d *Daemon) ingestExec(req RPCRequest) RPCResponse {
+	c := req.Command
+	if c == nil || c.PID <= 0 || strings.TrimSpace(c.Command) == "" {
+		return RPCResponse{OK: false, Error: "ingest_exec needs a pid and a command"}
+	}
+	agent, marker := models.AgentUnknown, ""
+	if name, value, ok := strings.Cut(c.Marker, "="); ok {
+		if id, ok := attribution.AgentForEnv(name, value); ok {
+			agent, marker = id, name
+		}
+	}
+	raw := models.RawEvent{
+		Timestamp:   c.EndedAt.Add(-c.Duration),
+		PID:         c.PID,
+		ProcessName: c.Shell,
+		ActionType:  models.ActionExec,
+		Target:      strings.TrimSpace(c.Command),
+		CWD:         c.CWD,
+		UID:         -1,
+		Platform:    runtime.GOOS,
+		Reported:    &models.ShellReport{Agent: agent, Marker: marker, Exit: models.ExecExit{Code: c.ExitCode, Duration: c.Duration}},
+	}
+	d.recordInput(collector.Entry{Event: &raw})
+	select {
+	case d.pipe.intake.ch <- raw:
+	case <-d.ctx.Done():
+		return RPCResponse{OK: false, Error: "daemon is stopping"}
+	}
+	return RPCResponse{OK: true}
+}
@@ -0,0 +1,139 @@
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+const (
+	intakeQueueSize   = 2048
+	priorityQueueSize = 8192
+	fileQueueSize     = 4096
+)
+
+// stage is one bounded queue of the event pipeline. It counts what it
+// accepts and what it has to drop so gaps in the audit trail are visible.
+type stage[T any] struct {
+	name    string
+	ch      chan T
+	in      atomic.Int64
+	dropped atomic.Int64
+}
+
+func newStage[T any](name string, size int) *stage[T] {
+	return &stage[T]{name: name, ch: make(chan T, size)}
+}
+
+// offer enqueues v without blocking and counts a drop when the queue is full.
+func (s *stage[T]) offer(v T) bool {
+	select {
+	case s.ch <- v:
+		s.in.Add(1)
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+func (s *stage[T]) stats() StageStats {
+	return StageStats{Name: s.name, Depth: len(s.ch), Capacity: cap(s.ch), In: s.in.Load(), Dropped: s.dropped.Load()}
+}
+
+// queued is an event numbered in the order it left intake.
+type queued struct {
+	seq uint64
+	ev  models.RawEvent
+}
+
+// pipeline sits between the collector and the engine. Collectors block on
+// intake, which is drained promptly into two queues: process and network
+// events, which are rare and matter most, and file events, which can come
+// in storms. A file storm that outruns the engine loses file events rather
+// than stalling exec capture, but the engine still takes events in the
+// order the collector produced them, as a recording holds them.
+type pipeline struct {
+	intake   *stage[models.RawEvent]
+	priority *stage[queued]
+	files    *stage[queued]
+	// seq numbers events as sort takes them; only sort touches it.
+	seq uint64
+	// heads are events next has taken from each queue but not yet
+	// returned; only the engine loop touches them.
+	priorityHead, fileHead *queued
+}
+
+func newPipeline() *pipeline {
+	return &pipeline{
+		intake:   newStage[models.RawEvent]("intake", intakeQueueSize),
+		priority: newStage[queued]("exec/net", priorityQueueSize),
+		files:    newStage[queued]("file", fileQueueSize),
+	}
+}
+
+// sort numbers events from intake and moves them to their queues until ctx
+// is done.
+func (p *pipeline) sort(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-p.intake.ch:
+			p.intake.in.Add(1)
+			p.seq++
+			if isFileAction(ev.ActionType) {
+				p.files.offer(queued{p.seq, ev})
+			} else {
+				p.priority.offer(queued{p.seq, ev})
+			}
+		}
+	}
+}
+
+// next returns the next event for the engine, merging the two queues back
+// into the order sort numbered them in.
+func (p *pipeline) next(ctx context.Context) (models.RawEvent, bool) {
+	if p.priorityHead == nil && p.fileHead == nil {
+		select {
+		case <-ctx.Done():
+			return models.RawEvent{}, false
+		case q := <-p.priority.ch:
+			p.priorityHead = &q
+		case q := <-p.files.ch:
+			p.fileHead = &q
+		}
+	}
+	// sort queues in order, so every event numbered before the head
+	// taken is already in the other queue.
+	p.priorityHead = peek(p.priority.ch, p.priorityHead)
+	p.fileHead = peek(p.files.ch, p.fileHead)
+	var q *queued
+	if p.fileHead == nil || p.priorityHead != nil && p.priorityHead.seq < p.fileHead.seq {
+		q, p.priorityHead = p.priorityHead, nil
+	} else {
+		q, p.fileHead = p.fileHead, nil
+	}
+	return q.ev, true
+}
+
+func peek(ch chan queued, head *queued) *queued {
+	if head != nil {
+		return head
+	}
+	select {
+	case q := <-ch:
+		return &q
+	default:
+		return nil
+	}
+}
+
+func (p *pipeline) stats() []StageStats {
+	return []StageStats{p.intake.stats(), p.priority.stats(), p.files.stats()}
+}
+
+func isFileAction(a models.ActionType) bool {
+	return a == models.ActionFileWrite || a == models.ActionFileCreate || a == models.ActionFileDelete || a == models.ActionFileRename
+}
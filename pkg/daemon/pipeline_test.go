@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func sortAll(t *testing.T, p *pipeline, n int64) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.sort(ctx)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.intake.in.Load() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestPipeline_KeepsOrderAndCountsFileDrops(t *testing.T) {
+	p := &pipeline{intake: newStage[models.RawEvent]("intake", 8), priority: newStage[queued]("exec/net", 4), files: newStage[queued]("file", 2)}
+	for i := 0; i < 3; i++ {
+		p.intake.ch <- models.RawEvent{ActionType: models.ActionFileWrite, Target: "/w/f"}
+	}
+	p.intake.ch <- models.RawEvent{ActionType: models.ActionExec, Target: "git push"}
+	sortAll(t, p, 4)
+
+	for _, want := range []models.ActionType{models.ActionFileWrite, models.ActionFileWrite, models.ActionExec} {
+		if ev, ok := p.next(context.Background()); !ok || ev.ActionType != want {
+			t.Fatalf("expected %s, got %+v", want, ev)
+		}
+	}
+	stats := p.stats()
+	if stats[0].In != 4 || stats[1].In != 1 || stats[2].In != 2 || stats[2].Dropped != 1 {
+		t.Fatalf("unexpected stage stats: %+v", stats)
+	}
+}
+
+func TestPipeline_ExitFollowsEarlierFileWrites(t *testing.T) {
+	p := newPipeline()
+	events := []models.RawEvent{
+		{PID: 10, ActionType: models.ActionExec, Target: "python3 gen.py"},
+		{PID: 10, ActionType: models.ActionFileWrite, Target: "/w/a.go"},
+		{PID: 10, ActionType: models.ActionFileWrite, Target: "/w/b.go"},
+		{PID: 10, ActionType: models.ActionProcExit},
+		{PID: 11, ActionType: models.ActionFileCreate, Target: "/w/c.go"},
+	}
+	for _, ev := range events {
+		p.intake.ch <- ev
+	}
+	sortAll(t, p, int64(len(events)))
+
+	for i, want := range events {
+		ev, ok := p.next(context.Background())
+		if !ok || ev.ActionType != want.ActionType || ev.Target != want.Target {
+			t.Fatalf("event %d: expected %+v, got %+v", i, want, ev)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ev, ok := p.next(ctx); ok {
+		t.Fatalf("expected no more events, got %+v", ev)
+	}
+}
@@ -14,6 +14,41 @@ type RPCRequest struct {
 	Limit       int             `json:"limit,omitempty"`
 	SessionID   string          `json:"session_id,omitempty"`
 	UnknownOnly bool            `json:"unknown_only,omitempty"`
+
+	// Exec carries kai exec's registration (exec_start) and, with the
+	// transcript filled in, its completion (exec_end).
+	Exec *ExecRun `json:"exec,omitempty"`
+	// Command is a finished command reported by a shell hook (ingest_exec).
+	Command *ShellCommand `json:"command,omitempty"`
+	// MinConfidence drops events attributed with less confidence (watch).
+	MinConfidence int `json:"min_confidence,omitempty"`
+}
+
+// ShellCommand is one command line run by an interactive shell. PID is the
+// shell's; Marker is the first agent marker variable set in the shell, as
+// NAME=value.
+type ShellCommand struct {
+	PID      int           `json:"pid"`
+	Command  string        `json:"command"`
+	CWD      string        `json:"cwd,omitempty"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	EndedAt  time.Time     `json:"ended_at"`
+	Marker   string        `json:"marker,omitempty"`
+	Shell    string        `json:"shell,omitempty"`
+}
+
+// ExecRun describes one agent launched by kai exec. PID is kai exec's own
+// process, which the agent runs under.
+type ExecRun struct {
+	PID        int                     `json:"pid"`
+	Command    string                  `json:"command"`
+	StartedAt  time.Time               `json:"started_at"`
+	EndedAt    time.Time               `json:"ended_at,omitempty"`
+	ExitCode   int                     `json:"exit_code,omitempty"`
+	Transcript []byte                  `json:"transcript,omitempty"`
+	Marks      []models.TranscriptMark `json:"marks,omitempty"`
+	Truncated  bool                    `json:"truncated,omitempty"`
 }
 
 type ReportRow struct {
@@ -29,6 +64,19 @@ type RPCStatus struct {
 	PID     int           `json:"pid"`
 	Uptime  time.Duration `json:"uptime"`
 	Events  int64         `json:"events"`
+	// Dropped totals Stages[].Dropped; non-zero means the audit trail has gaps.
+	Dropped int64        `json:"dropped"`
+	Stages  []StageStats `json:"stages,omitempty"`
+}
+
+// StageStats describes one queue of the event pipeline. Watcher stages have
+// no queue of their own; In counts deliveries and Dropped skipped sends.
+type StageStats struct {
+	Name     string `json:"name"`
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+	In       int64  `json:"in"`
+	Dropped  int64  `json:"dropped"`
 }
 
 type RPCResponse struct {
@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/collector"
+	"github.com/kai-ai/kai/pkg/models"
+	"github.com/kai-ai/kai/pkg/storage"
+)
+
+// Replay feeds a recording made by Record through an offline engine that
+// stores into the database at dbPath, and returns the sessions it produced.
+// Roots and DNS answers are handed to the engine as they were when recorded.
+// Snapshots are not taken since recordings hold no file contents.
+func Replay(ctx context.Context, dbPath, recording string, realtime bool) ([]models.Session, error) {
+	st, err := storage.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	engine := attribution.NewOfflineEngine(st)
+
+	var ids []string
+	seen := map[string]bool{}
+	err = collector.ReadRecording(ctx, recording, realtime, func(e collector.Entry) error {
+		switch {
+		case e.Root != nil:
+			engine.RegisterRoot(e.Root.PID, e.Root.Agent)
+		case e.DNS != nil:
+			a := e.DNS
+			engine.DNSCache().RecordAnswer(a.IP, a.Name, a.TTL, a.PID, a.ProcessName, a.At)
+		case e.Event != nil:
+			if ae := engine.Process(*e.Event); ae != nil && !seen[ae.SessionID] {
+				seen[ae.SessionID] = true
+				ids = append(ids, ae.SessionID)
+			}
+		}
+		return nil
+	})
+	engine.Close()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]models.Session, 0, len(ids))
+	for _, id := range ids {
+		r, err := st.GetReplay(id)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, r.Session)
+	}
+	return sessions, nil
+}
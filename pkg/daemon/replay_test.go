@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/collector"
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func TestReplay_DeterministicSessions(t *testing.T) {
+	tmp := t.TempDir()
+	rec := filepath.Join(tmp, "events.jsonl")
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []models.RawEvent{
+		{Timestamp: base, PID: 100, PPID: 1, ProcessName: "claude", ActionType: models.ActionProcSpawn, StartTime: base},
+		{Timestamp: base.Add(time.Second), PID: 101, PPID: 100, ProcessName: "bash", ActionType: models.ActionExec, Target: "git push origin main", StartTime: base.Add(time.Second)},
+		{Timestamp: base.Add(2 * time.Second), PID: 101, ProcessName: "bash", ActionType: models.ActionFileWrite, Target: filepath.Join(tmp, "main.go")},
+		// Claude's next event comes after the idle timeout, so it opens a
+		// second session and closes the first on event time.
+		{Timestamp: base.Add(2 * time.Minute), PID: 200, PPID: 1, ProcessName: "codex", ActionType: models.ActionExec, Target: "codex", StartTime: base.Add(2 * time.Minute)},
+		{Timestamp: base.Add(3 * time.Minute), PID: 100, ProcessName: "claude", ActionType: models.ActionExec, Target: "ls", StartTime: base},
+	}
+	f, err := os.Create(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = f.Close()
+
+	var runs [][]models.Session
+	for i := 0; i < 2; i++ {
+		sessions, err := Replay(context.Background(), filepath.Join(tmp, "run"+string(rune('a'+i))+".db"), rec, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range sessions {
+			sessions[j].ID = ""
+		}
+		runs = append(runs, sessions)
+	}
+	if !reflect.DeepEqual(runs[0], runs[1]) {
+		t.Fatalf("replays differ:\n%+v\n%+v", runs[0], runs[1])
+	}
+	got := runs[0]
+	if len(got) != 3 {
+		t.Fatalf("expected 3 sessions, got %+v", got)
+	}
+	first := got[0]
+	if first.Agent != models.AgentClaude || first.ExecCount != 1 || first.FileWrites != 1 || first.MaxRisk < 65 {
+		t.Fatalf("unexpected first session: %+v", first)
+	}
+	if first.EndedAt == nil || !first.EndedAt.Equal(base.Add(3*time.Minute)) {
+		t.Fatalf("expected first session to end on event time, got %v", first.EndedAt)
+	}
+	if last := got[2]; last.EndedAt == nil || !last.EndedAt.Equal(base.Add(3*time.Minute)) {
+		t.Fatalf("expected open sessions to close at the last event, got %v", last.EndedAt)
+	}
+}
+
+func TestReplay_RootsHookReportsAndDNSAnswers(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "events.jsonl")
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := collector.NewRecorder(nil, f)
+	rec.Write(collector.Entry{Root: &collector.RootEntry{At: base, PID: 300, Agent: models.AgentGemini}})
+	rec.Write(collector.Entry{Event: &models.RawEvent{Timestamp: base.Add(time.Second), PID: 301, PPID: 300, ProcessName: "python3", ActionType: models.ActionExec, Target: "python3 build.py", UID: -1, StartTime: base.Add(time.Second)}})
+	rec.Write(collector.Entry{Event: &models.RawEvent{Timestamp: base.Add(2 * time.Second), PID: 400, ProcessName: "zsh", ActionType: models.ActionExec, Target: "make test", UID: -1,
+		Reported: &models.ShellReport{Agent: models.AgentClaude, Marker: "CLAUDECODE", Exit: models.ExecExit{Duration: time.Second}}}})
+	rec.Write(collector.Entry{DNS: &collector.DNSEntry{At: base.Add(3 * time.Second), IP: "203.0.113.7", Name: "api.openai.com", TTL: time.Minute, PID: 500, ProcessName: "node"}})
+	rec.Write(collector.Entry{Event: &models.RawEvent{Timestamp: base.Add(4 * time.Second), PID: 500, ProcessName: "node", ActionType: models.ActionNetConnect, Target: "203.0.113.7:443", UID: -1}})
+	_ = f.Close()
+
+	sessions, err := Replay(context.Background(), filepath.Join(tmp, "replay.db"), path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[models.AgentID]models.Session{}
+	for _, s := range sessions {
+		got[s.Agent] = s
+	}
+	if len(sessions) != 3 || got[models.AgentGemini].ExecCount != 1 || got[models.AgentClaude].ExecCount != 1 || got[models.AgentCodex].NetCount != 1 {
+		t.Fatalf("expected a session each for the root, the hook report and the resolved connection, got %+v", sessions)
+	}
+}
@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/config"
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+// rulesSettle lets an editor finish writing the rules file before it is
+// reloaded.
+const rulesSettle = 200 * time.Millisecond
+
+var ruleActions = []models.ActionType{
+	models.ActionFileWrite, models.ActionFileCreate, models.ActionFileDelete, models.ActionFileRename, models.ActionFileRead,
+	models.ActionExec, models.ActionNetConnect, models.ActionNetListen,
+}
+
+// LoadRiskRules validates the rules file at path and puts its rules in
+// effect. A missing file leaves the built-in rules; an invalid one changes
+// nothing. It returns how many rules the file holds.
+func LoadRiskRules(path string) (int, error) {
+	entries, err := config.LoadRules(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, attribution.LoadRiskRules(nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+	rules := make([]attribution.RiskRule, 0, len(entries))
+	for i, r := range entries {
+		rule, err := compileRule(r)
+		if err != nil {
+			return 0, fmt.Errorf("rules[%d] %q: %w", i, r.Label, err)
+		}
+		rules = append(rules, rule)
+	}
+	return len(rules), attribution.LoadRiskRules(rules)
+}
+
+func compileRule(r config.RiskRule) (attribution.RiskRule, error) {
+	rule := attribution.RiskRule{Label: strings.TrimSpace(r.Label), Score: r.Score, Severity: r.Severity}
+	if rule.Label == "" {
+		return rule, errors.New("label is required")
+	}
+	if r.Score < 0 || r.Score > 100 {
+		return rule, fmt.Errorf("score %d is outside 0-100", r.Score)
+	}
+	if r.Severity != "" && !slices.Contains(attribution.Severities, r.Severity) {
+		return rule, fmt.Errorf("severity %q is not one of %s", r.Severity, strings.Join(attribution.Severities, ", "))
+	}
+	var m attribution.RuleMatch
+	for _, a := range r.Actions {
+		action := models.ActionType(strings.ToUpper(a))
+		if !slices.Contains(ruleActions, action) {
+			return rule, fmt.Errorf("unknown action %q", a)
+		}
+		m.Actions = append(m.Actions, action)
+	}
+	for _, g := range r.Paths {
+		re, err := globRegexp(g)
+		if err != nil {
+			return rule, fmt.Errorf("paths %q: %w", g, err)
+		}
+		m.Paths = append(m.Paths, re)
+	}
+	for _, p := range r.Argv {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return rule, fmt.Errorf("argv %q: %w", p, err)
+		}
+		m.Argv = append(m.Argv, re)
+	}
+	for _, a := range r.Agents {
+		m.Agents = append(m.Agents, models.AgentID(strings.ToLower(strings.TrimSpace(a))))
+	}
+	for _, d := range r.Domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || strings.Contains(strings.TrimPrefix(d, "*."), "*") {
+			return rule, fmt.Errorf("domains %q: only a leading *. is allowed", d)
+		}
+		m.Domains = append(m.Domains, d)
+	}
+	if !m.Empty() {
+		rule.Match = m.Match
+	}
+	return rule, nil
+}
+
+// globRegexp compiles a path glob. * and ? stay within one directory, **
+// spans any number of them, and [...] is a character class. A glob
+// without a leading / matches the end of a path: "*.pem" matches any pem
+// file and "migrations/**" anything under a migrations directory.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	if glob == "" {
+		return nil, errors.New("empty glob")
+	}
+	var b strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		b.WriteString("^")
+	} else {
+		b.WriteString("(^|/)")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				b.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// watchRules reloads the rules file whenever it changes. A file that no
+// longer validates leaves the rules in effect untouched.
+func (d *Daemon) watchRules() {
+	if d.cfg.Risk.RulesFile == "" {
+		return
+	}
+	path := filepath.Clean(d.cfg.Risk.RulesFile)
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kai: rules will not reload: %v\n", err)
+		return
+	}
+	// Editors often replace the file, so watch its directory.
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		_ = w.Close()
+		fmt.Fprintf(os.Stderr, "kai: rules will not reload: %v\n", err)
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer w.Close()
+		settle := time.NewTimer(time.Hour)
+		settle.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == path {
+					settle.Reset(rulesSettle)
+				}
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-settle.C:
+				n, err := LoadRiskRules(path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "kai: %s: %v; keeping the previous rules\n", path, err)
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "kai: loaded %d risk rules from %s\n", n, path)
+			}
+		}
+	}()
+}
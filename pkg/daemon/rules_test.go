@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kai-ai/kai/pkg/attribution"
+	"github.com/kai-ai/kai/pkg/models"
+)
+
+func TestLoadRiskRules_FromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	rules := `
+[[rules]]
+label = "migration changed"
+score = 70
+actions = ["file_write", "FILE_CREATE"]
+paths = ["migrations/**"]
+
+[[rules]]
+label = "kubectl delete"
+score = 90
+severity = "critical"
+argv = ['^kubectl\s+delete\b']
+agents = ["codex"]
+
+[[rules]]
+label = "pastebin upload"
+score = 60
+domains = ["*.pastebin.com"]
+
+[[rules]]
+label = "git push"
+score = 20
+
+[[rules]]
+label = "curl/wget executed"
+score = 0
+`
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = attribution.LoadRiskRules(nil) })
+	if n, err := LoadRiskRules(path); err != nil || n != 5 {
+		t.Fatalf("expected 5 rules, got %d, %v", n, err)
+	}
+
+	for _, c := range []struct {
+		ev    models.AgentEvent
+		label string
+		score int
+	}{
+		{models.AgentEvent{ActionType: models.ActionFileWrite, Target: "/src/app/db/migrations/0042_users.sql"}, "migration changed", 70},
+		{models.AgentEvent{ActionType: models.ActionExec, Agent: models.AgentCodex, Target: "kubectl delete ns prod"}, "kubectl delete", 90},
+		{models.AgentEvent{ActionType: models.ActionExec, Agent: models.AgentClaude, Target: "kubectl delete ns prod"}, "", 0},
+		{models.AgentEvent{ActionType: models.ActionNetConnect, Target: "104.20.1.1:443", Domain: "api.pastebin.com"}, "pastebin upload", 85},
+		{models.AgentEvent{ActionType: models.ActionExec, Target: "git push origin main"}, "git push", 20},
+		{models.AgentEvent{ActionType: models.ActionExec, Target: "curl https://example.com"}, "", 0},
+	} {
+		score, labels := attribution.ScoreEvent(&c.ev)
+		if score != c.score || c.label != "" && !slices.Contains(labels, c.label) {
+			t.Errorf("%s %q: got %d %v, want %d with %q", c.ev.ActionType, c.ev.Target, score, labels, c.score, c.label)
+		}
+	}
+
+	// A file that stops validating leaves the rules in effect alone.
+	if err := os.WriteFile(path, []byte("[[rules]]\nlabel = \"x\"\nscore = 10\nargv = ['(']\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRiskRules(path); err == nil {
+		t.Fatal("expected an invalid regular expression to be rejected")
+	}
+	if _, labels := attribution.ScoreEvent(&models.AgentEvent{ActionType: models.ActionExec, Agent: models.AgentCodex, Target: "kubectl delete pod x"}); !slices.Contains(labels, "kubectl delete") {
+		t.Fatalf("expected previous rules to stay in effect, got %v", labels)
+	}
+}
+
+func TestLoadRiskRules_RejectsInvalidRules(t *testing.T) {
+	t.Cleanup(func() { _ = attribution.LoadRiskRules(nil) })
+	for want, rule := range map[string]string{
+		"unknown key":        "label = \"a\"\nscore = 10\npath = [\"x\"]",
+		"unknown action":     "label = \"a\"\nscore = 10\nactions = [\"WRITE\"]",
+		"outside 0-100":      "label = \"a\"\nscore = 300\nactions = [\"EXEC\"]",
+		"severity":           "label = \"a\"\nscore = 10\nseverity = \"urgent\"\nactions = [\"EXEC\"]",
+		"no conditions":      "label = \"a\"\nscore = 10",
+		"label is required":  "score = 10\nactions = [\"EXEC\"]",
+		"unterminated":       "label = \"a\"\nscore = 10\npaths = [\"[abc\"]",
+		"only a leading *. ": "label = \"a\"\nscore = 10\ndomains = [\"api.*.com\"]",
+		"defined twice":      "label = \"a\"\nscore = 10\nactions = [\"EXEC\"]\n[[rules]]\nlabel = \"a\"\nscore = 20\nactions = [\"EXEC\"]",
+	} {
+		path := filepath.Join(t.TempDir(), "rules.toml")
+		if err := os.WriteFile(path, []byte("[[rules]]\n"+rule+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRiskRules(path); err == nil || !strings.Contains(err.Error(), strings.TrimSpace(want)) {
+			t.Errorf("%s: got %v", want, err)
+		}
+	}
+	if n, err := LoadRiskRules(filepath.Join(t.TempDir(), "missing.toml")); err != nil || n != 0 {
+		t.Fatalf("expected a missing file to leave the built-in rules, got %d, %v", n, err)
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	for glob, cases := range map[string]map[string]bool{
+		"migrations/**":    {"/r/migrations/1.sql": true, "/r/db/migrations/a/b.sql": true, "/r/migrations.sql": false},
+		"*.pem":            {"/home/u/cert.pem": true, "/home/u/cert.pem.bak": false},
+		"/etc/**/*.conf":   {"/etc/nginx/nginx.conf": true, "/etc/a.conf": true, "/opt/etc/a.conf": false},
+		"**/.github/*.yml": {"/r/.github/ci.yml": true, "/r/.github/workflows/ci.yml": false},
+		"Dockerfile.[!d]*": {"/r/Dockerfile.prod": true, "/r/Dockerfile.dev": false},
+		"terraform/?.tf":   {"/r/terraform/a.tf": true, "/r/terraform/ab.tf": false},
+	} {
+		re, err := globRegexp(glob)
+		if err != nil {
+			t.Fatalf("%s: %v", glob, err)
+		}
+		for path, want := range cases {
+			if got := re.MatchString(path); got != want {
+				t.Errorf("%s on %s: got %v, want %v", glob, path, got, want)
+			}
+		}
+	}
+}
+
+func TestWatchRules_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	if err := os.WriteFile(path, []byte("[[rules]]\nlabel = \"terraform apply\"\nscore = 50\nargv = ['^terraform apply']\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = attribution.LoadRiskRules(nil) })
+	if _, err := LoadRiskRules(path); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Daemon{}
+	d.cfg.Risk.RulesFile = path
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	defer func() { d.cancel(); d.wg.Wait() }()
+	d.watchRules()
+
+	// Replace the file the way editors do.
+	tmp := path + ".tmp"
+	rule := "[[rules]]\nlabel = \"infra applied\"\nscore = 50\nargv = ['^terraform apply']\n"
+	if err := os.WriteFile(tmp, []byte(rule), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	ev := &models.AgentEvent{ActionType: models.ActionExec, Target: "terraform apply -auto-approve"}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if _, labels := attribution.ScoreEvent(ev); slices.Contains(labels, "infra applied") {
+			return
+		}
+	}
+	t.Fatal("expected the changed rules file to be reloaded")
+}
@@ -0,0 +1,340 @@
+// Package dnsproxy is a small DNS forwarder that reports every address
+// answer it relays, so connections can be named by the host the client
+// actually asked for rather than by a reverse lookup.
+package dnsproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DefaultListen   = "127.0.0.153:53"
+	upstreamTimeout = 5 * time.Second
+	maxMessage      = 65535
+)
+
+// Answer is one A or AAAA record relayed to a client.
+type Answer struct {
+	// Name is the name in the question, without the trailing dot. CNAME
+	// chains are collapsed onto it.
+	Name string
+	IP   string
+	TTL  time.Duration
+	At   time.Time
+	// Client is the querying socket and Network is "udp" or "tcp".
+	Client  net.Addr
+	Network string
+	// PID and ProcessName identify the asker when Owner could name it.
+	PID         int
+	ProcessName string
+}
+
+type Config struct {
+	// Listen is the address to serve on, over both UDP and TCP.
+	Listen string
+	// Upstream is the resolver queries are relayed to; empty means the
+	// first usable nameserver in /etc/resolv.conf.
+	Upstream string
+	// OnAnswer receives every address answer. It is called after the
+	// reply has been sent.
+	OnAnswer func(Answer)
+	// Owner names the process behind a client socket. It runs while the
+	// query is in flight, before the client can close its socket.
+	Owner func(network string, client net.Addr) (pid int, processName string)
+}
+
+type Forwarder struct {
+	cfg Config
+	udp *net.UDPConn
+	tcp net.Listener
+	wg  sync.WaitGroup
+}
+
+func New(cfg Config) *Forwarder {
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultListen
+	}
+	return &Forwarder{cfg: cfg}
+}
+
+// Start binds UDP and TCP on the same address and serves until ctx is done.
+func (f *Forwarder) Start(ctx context.Context) error {
+	if f.cfg.Upstream == "" {
+		up, err := systemUpstream("/etc/resolv.conf", f.cfg.Listen)
+		if err != nil {
+			return err
+		}
+		f.cfg.Upstream = up
+	}
+	uaddr, err := net.ResolveUDPAddr("udp", f.cfg.Listen)
+	if err != nil {
+		return err
+	}
+	udp, err := net.ListenUDP("udp", uaddr)
+	if err != nil {
+		return err
+	}
+	// Bind TCP to the port UDP got, which matters when Listen used port 0.
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		_ = udp.Close()
+		return err
+	}
+	f.udp, f.tcp = udp, tcp
+	f.wg.Add(3)
+	go func() {
+		defer f.wg.Done()
+		<-ctx.Done()
+		_ = udp.Close()
+		_ = tcp.Close()
+	}()
+	go f.serveUDP()
+	go f.serveTCP()
+	return nil
+}
+
+// Addr is the bound address once Start has succeeded.
+func (f *Forwarder) Addr() string {
+	if f.udp == nil {
+		return ""
+	}
+	return f.udp.LocalAddr().String()
+}
+
+// Wait blocks until the listeners have shut down.
+func (f *Forwarder) Wait() { f.wg.Wait() }
+
+func (f *Forwarder) serveUDP() {
+	defer f.wg.Done()
+	buf := make([]byte, maxMessage)
+	for {
+		n, client, err := f.udp.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			owner := f.lookupOwner("udp", client)
+			resp, err := f.exchange("udp", query)
+			if err != nil {
+				return
+			}
+			_, _ = f.udp.WriteToUDP(resp, client)
+			f.record("udp", client, resp, owner)
+		}()
+	}
+}
+
+func (f *Forwarder) serveTCP() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go f.handleTCP(conn)
+	}
+}
+
+func (f *Forwarder) handleTCP(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		query, err := readTCPMessage(r)
+		if err != nil {
+			return
+		}
+		owner := f.lookupOwner("tcp", conn.RemoteAddr())
+		resp, err := f.exchange("tcp", query)
+		if err != nil {
+			return
+		}
+		if err := writeTCPMessage(conn, resp); err != nil {
+			return
+		}
+		f.record("tcp", conn.RemoteAddr(), resp, owner)
+	}
+}
+
+type owner struct {
+	done chan struct{}
+	pid  int
+	name string
+}
+
+func (f *Forwarder) lookupOwner(network string, client net.Addr) *owner {
+	o := &owner{done: make(chan struct{})}
+	if f.cfg.Owner == nil {
+		close(o.done)
+		return o
+	}
+	go func() {
+		defer close(o.done)
+		o.pid, o.name = f.cfg.Owner(network, client)
+	}()
+	return o
+}
+
+func (f *Forwarder) exchange(network string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, f.cfg.Upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(upstreamTimeout))
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(bufio.NewReader(conn))
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessage)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (f *Forwarder) record(network string, client net.Addr, resp []byte, o *owner) {
+	if f.cfg.OnAnswer == nil {
+		return
+	}
+	answers := parseAnswers(resp)
+	if len(answers) == 0 {
+		return
+	}
+	<-o.done
+	now := time.Now()
+	for _, a := range answers {
+		a.At = now
+		a.Client = client
+		a.Network = network
+		a.PID = o.pid
+		a.ProcessName = o.name
+		f.cfg.OnAnswer(a)
+	}
+}
+
+// parseAnswers extracts A and AAAA records from a response and attributes
+// them to the question name, following CNAMEs within the answer section.
+func parseAnswers(resp []byte) []Answer {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil || !h.Response || h.RCode != dnsmessage.RCodeSuccess {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil
+	}
+	asked := strings.ToLower(q.Name.String())
+	// aliases maps every name in the CNAME chain back to the asked name.
+	aliases := map[string]bool{asked: true}
+	var out []Answer
+	for {
+		rh, err := p.AnswerHeader()
+		if err != nil {
+			break
+		}
+		owner := strings.ToLower(rh.Name.String())
+		ttl := time.Duration(rh.TTL) * time.Second
+		switch rh.Type {
+		case dnsmessage.TypeCNAME:
+			r, err := p.CNAMEResource()
+			if err != nil {
+				return out
+			}
+			if aliases[owner] {
+				aliases[strings.ToLower(r.CNAME.String())] = true
+			}
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return out
+			}
+			if aliases[owner] {
+				out = append(out, Answer{Name: strings.TrimSuffix(asked, "."), IP: net.IP(r.A[:]).String(), TTL: ttl})
+			}
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return out
+			}
+			if aliases[owner] {
+				out = append(out, Answer{Name: strings.TrimSuffix(asked, "."), IP: net.IP(r.AAAA[:]).String(), TTL: ttl})
+			}
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// systemUpstream picks the first nameserver in resolv.conf that is not the
+// forwarder itself, so pointing resolv.conf at kai does not loop.
+func systemUpstream(path, listen string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	self, _, _ := net.SplitHostPort(listen)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		ip := strings.SplitN(fields[1], "%", 2)[0]
+		if ip == self || net.ParseIP(ip) == nil {
+			continue
+		}
+		return net.JoinHostPort(ip, "53"), nil
+	}
+	return "", errors.New("no upstream nameserver in " + path)
+}
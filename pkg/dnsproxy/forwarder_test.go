@@ -0,0 +1,169 @@
+package dnsproxy
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeUpstream answers every A query for api.anthropic.com with a CNAME to
+// a CDN name and one address for it, over both UDP and TCP.
+func fakeUpstream(t *testing.T, ctx context.Context) string {
+	t.Helper()
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = udp.Close()
+		_ = tcp.Close()
+	}()
+	go func() {
+		buf := make([]byte, maxMessage)
+		for {
+			n, client, err := udp.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udp.WriteToUDP(fakeAnswer(t, buf[:n]), client)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			q, err := readTCPMessage(bufio.NewReader(conn))
+			if err == nil {
+				_ = writeTCPMessage(conn, fakeAnswer(t, q))
+			}
+			_ = conn.Close()
+		}
+	}()
+	return udp.LocalAddr().String()
+}
+
+func fakeAnswer(t *testing.T, query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	cdn := dnsmessage.MustNewName("edge.cdn.example.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, RCode: dnsmessage.RCodeSuccess})
+	_ = b.StartQuestions()
+	_ = b.Question(q)
+	_ = b.StartAnswers()
+	_ = b.CNAMEResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 30}, dnsmessage.CNAMEResource{CNAME: cdn})
+	_ = b.AResource(dnsmessage.ResourceHeader{Name: cdn, Class: dnsmessage.ClassINET, TTL: 30}, dnsmessage.AResource{A: [4]byte{160, 79, 104, 10}})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Error(err)
+	}
+	return msg
+}
+
+func query(t *testing.T, id uint16, name string) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	_ = b.StartQuestions()
+	_ = b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestForwarder_RecordsAnswersWithAsker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	answers := make(chan Answer, 4)
+	fwd := New(Config{
+		Listen:   "127.0.0.1:0",
+		Upstream: fakeUpstream(t, ctx),
+		OnAnswer: func(a Answer) { answers <- a },
+		Owner:    func(network string, client net.Addr) (int, string) { return 4242, "claude" },
+	})
+	if err := fwd.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		conn, err := net.Dial(network, fwd.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		var resp []byte
+		if network == "tcp" {
+			if err := writeTCPMessage(conn, query(t, 7, "api.anthropic.com.")); err != nil {
+				t.Fatal(err)
+			}
+			resp, err = readTCPMessage(bufio.NewReader(conn))
+		} else {
+			if _, err := conn.Write(query(t, 7, "api.anthropic.com.")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, maxMessage)
+			var n int
+			n, err = conn.Read(buf)
+			resp = buf[:n]
+		}
+		_ = conn.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", network, err)
+		}
+		if got := parseAnswers(resp); len(got) != 1 {
+			t.Fatalf("%s: client got %+v", network, got)
+		}
+
+		select {
+		case a := <-answers:
+			if a.Name != "api.anthropic.com" || a.IP != "160.79.104.10" || a.TTL != 30*time.Second {
+				t.Fatalf("%s: unexpected answer %+v", network, a)
+			}
+			if a.Network != network || a.PID != 4242 || a.ProcessName != "claude" || a.At.IsZero() || a.Client == nil {
+				t.Fatalf("%s: unexpected asker %+v", network, a)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no answer recorded", network)
+		}
+	}
+
+	cancel()
+	fwd.Wait()
+}
+
+func TestSystemUpstream_SkipsSelf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	conf := "# generated\nsearch lan\nnameserver 127.0.0.153\nnameserver fe80::1%eth0\nnameserver 10.0.0.1\n"
+	if err := os.WriteFile(path, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := systemUpstream(path, "127.0.0.153:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "[fe80::1]:53" {
+		t.Fatalf("systemUpstream got %q", got)
+	}
+}
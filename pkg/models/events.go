@@ -1,7 +1,12 @@
 package models
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
+// AgentID names an agent. The constants are the built-in agents; config
+// can define more.
 type AgentID string
 
 const (
@@ -15,6 +20,49 @@ const (
 	AgentUnknown  AgentID = "unknown"
 )
 
+// AttributionMethod says how an event's agent was chosen.
+type AttributionMethod string
+
+const (
+	// AttrPinned: the process runs under a kai exec root.
+	AttrPinned AttributionMethod = "pinned"
+	// AttrHook: a shell hook reported the command with an agent marker.
+	AttrHook AttributionMethod = "hook"
+	// AttrEnv: an agent marker in the process environment.
+	AttrEnv AttributionMethod = "env"
+	// AttrProcess: the process itself matches an agent signature.
+	AttrProcess AttributionMethod = "process"
+	// AttrAncestor: a parent process matches an agent signature.
+	AttrAncestor AttributionMethod = "ancestor"
+	// AttrDomain: the connection's host is an agent's domain.
+	AttrDomain AttributionMethod = "domain"
+	// AttrDNS: the connection's address resolved from an agent's domain.
+	AttrDNS AttributionMethod = "dns"
+	// AttrWorkspace: no process evidence; the file lies in a directory
+	// an active session works in.
+	AttrWorkspace AttributionMethod = "workspace"
+)
+
+// Attribution explains an event's agent. Confidence runs from 0 to 100;
+// Detail names what matched, such as a marker, ancestor or domain.
+type Attribution struct {
+	Method     AttributionMethod
+	Confidence int
+	Detail     string
+}
+
+// String renders the attribution compactly, e.g. "ancestor:codex(412) 80%".
+func (a Attribution) String() string {
+	if a.Method == "" {
+		return ""
+	}
+	s := string(a.Method)
+	if a.Detail != "" {
+		s += ":" + a.Detail
+	}
+	return s + " " + strconv.Itoa(a.Confidence) + "%"
+}
+
 type ActionType string
 
 const (
@@ -22,8 +70,16 @@ const (
 	ActionFileWrite  ActionType = "FILE_WRITE"
 	ActionFileCreate ActionType = "FILE_CREATE"
 	ActionFileDelete ActionType = "FILE_DELETE"
+	ActionFileRename ActionType = "FILE_RENAME"
+	ActionFileRead   ActionType = "FILE_READ"
 	ActionNetConnect ActionType = "NET_CONNECT"
+	ActionNetListen  ActionType = "NET_LISTEN"
+	ActionNetClose   ActionType = "NET_CLOSE"
 	ActionProcSpawn  ActionType = "PROC_SPAWN"
+	ActionProcExit   ActionType = "PROC_EXIT"
+	// ActionCorrelated is a synthetic event raised when a session's events
+	// together match a sequence rule.
+	ActionCorrelated ActionType = "CORRELATED"
 )
 
 type FileChangeType string
@@ -32,6 +88,7 @@ const (
 	FileCreated  FileChangeType = "CREATED"
 	FileModified FileChangeType = "MODIFIED"
 	FileDeleted  FileChangeType = "DELETED"
+	FileRenamed  FileChangeType = "RENAMED"
 )
 
 type Session struct {
@@ -63,7 +120,51 @@ type RawEvent struct {
 	ActionType  ActionType
 	Target      string
 	ExecArgs    []string
-	Platform    string
+	// Exe is the path of the process's executable, when known.
+	Exe string
+	CWD string
+	// OldPath is the previous name of a FILE_RENAME; Target is the new one.
+	OldPath string
+	// Protocol is "tcp" or "udp" for network events; empty means tcp.
+	Protocol string
+	// UID is the real user ID of the process, or -1 when unknown. Sources
+	// must set -1 explicitly: the zero value is root.
+	UID      int
+	Platform string
+	// StartTime is the process start time when the collector knows it.
+	// Together with PID it identifies one process across PID reuse.
+	StartTime time.Time
+	// FlowID links a NET_CONNECT or NET_LISTEN event to the NET_CLOSE
+	// emitted when the socket goes away, which carries the byte counts.
+	FlowID    string
+	BytesSent int64
+	BytesRecv int64
+	// ExitCode and ExitSignal describe a PROC_EXIT. ExitCode is -1 when the
+	// collector only noticed the process was gone; ExitSignal is the
+	// signal that killed it, or 0.
+	ExitCode   int
+	ExitSignal int
+	// ContainerID and ContainerImage are set for processes running in a
+	// container; CWD is then already translated to the host path.
+	ContainerID    string
+	ContainerImage string
+	// Reported is set for a command reported by a shell hook rather than
+	// seen by a collector; PID is then the shell that ran it.
+	Reported *ShellReport
+}
+
+// ShellReport is a shell hook's account of a command, sent once it
+// finished. Agent is set when the hook found the marker variable Marker.
+type ShellReport struct {
+	Agent  AgentID
+	Marker string
+	Exit   ExecExit
+}
+
+// ProcessRef names one process in an AgentEvent's ancestry.
+type ProcessRef struct {
+	PID         int
+	ProcessName string
 }
 
 // AgentEvent is a classified event emitted by the attribution engine.
@@ -75,11 +176,34 @@ type AgentEvent struct {
 	ActionType  ActionType
 	Target      string
 	ExecArgs    []string
+	CWD         string
+	OldPath     string
+	Protocol    string
 	RiskScore   int
 	RiskLabels  []string
 	PID         int
 	ProcessName string
 	Platform    string
+	// Ancestry lists the event process's parents, nearest first.
+	Ancestry       []ProcessRef
+	ContainerID    string
+	ContainerImage string
+	Attribution    Attribution
+	// Domain is the name a connection's address was resolved from, when
+	// known.
+	Domain string
+	// Triggers are the events a CORRELATED event was raised for, oldest
+	// first.
+	Triggers []EventRef
+}
+
+// EventRef identifies an event and says enough about it to show without
+// looking it up; file changes are not stored one event at a time.
+type EventRef struct {
+	ID         string
+	Timestamp  time.Time
+	ActionType ActionType
+	Target     string
 }
 
 type ExecEvent struct {
@@ -91,12 +215,87 @@ type ExecEvent struct {
 	CWD        string
 	RiskScore  int
 	RiskLabels []string
+	// Exit is set once the command's process has exited.
+	Exit           *ExecExit
+	ContainerID    string
+	ContainerImage string
+	Attribution    Attribution
+}
+
+// ExecExit is how an executed command ended.
+type ExecExit struct {
+	// Code is the exit status, or -1 when unknown or killed by a signal.
+	Code     int
+	Signal   int
+	Duration time.Duration
+}
+
+// ReadEvent is a process opening one of the configured sensitive files.
+type ReadEvent struct {
+	ID          string
+	SessionID   string
+	Timestamp   time.Time
+	Path        string
+	PID         int
+	ProcessName string
+	RiskScore   int
+	RiskLabels  []string
+	Attribution Attribution
+}
+
+// UnattributedEvent is a file change that no agent was charged with, kept
+// so replay can show it. Reason says why no agent owned it.
+type UnattributedEvent struct {
+	ID          string
+	Timestamp   time.Time
+	Action      ActionType
+	Path        string
+	PID         int
+	ProcessName string
+	Reason      string
+}
+
+// CorrelatedEvent is a sequence rule matched by a session's events.
+type CorrelatedEvent struct {
+	ID          string
+	SessionID   string
+	Timestamp   time.Time
+	Rule        string
+	RiskScore   int
+	Triggers    []EventRef
+	Attribution Attribution
+}
+
+// Transcript is the terminal output of an agent started with kai exec.
+type Transcript struct {
+	ID        string
+	SessionID string
+	Agent     AgentID
+	PID       int
+	Command   string
+	StartedAt time.Time
+	EndedAt   time.Time
+	ExitCode  int
+	Content   []byte
+	// Marks timestamp the output: Content[Offset:] was written at At.
+	Marks []TranscriptMark
+	// Truncated is set when output beyond the capture limit was dropped.
+	Truncated bool
 }
 
+type TranscriptMark struct {
+	Offset int
+	At     time.Time
+}
+
+// NetEvent is an outbound connection, or for ActionNetListen a bound socket,
+// in which case RemoteIP and RemotePort hold the local bind address.
 type NetEvent struct {
 	ID           string
 	SessionID    string
 	Timestamp    time.Time
+	EndedAt      *time.Time
+	Action       ActionType
 	RemoteIP     string
 	RemotePort   int
 	Domain       *string
@@ -105,6 +304,7 @@ type NetEvent struct {
 	BytesRecv    int64
 	IsAIEndpoint bool
 	RiskScore    int
+	Attribution  Attribution
 }
 
 // SessionFile is one aggregated row per (session_id, file_path).
@@ -120,6 +320,10 @@ type SessionFile struct {
 	LastSeen     time.Time
 	SnapshotID   *string
 	IsRedacted   bool
+	// OldPath is the name the file had before it was renamed this session.
+	OldPath string
+	// Attribution is the weakest one among the file's events.
+	Attribution Attribution
 }
 
 type Snapshot struct {
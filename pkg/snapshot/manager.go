@@ -32,6 +32,7 @@ type pendingFile struct {
 	sessionID  string
 	filePath   string
 	changeType models.FileChangeType
+	oldPath    string
 	firstSeen  time.Time
 	lastSeen   time.Time
 	eventCount int
@@ -39,6 +40,8 @@ type pendingFile struct {
 	beforeHash *string
 	quietTimer *time.Timer
 	forceTimer *time.Timer
+	// attribution is the least confident one among the file's events.
+	attribution models.Attribution
 }
 
 type Manager struct {
@@ -52,7 +55,7 @@ func NewManager(store *storage.DB, cfg Config) *Manager {
 	return &Manager{store: store, cfg: cfg, pending: map[string]*pendingFile{}}
 }
 
-func (m *Manager) OnFileEvent(sessionID, path string, changeType models.FileChangeType) {
+func (m *Manager) OnFileEvent(sessionID, path string, changeType models.FileChangeType, attr models.Attribution) {
 	if !m.cfg.SnapshotEnabled || m.isPrivacyPath(path) || m.isSkippedExtension(path) {
 		return
 	}
@@ -62,12 +65,15 @@ func (m *Manager) OnFileEvent(sessionID, path string, changeType models.FileChan
 	pf, ok := m.pending[key]
 	if !ok {
 		before := m.readBefore(sessionID, path)
-		pf = &pendingFile{sessionID: sessionID, filePath: path, changeType: changeType, firstSeen: time.Now(), beforeText: before, beforeHash: hashOf(before)}
+		pf = &pendingFile{sessionID: sessionID, filePath: path, changeType: changeType, firstSeen: time.Now(), beforeText: before, beforeHash: hashOf(before), attribution: attr}
 		m.pending[key] = pf
 		pf.forceTimer = time.AfterFunc(MaxQuietPeriod, func() { m.flush(key) })
 	}
 	pf.lastSeen = time.Now()
 	pf.eventCount++
+	if attr.Method != "" && (pf.attribution.Method == "" || attr.Confidence < pf.attribution.Confidence) {
+		pf.attribution = attr
+	}
 	if pf.quietTimer != nil {
 		pf.quietTimer.Stop()
 	}
@@ -75,11 +81,46 @@ func (m *Manager) OnFileEvent(sessionID, path string, changeType models.FileChan
 	m.mu.Unlock()
 }
 
-func (m *Manager) OnFileDelete(sessionID, path string) {
-	m.OnFileEvent(sessionID, path, models.FileDeleted)
+func (m *Manager) OnFileDelete(sessionID, path string, attr models.Attribution) {
+	m.OnFileEvent(sessionID, path, models.FileDeleted, attr)
 	m.flush(sessionID + ":" + path)
 }
 
+// OnFileRename moves oldPath's history in the session over to newPath.
+// Renaming a file created this session, typically an editor's temp file
+// being moved into place, is recorded as a write to newPath instead, as is
+// replacing a file the session already touched.
+func (m *Manager) OnFileRename(sessionID, oldPath, newPath string, attr models.Attribution) {
+	if !m.cfg.SnapshotEnabled {
+		return
+	}
+	m.flush(sessionID + ":" + oldPath)
+	m.flush(sessionID + ":" + newPath)
+	if m.isPrivacyPath(newPath) || m.isSkippedExtension(newPath) {
+		return
+	}
+	oldChange, tracked := m.store.SessionFileChange(sessionID, oldPath)
+	_, replaced := m.store.SessionFileChange(sessionID, newPath)
+	switch {
+	case tracked && oldChange == models.FileCreated, !tracked && replaced:
+		_ = m.store.DeleteSessionFile(sessionID, oldPath)
+		change := models.FileCreated
+		if replaced {
+			change = models.FileModified
+		}
+		m.OnFileEvent(sessionID, newPath, change, attr)
+		m.flush(sessionID + ":" + newPath)
+	case tracked:
+		_, _ = m.store.RenameSessionFile(sessionID, oldPath, newPath, time.Now())
+	default:
+		// A rename does not change content, so the file starts out as its
+		// own before text.
+		content := readFile(newPath, m.cfg.MaxSnapshotSizeBytes)
+		now := time.Now()
+		m.commitSnapshot(&pendingFile{sessionID: sessionID, filePath: newPath, changeType: models.FileRenamed, oldPath: oldPath, firstSeen: now, lastSeen: now, eventCount: 1, beforeText: content, beforeHash: hashOf(content), attribution: attr})
+	}
+}
+
 func (m *Manager) FlushAll() {
 	m.mu.Lock()
 	keys := make([]string, 0, len(m.pending))
@@ -110,7 +151,8 @@ func (m *Manager) commitSnapshot(pf *pendingFile) {
 	beforeHash := pf.beforeHash
 	afterHash := hashOf(after)
 
-	if beforeHash != nil && afterHash != nil && *beforeHash == *afterHash {
+	unchanged := beforeHash != nil && afterHash != nil && *beforeHash == *afterHash
+	if unchanged {
 		before = nil
 		beforeHash = nil
 	}
@@ -130,17 +172,22 @@ func (m *Manager) commitSnapshot(pf *pendingFile) {
 	}
 
 	linesAdded, linesRemoved := lineDelta(before, after)
+	if unchanged {
+		linesAdded, linesRemoved = 0, 0
+	}
 	sf := &models.SessionFile{
 		ID:           utils.NewID("sf"),
 		SessionID:    pf.sessionID,
 		FilePath:     pf.filePath,
 		ChangeType:   pf.changeType,
+		OldPath:      pf.oldPath,
 		LinesAdded:   linesAdded,
 		LinesRemoved: linesRemoved,
 		SaveCount:    pf.eventCount,
 		FirstSeen:    pf.firstSeen,
 		LastSeen:     pf.lastSeen,
 		IsRedacted:   redacted,
+		Attribution:  pf.attribution,
 	}
 
 	snap := &models.Snapshot{
@@ -29,7 +29,7 @@ func TestManager_SkipsEnvFiles(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	m.OnFileEvent(s.ID, envPath, models.FileModified)
+	m.OnFileEvent(s.ID, envPath, models.FileModified, models.Attribution{})
 	m.FlushAll()
 
 	r, err := db.GetReplay(s.ID)
@@ -40,3 +40,74 @@ func TestManager_SkipsEnvFiles(t *testing.T) {
 		t.Fatalf("expected no session files for .env snapshot, got %d", len(r.Files))
 	}
 }
+
+func TestManager_OnFileRename(t *testing.T) {
+	tmp := t.TempDir()
+	db, err := storage.Open(filepath.Join(tmp, "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &models.Session{ID: "cs_test", Agent: models.AgentClaude, StartedAt: time.Now(), LastActivity: time.Now()}
+	if err := db.InsertSession(s); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(db, Config{SnapshotEnabled: true, MaxSnapshotSizeBytes: 50 * 1024, SkipExtensions: map[string]struct{}{".tmp": {}}})
+	path := func(name string) string { return filepath.Join(tmp, name) }
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(path(name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	move := func(from, to string) {
+		t.Helper()
+		if err := os.Rename(path(from), path(to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An edited file renamed later keeps its history under the new name.
+	write("a.go", "one\ntwo\n")
+	m.OnFileEvent(s.ID, path("a.go"), models.FileModified, models.Attribution{})
+	write("a.go", "one\ntwo\nthree\n")
+	m.OnFileEvent(s.ID, path("a.go"), models.FileModified, models.Attribution{})
+	move("a.go", "b.go")
+	m.OnFileRename(s.ID, path("a.go"), path("b.go"), models.Attribution{})
+
+	// A file renamed without edits gets a fresh entry with no line changes.
+	write("c.go", "x\n")
+	move("c.go", "d.go")
+	m.OnFileRename(s.ID, path("c.go"), path("d.go"), models.Attribution{})
+
+	// Saving through a temp file is a write to the target, not a rename.
+	write("e.go", "v1\n")
+	m.OnFileEvent(s.ID, path("e.go"), models.FileModified, models.Attribution{})
+	m.FlushAll()
+	write("e.go.tmp", "v1\nv2\n")
+	m.OnFileEvent(s.ID, path("e.go.tmp"), models.FileCreated, models.Attribution{})
+	move("e.go.tmp", "e.go")
+	m.OnFileRename(s.ID, path("e.go.tmp"), path("e.go"), models.Attribution{})
+	m.FlushAll()
+
+	r, err := db.GetReplay(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]models.SessionFile{}
+	for _, f := range r.Files {
+		files[filepath.Base(f.FilePath)] = f
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected b.go, d.go and e.go, got %+v", r.Files)
+	}
+	if b := files["b.go"]; b.ChangeType != models.FileRenamed || b.OldPath != path("a.go") || r.Snapshots[b.ID] == nil {
+		t.Fatalf("expected a.go's history under b.go, got %+v", b)
+	}
+	if d := files["d.go"]; d.ChangeType != models.FileRenamed || d.OldPath != path("c.go") || d.LinesAdded != 0 || d.LinesRemoved != 0 {
+		t.Fatalf("expected a plain rename of c.go, got %+v", d)
+	}
+	if e := files["e.go"]; e.ChangeType != models.FileModified || e.OldPath != "" || e.LinesAdded != 1 {
+		t.Fatalf("expected the temp-file save to modify e.go, got %+v", e)
+	}
+}
@@ -36,7 +36,15 @@ CREATE TABLE IF NOT EXISTS events_exec (
     args        TEXT,
     cwd         TEXT,
     risk_score  INTEGER DEFAULT 0,
-    risk_labels TEXT
+    risk_labels TEXT,
+    exit_code   INTEGER,
+    exit_signal INTEGER,
+    duration_ms INTEGER,
+    container_id    TEXT,
+    container_image TEXT,
+    attribution        TEXT,
+    attribution_detail TEXT,
+    confidence         INTEGER
 );
 
 CREATE INDEX IF NOT EXISTS idx_exec_session
@@ -46,6 +54,8 @@ CREATE TABLE IF NOT EXISTS events_net (
     id            TEXT PRIMARY KEY,
     session_id    TEXT NOT NULL REFERENCES sessions(id),
     timestamp     INTEGER NOT NULL,
+    ended_at      INTEGER,
+    action        TEXT DEFAULT 'NET_CONNECT',
     remote_ip     TEXT NOT NULL,
     remote_port   INTEGER NOT NULL,
     domain        TEXT,
@@ -53,12 +63,81 @@ CREATE TABLE IF NOT EXISTS events_net (
     bytes_sent    INTEGER DEFAULT 0,
     bytes_recv    INTEGER DEFAULT 0,
     is_ai_endpoint INTEGER DEFAULT 0,
-    risk_score    INTEGER DEFAULT 0
+    risk_score    INTEGER DEFAULT 0,
+    attribution        TEXT,
+    attribution_detail TEXT,
+    confidence         INTEGER
 );
 
 CREATE INDEX IF NOT EXISTS idx_net_session
     ON events_net(session_id, timestamp);
 
+CREATE TABLE IF NOT EXISTS transcripts (
+    id          TEXT PRIMARY KEY,
+    session_id  TEXT NOT NULL REFERENCES sessions(id),
+    agent       TEXT NOT NULL,
+    pid         INTEGER,
+    command     TEXT,
+    started_at  INTEGER NOT NULL,
+    ended_at    INTEGER NOT NULL,
+    exit_code   INTEGER,
+    content     BLOB,
+    marks       TEXT,
+    truncated   INTEGER DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_transcripts_session
+    ON transcripts(session_id);
+
+CREATE TABLE IF NOT EXISTS events_read (
+    id           TEXT PRIMARY KEY,
+    session_id   TEXT NOT NULL REFERENCES sessions(id),
+    timestamp    INTEGER NOT NULL,
+    path         TEXT NOT NULL,
+    pid          INTEGER,
+    process_name TEXT,
+    risk_score   INTEGER DEFAULT 0,
+    risk_labels  TEXT,
+    attribution        TEXT,
+    attribution_detail TEXT,
+    confidence         INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_read_session
+    ON events_read(session_id, timestamp);
+
+-- File changes no agent was charged with. They belong to no session;
+-- replay shows those made while a session ran.
+CREATE TABLE IF NOT EXISTS events_unattributed (
+    id           TEXT PRIMARY KEY,
+    timestamp    INTEGER NOT NULL,
+    action       TEXT NOT NULL,
+    path         TEXT NOT NULL,
+    pid          INTEGER,
+    process_name TEXT,
+    reason       TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_unattributed_time
+    ON events_unattributed(timestamp);
+
+-- Sequence rules matched by a session's events. triggers holds the
+-- matching events, oldest first.
+CREATE TABLE IF NOT EXISTS events_correlated (
+    id          TEXT PRIMARY KEY,
+    session_id  TEXT NOT NULL REFERENCES sessions(id),
+    timestamp   INTEGER NOT NULL,
+    rule        TEXT NOT NULL,
+    risk_score  INTEGER DEFAULT 0,
+    triggers    TEXT,
+    attribution        TEXT,
+    attribution_detail TEXT,
+    confidence         INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_correlated_session
+    ON events_correlated(session_id, timestamp);
+
 CREATE TABLE IF NOT EXISTS session_files (
     id            TEXT PRIMARY KEY,
     session_id    TEXT NOT NULL REFERENCES sessions(id),
@@ -71,6 +150,10 @@ CREATE TABLE IF NOT EXISTS session_files (
     last_seen     INTEGER NOT NULL,
     snapshot_id   TEXT,
     is_redacted   INTEGER DEFAULT 0,
+    old_path      TEXT,
+    attribution        TEXT,
+    attribution_detail TEXT,
+    confidence         INTEGER,
 
     UNIQUE(session_id, file_path)
 );
@@ -95,5 +178,7 @@ CREATE TABLE IF NOT EXISTS dns_cache (
     ip          TEXT PRIMARY KEY,
     domain      TEXT NOT NULL,
     resolved_at INTEGER NOT NULL,
-    ttl_seconds INTEGER DEFAULT 300
+    ttl_seconds INTEGER DEFAULT 300,
+    asked_by_pid     INTEGER,
+    asked_by_process TEXT
 );
@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"bytes"
+	"compress/gzip"
 	"database/sql"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -23,11 +27,17 @@ type DB struct {
 }
 
 type ReplayResult struct {
-	Session   models.Session
-	Files     []models.SessionFile
-	Snapshots map[string]*models.Snapshot
-	Execs     []models.ExecEvent
-	NetEvents []models.NetEvent
+	Session     models.Session
+	Files       []models.SessionFile
+	Snapshots   map[string]*models.Snapshot
+	Execs       []models.ExecEvent
+	NetEvents   []models.NetEvent
+	Reads       []models.ReadEvent
+	Transcripts []models.Transcript
+	// Unattributed are file changes made while the session ran that no
+	// agent was charged with.
+	Unattributed []models.UnattributedEvent
+	Correlated   []models.CorrelatedEvent
 }
 
 func Open(path string) (*DB, error) {
@@ -56,10 +66,71 @@ func Open(path string) (*DB, error) {
 	if _, err := db.Exec(schemaSQL); err != nil {
 		return nil, fmt.Errorf("schema: %w", err)
 	}
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
 
 	return &DB{db: db}, nil
 }
 
+// columnMigrations lists columns added after their table was first shipped.
+// CREATE TABLE IF NOT EXISTS leaves older databases without them.
+var columnMigrations = []struct{ table, column, decl string }{
+	{"events_net", "action", "TEXT DEFAULT 'NET_CONNECT'"},
+	{"events_net", "ended_at", "INTEGER"},
+	{"dns_cache", "asked_by_pid", "INTEGER"},
+	{"dns_cache", "asked_by_process", "TEXT"},
+	{"events_exec", "exit_code", "INTEGER"},
+	{"events_exec", "exit_signal", "INTEGER"},
+	{"events_exec", "duration_ms", "INTEGER"},
+	{"events_exec", "container_id", "TEXT"},
+	{"events_exec", "container_image", "TEXT"},
+	{"session_files", "old_path", "TEXT"},
+	{"events_exec", "attribution", "TEXT"},
+	{"events_exec", "attribution_detail", "TEXT"},
+	{"events_exec", "confidence", "INTEGER"},
+	{"events_net", "attribution", "TEXT"},
+	{"events_net", "attribution_detail", "TEXT"},
+	{"events_net", "confidence", "INTEGER"},
+	{"events_read", "attribution", "TEXT"},
+	{"events_read", "attribution_detail", "TEXT"},
+	{"events_read", "confidence", "INTEGER"},
+	{"session_files", "attribution", "TEXT"},
+	{"session_files", "attribution_detail", "TEXT"},
+	{"session_files", "confidence", "INTEGER"},
+}
+
+func migrate(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		rows, err := db.Query("SELECT name FROM pragma_table_info(?)", m.table)
+		if err != nil {
+			return err
+		}
+		found := false
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			if name == m.column {
+				found = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if found {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.decl)); err != nil {
+			return fmt.Errorf("%s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
 func (d *DB) Close() error { return d.db.Close() }
 
 func ts(t time.Time) int64      { return t.UnixMilli() }
@@ -152,17 +223,77 @@ func (d *DB) CloseSession(s *models.Session) error {
 
 func (d *DB) InsertExecEvent(e *models.ExecEvent) error {
 	_, err := d.db.Exec(`
-		INSERT INTO events_exec (id, session_id, timestamp, command, args, cwd, risk_score, risk_labels)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, e.ID, e.SessionID, ts(e.Timestamp), e.Command, mustJSON(e.Args), e.CWD, e.RiskScore, mustJSON(e.RiskLabels))
+		INSERT INTO events_exec (id, session_id, timestamp, command, args, cwd, risk_score, risk_labels, container_id, container_image, attribution, attribution_detail, confidence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.SessionID, ts(e.Timestamp), e.Command, mustJSON(e.Args), e.CWD, e.RiskScore, mustJSON(e.RiskLabels), e.ContainerID, e.ContainerImage,
+		nullIfEmpty(string(e.Attribution.Method)), nullIfEmpty(e.Attribution.Detail), nullConfidence(e.Attribution))
+	return err
+}
+
+// UpdateExecExit records how an executed command ended.
+func (d *DB) UpdateExecExit(id string, exit models.ExecExit) error {
+	_, err := d.db.Exec(`UPDATE events_exec SET exit_code=?, exit_signal=?, duration_ms=? WHERE id=?`, exit.Code, exit.Signal, exit.Duration.Milliseconds(), id)
+	return err
+}
+
+// UpdateNetFlow records when a connection closed and how many bytes it
+// carried.
+func (d *DB) UpdateNetFlow(id string, endedAt time.Time, sent, recv int64) error {
+	_, err := d.db.Exec(`UPDATE events_net SET ended_at=?, bytes_sent=?, bytes_recv=? WHERE id=?`, ts(endedAt), sent, recv, id)
 	return err
 }
 
 func (d *DB) InsertNetEvent(e *models.NetEvent) error {
+	action := e.Action
+	if action == "" {
+		action = models.ActionNetConnect
+	}
 	_, err := d.db.Exec(`
-		INSERT INTO events_net (id, session_id, timestamp, remote_ip, remote_port, domain, protocol, bytes_sent, bytes_recv, is_ai_endpoint, risk_score)
+		INSERT INTO events_net (id, session_id, timestamp, action, remote_ip, remote_port, domain, protocol, bytes_sent, bytes_recv, is_ai_endpoint, risk_score, attribution, attribution_detail, confidence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.SessionID, ts(e.Timestamp), string(action), e.RemoteIP, e.RemotePort, nullStr(e.Domain), e.Protocol, e.BytesSent, e.BytesRecv, boolInt(e.IsAIEndpoint), e.RiskScore,
+		nullIfEmpty(string(e.Attribution.Method)), nullIfEmpty(e.Attribution.Detail), nullConfidence(e.Attribution))
+	return err
+}
+
+func (d *DB) InsertReadEvent(e *models.ReadEvent) error {
+	_, err := d.db.Exec(`
+		INSERT INTO events_read (id, session_id, timestamp, path, pid, process_name, risk_score, risk_labels, attribution, attribution_detail, confidence)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, e.ID, e.SessionID, ts(e.Timestamp), e.RemoteIP, e.RemotePort, nullStr(e.Domain), e.Protocol, e.BytesSent, e.BytesRecv, boolInt(e.IsAIEndpoint), e.RiskScore)
+	`, e.ID, e.SessionID, ts(e.Timestamp), e.Path, e.PID, e.ProcessName, e.RiskScore, mustJSON(e.RiskLabels),
+		nullIfEmpty(string(e.Attribution.Method)), nullIfEmpty(e.Attribution.Detail), nullConfidence(e.Attribution))
+	return err
+}
+
+func (d *DB) InsertUnattributedEvent(e *models.UnattributedEvent) error {
+	_, err := d.db.Exec(`
+		INSERT INTO events_unattributed (id, timestamp, action, path, pid, process_name, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, ts(e.Timestamp), string(e.Action), e.Path, e.PID, e.ProcessName, e.Reason)
+	return err
+}
+
+func (d *DB) InsertCorrelatedEvent(e *models.CorrelatedEvent) error {
+	_, err := d.db.Exec(`
+		INSERT INTO events_correlated (id, session_id, timestamp, rule, risk_score, triggers, attribution, attribution_detail, confidence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, e.SessionID, ts(e.Timestamp), e.Rule, e.RiskScore, mustJSON(e.Triggers),
+		nullIfEmpty(string(e.Attribution.Method)), nullIfEmpty(e.Attribution.Detail), nullConfidence(e.Attribution))
+	return err
+}
+
+// InsertTranscript stores t with its content gzip-compressed.
+func (d *DB) InsertTranscript(t *models.Transcript) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(t.Content)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO transcripts (id, session_id, agent, pid, command, started_at, ended_at, exit_code, content, marks, truncated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.SessionID, string(t.Agent), t.PID, t.Command, ts(t.StartedAt), ts(t.EndedAt), t.ExitCode, buf.Bytes(), mustJSON(t.Marks), boolInt(t.Truncated))
 	return err
 }
 
@@ -173,27 +304,37 @@ func (d *DB) UpsertSessionFile(sf *models.SessionFile, snap *models.Snapshot) er
 	}
 	defer tx.Rollback()
 
+	// Edits after a rename keep the file listed as renamed. The file keeps
+	// the least confident attribution of its changes.
 	_, err = tx.Exec(`
 		INSERT INTO session_files (
-			id, session_id, file_path, change_type, lines_added, lines_removed, save_count, first_seen, last_seen, snapshot_id, is_redacted
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			id, session_id, file_path, change_type, lines_added, lines_removed, save_count, first_seen, last_seen, snapshot_id, is_redacted, old_path,
+			attribution, attribution_detail, confidence
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(session_id, file_path) DO UPDATE SET
-			change_type=excluded.change_type,
+			change_type=CASE WHEN session_files.change_type='RENAMED' AND excluded.change_type='MODIFIED' THEN 'RENAMED' ELSE excluded.change_type END,
 			lines_added=excluded.lines_added,
 			lines_removed=excluded.lines_removed,
 			save_count=excluded.save_count,
 			last_seen=excluded.last_seen,
 			snapshot_id=excluded.snapshot_id,
-			is_redacted=excluded.is_redacted
-	`, sf.ID, sf.SessionID, sf.FilePath, string(sf.ChangeType), sf.LinesAdded, sf.LinesRemoved, sf.SaveCount, ts(sf.FirstSeen), ts(sf.LastSeen), nullStr(sf.SnapshotID), boolInt(sf.IsRedacted))
+			is_redacted=excluded.is_redacted,
+			old_path=COALESCE(session_files.old_path, excluded.old_path),
+			attribution=CASE WHEN session_files.confidence IS NULL OR excluded.confidence < session_files.confidence THEN excluded.attribution ELSE session_files.attribution END,
+			attribution_detail=CASE WHEN session_files.confidence IS NULL OR excluded.confidence < session_files.confidence THEN excluded.attribution_detail ELSE session_files.attribution_detail END,
+			confidence=CASE WHEN session_files.confidence IS NULL OR excluded.confidence < session_files.confidence THEN excluded.confidence ELSE session_files.confidence END
+	`, sf.ID, sf.SessionID, sf.FilePath, string(sf.ChangeType), sf.LinesAdded, sf.LinesRemoved, sf.SaveCount, ts(sf.FirstSeen), ts(sf.LastSeen), nullStr(sf.SnapshotID), boolInt(sf.IsRedacted), nullIfEmpty(sf.OldPath),
+		nullIfEmpty(string(sf.Attribution.Method)), nullIfEmpty(sf.Attribution.Detail), nullConfidence(sf.Attribution))
 	if err != nil {
 		return err
 	}
+	// On conflict the existing row keeps its ID; snapshots must hang off it.
+	if err := tx.QueryRow(`SELECT id FROM session_files WHERE session_id=? AND file_path=?`, sf.SessionID, sf.FilePath).Scan(&sf.ID); err != nil {
+		return err
+	}
 
 	if snap != nil {
-		if snap.SessionFileID == "" {
-			snap.SessionFileID = sf.ID
-		}
+		snap.SessionFileID = sf.ID
 		_, err = tx.Exec(`
 			INSERT OR REPLACE INTO snapshots (id, session_file_id, captured_at, before_text, after_text, before_hash, after_hash, lines_added, lines_removed, compressed)
 			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -210,6 +351,70 @@ func (d *DB) UpsertSessionFile(sf *models.SessionFile, snap *models.Snapshot) er
 	return tx.Commit()
 }
 
+// SessionFileChange returns how path has changed so far in the session.
+func (d *DB) SessionFileChange(sessionID, path string) (models.FileChangeType, bool) {
+	var ct string
+	if err := d.db.QueryRow(`SELECT change_type FROM session_files WHERE session_id=? AND file_path=?`, sessionID, path).Scan(&ct); err != nil {
+		return "", false
+	}
+	return models.FileChangeType(ct), true
+}
+
+// RenameSessionFile moves oldPath's row and its snapshots to newPath, marking
+// it renamed. A row already at newPath was overwritten by the rename and is
+// dropped. It reports false when the session has no row for oldPath.
+func (d *DB) RenameSessionFile(sessionID, oldPath, newPath string, at time.Time) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	if err := tx.QueryRow(`SELECT id FROM session_files WHERE session_id=? AND file_path=?`, sessionID, oldPath).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := deleteSessionFile(tx, sessionID, newPath); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		UPDATE session_files SET
+			file_path=?,
+			change_type=CASE change_type WHEN 'CREATED' THEN 'CREATED' ELSE 'RENAMED' END,
+			old_path=CASE change_type WHEN 'CREATED' THEN NULL ELSE COALESCE(old_path, ?) END,
+			last_seen=?
+		WHERE id=?
+	`, newPath, oldPath, ts(at), id)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// DeleteSessionFile forgets path and its snapshots in the session.
+func (d *DB) DeleteSessionFile(sessionID, path string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := deleteSessionFile(tx, sessionID, path); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteSessionFile(tx *sql.Tx, sessionID, path string) error {
+	if _, err := tx.Exec(`DELETE FROM snapshots WHERE session_file_id IN (SELECT id FROM session_files WHERE session_id=? AND file_path=?)`, sessionID, path); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM session_files WHERE session_id=? AND file_path=?`, sessionID, path)
+	return err
+}
+
 func (d *DB) GetLatestSnapshotContent(sessionID, path string) *[]byte {
 	var content []byte
 	err := d.db.QueryRow(`
@@ -281,7 +486,7 @@ func (d *DB) GetReplay(sessionID string) (*ReplayResult, error) {
 
 	fileRows, err := d.db.Query(`
 		SELECT id, session_id, file_path, change_type, lines_added, lines_removed, save_count,
-			first_seen, last_seen, snapshot_id, is_redacted
+			first_seen, last_seen, snapshot_id, is_redacted, old_path, attribution, attribution_detail, confidence
 		FROM session_files WHERE session_id=? ORDER BY file_path
 	`, sessionID)
 	if err != nil {
@@ -292,11 +497,15 @@ func (d *DB) GetReplay(sessionID string) (*ReplayResult, error) {
 		var f models.SessionFile
 		var ct string
 		var fs, ls int64
-		var sid sql.NullString
+		var sid, old sql.NullString
 		var red int
-		if err := fileRows.Scan(&f.ID, &f.SessionID, &f.FilePath, &ct, &f.LinesAdded, &f.LinesRemoved, &f.SaveCount, &fs, &ls, &sid, &red); err != nil {
+		var method, detail sql.NullString
+		var conf sql.NullInt64
+		if err := fileRows.Scan(&f.ID, &f.SessionID, &f.FilePath, &ct, &f.LinesAdded, &f.LinesRemoved, &f.SaveCount, &fs, &ls, &sid, &red, &old, &method, &detail, &conf); err != nil {
 			return nil, err
 		}
+		f.Attribution = attributionFrom(method, detail, conf)
+		f.OldPath = old.String
 		f.ChangeType = models.FileChangeType(ct)
 		f.FirstSeen = fromTS(fs)
 		f.LastSeen = fromTS(ls)
@@ -308,7 +517,8 @@ func (d *DB) GetReplay(sessionID string) (*ReplayResult, error) {
 	}
 
 	execRows, err := d.db.Query(`
-		SELECT id, session_id, timestamp, command, args, cwd, risk_score, risk_labels
+		SELECT id, session_id, timestamp, command, args, cwd, risk_score, risk_labels, exit_code, exit_signal, duration_ms, container_id, container_image,
+			attribution, attribution_detail, confidence
 		FROM events_exec WHERE session_id=? ORDER BY timestamp
 	`, sessionID)
 	if err != nil {
@@ -319,17 +529,27 @@ func (d *DB) GetReplay(sessionID string) (*ReplayResult, error) {
 		var e models.ExecEvent
 		var tsv int64
 		var args, labels sql.NullString
-		if err := execRows.Scan(&e.ID, &e.SessionID, &tsv, &e.Command, &args, &e.CWD, &e.RiskScore, &labels); err != nil {
+		var code, sig, dur sql.NullInt64
+		var cid, cimage sql.NullString
+		var method, detail sql.NullString
+		var conf sql.NullInt64
+		if err := execRows.Scan(&e.ID, &e.SessionID, &tsv, &e.Command, &args, &e.CWD, &e.RiskScore, &labels, &code, &sig, &dur, &cid, &cimage, &method, &detail, &conf); err != nil {
 			return nil, err
 		}
+		e.Attribution = attributionFrom(method, detail, conf)
+		e.ContainerID, e.ContainerImage = cid.String, cimage.String
 		e.Timestamp = fromTS(tsv)
+		if dur.Valid {
+			e.Exit = &models.ExecExit{Code: int(code.Int64), Signal: int(sig.Int64), Duration: time.Duration(dur.Int64) * time.Millisecond}
+		}
 		e.Args = parseJSONArray[string](args)
 		e.RiskLabels = parseJSONArray[string](labels)
 		res.Execs = append(res.Execs, e)
 	}
 
 	netRows, err := d.db.Query(`
-		SELECT id, session_id, timestamp, remote_ip, remote_port, domain, protocol, bytes_sent, bytes_recv, is_ai_endpoint, risk_score
+		SELECT id, session_id, timestamp, ended_at, action, remote_ip, remote_port, domain, protocol, bytes_sent, bytes_recv, is_ai_endpoint, risk_score,
+			attribution, attribution_detail, confidence
 		FROM events_net WHERE session_id=? ORDER BY timestamp
 	`, sessionID)
 	if err != nil {
@@ -339,12 +559,24 @@ func (d *DB) GetReplay(sessionID string) (*ReplayResult, error) {
 	for netRows.Next() {
 		var n models.NetEvent
 		var tsv int64
-		var domain sql.NullString
+		var ended sql.NullInt64
+		var action, domain sql.NullString
 		var ai int
-		if err := netRows.Scan(&n.ID, &n.SessionID, &tsv, &n.RemoteIP, &n.RemotePort, &domain, &n.Protocol, &n.BytesSent, &n.BytesRecv, &ai, &n.RiskScore); err != nil {
+		var method, detail sql.NullString
+		var conf sql.NullInt64
+		if err := netRows.Scan(&n.ID, &n.SessionID, &tsv, &ended, &action, &n.RemoteIP, &n.RemotePort, &domain, &n.Protocol, &n.BytesSent, &n.BytesRecv, &ai, &n.RiskScore, &method, &detail, &conf); err != nil {
 			return nil, err
 		}
+		n.Attribution = attributionFrom(method, detail, conf)
 		n.Timestamp = fromTS(tsv)
+		if ended.Valid {
+			t := fromTS(ended.Int64)
+			n.EndedAt = &t
+		}
+		n.Action = models.ActionNetConnect
+		if action.Valid && action.String != "" {
+			n.Action = models.ActionType(action.String)
+		}
 		if domain.Valid {
 			n.Domain = &domain.String
 		}
@@ -352,10 +584,113 @@ func (d *DB) GetReplay(sessionID string) (*ReplayResult, error) {
 		res.NetEvents = append(res.NetEvents, n)
 	}
 
+	readRows, err := d.db.Query(`
+		SELECT id, session_id, timestamp, path, pid, process_name, risk_score, risk_labels, attribution, attribution_detail, confidence
+		FROM events_read WHERE session_id=? ORDER BY timestamp
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer readRows.Close()
+	for readRows.Next() {
+		var r models.ReadEvent
+		var tsv int64
+		var proc, labels sql.NullString
+		var method, detail sql.NullString
+		var conf sql.NullInt64
+		if err := readRows.Scan(&r.ID, &r.SessionID, &tsv, &r.Path, &r.PID, &proc, &r.RiskScore, &labels, &method, &detail, &conf); err != nil {
+			return nil, err
+		}
+		r.Attribution = attributionFrom(method, detail, conf)
+		r.Timestamp = fromTS(tsv)
+		r.ProcessName = proc.String
+		r.RiskLabels = parseJSONArray[string](labels)
+		res.Reads = append(res.Reads, r)
+	}
+
+	cRows, err := d.db.Query(`
+		SELECT id, session_id, timestamp, rule, risk_score, triggers, attribution, attribution_detail, confidence
+		FROM events_correlated WHERE session_id=? ORDER BY timestamp
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer cRows.Close()
+	for cRows.Next() {
+		var c models.CorrelatedEvent
+		var tsv int64
+		var triggers sql.NullString
+		var method, detail sql.NullString
+		var conf sql.NullInt64
+		if err := cRows.Scan(&c.ID, &c.SessionID, &tsv, &c.Rule, &c.RiskScore, &triggers, &method, &detail, &conf); err != nil {
+			return nil, err
+		}
+		c.Attribution = attributionFrom(method, detail, conf)
+		c.Timestamp = fromTS(tsv)
+		c.Triggers = parseJSONArray[models.EventRef](triggers)
+		res.Correlated = append(res.Correlated, c)
+	}
+
+	tRows, err := d.db.Query(`
+		SELECT id, session_id, agent, pid, command, started_at, ended_at, exit_code, content, marks, truncated
+		FROM transcripts WHERE session_id=? ORDER BY started_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer tRows.Close()
+	for tRows.Next() {
+		var t models.Transcript
+		var agent string
+		var started, ended int64
+		var content []byte
+		var marks sql.NullString
+		var truncated int
+		if err := tRows.Scan(&t.ID, &t.SessionID, &agent, &t.PID, &t.Command, &started, &ended, &t.ExitCode, &content, &marks, &truncated); err != nil {
+			return nil, err
+		}
+		t.Agent = models.AgentID(agent)
+		t.StartedAt, t.EndedAt = fromTS(started), fromTS(ended)
+		t.Marks = parseJSONArray[models.TranscriptMark](marks)
+		t.Truncated = truncated == 1
+		if zr, err := gzip.NewReader(bytes.NewReader(content)); err == nil {
+			t.Content, _ = io.ReadAll(zr)
+		}
+		res.Transcripts = append(res.Transcripts, t)
+	}
+
+	// An open session runs until now.
+	end := time.Now()
+	if s.EndedAt != nil {
+		end = *s.EndedAt
+	}
+	uRows, err := d.db.Query(`
+		SELECT id, timestamp, action, path, pid, process_name, reason
+		FROM events_unattributed WHERE timestamp BETWEEN ? AND ? ORDER BY timestamp
+	`, ts(s.StartedAt), ts(end))
+	if err != nil {
+		return nil, err
+	}
+	defer uRows.Close()
+	for uRows.Next() {
+		var u models.UnattributedEvent
+		var tsv int64
+		var action string
+		var proc, reason sql.NullString
+		if err := uRows.Scan(&u.ID, &tsv, &action, &u.Path, &u.PID, &proc, &reason); err != nil {
+			return nil, err
+		}
+		u.Timestamp = fromTS(tsv)
+		u.Action = models.ActionType(action)
+		u.ProcessName, u.Reason = proc.String, reason.String
+		res.Unattributed = append(res.Unattributed, u)
+	}
+
 	sRows, err := d.db.Query(`
 		SELECT id, session_file_id, captured_at, before_text, after_text, before_hash, after_hash, lines_added, lines_removed, compressed
 		FROM snapshots
 		WHERE session_file_id IN (SELECT id FROM session_files WHERE session_id=?)
+		ORDER BY captured_at
 	`, sessionID)
 	if err != nil {
 		return nil, err
@@ -413,10 +748,51 @@ func (d *DB) SetDNSEntry(ip, domain string, ttl time.Duration) error {
 	return err
 }
 
+// RecordDNSAnswer stores an answer relayed by the DNS forwarder together
+// with the process that asked for it; resolved_at is when it was asked.
+func (d *DB) RecordDNSAnswer(ip, domain string, ttl time.Duration, pid int, processName string, at time.Time) error {
+	var askedPID, askedProc any
+	if pid > 0 {
+		askedPID, askedProc = pid, processName
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO dns_cache(ip, domain, resolved_at, ttl_seconds, asked_by_pid, asked_by_process)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(ip) DO UPDATE SET domain=excluded.domain, resolved_at=excluded.resolved_at, ttl_seconds=excluded.ttl_seconds,
+			asked_by_pid=excluded.asked_by_pid, asked_by_process=excluded.asked_by_process
+	`, ip, domain, ts(at), int(ttl.Seconds()), askedPID, askedProc)
+	return err
+}
+
+// PurgeOlderThan deletes sessions started before the retention window,
+// with everything recorded under them, and older unattributed events.
 func (d *DB) PurgeOlderThan(olderThan time.Duration) error {
 	cutoff := ts(time.Now().Add(-olderThan))
-	_, err := d.db.Exec("DELETE FROM sessions WHERE started_at < ?", cutoff)
-	return err
+	_, uerr := d.db.Exec("DELETE FROM events_unattributed WHERE timestamp < ?", cutoff)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Children first: the foreign keys have no ON DELETE CASCADE.
+	for _, q := range []string{
+		"DELETE FROM snapshots WHERE session_file_id IN (SELECT id FROM session_files WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?))",
+		"DELETE FROM session_files WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)",
+		"DELETE FROM events_exec WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)",
+		"DELETE FROM events_net WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)",
+		"DELETE FROM events_read WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)",
+		"DELETE FROM events_correlated WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)",
+		"DELETE FROM transcripts WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)",
+		"DELETE FROM sessions WHERE started_at < ?",
+	} {
+		if _, err := tx.Exec(q, cutoff); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return uerr
 }
 
 func (d *DB) getSessionByID(id string) (*models.Session, error) {
@@ -507,6 +883,26 @@ func nullStr(s *string) any {
 	return *s
 }
 
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullConfidence stores no confidence for events that were not attributed,
+// so they never count as the weakest attribution of a file.
+func nullConfidence(a models.Attribution) any {
+	if a.Method == "" {
+		return nil
+	}
+	return a.Confidence
+}
+
+func attributionFrom(method, detail sql.NullString, conf sql.NullInt64) models.Attribution {
+	return models.Attribution{Method: models.AttributionMethod(method.String), Detail: detail.String, Confidence: int(conf.Int64)}
+}
+
 func nullTS(t *time.Time) any {
 	if t == nil {
 		return nil
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"database/sql"
 	"path/filepath"
 	"testing"
 	"time"
@@ -42,14 +43,25 @@ func TestDB_GetLastSessionAndReplay(t *testing.T) {
 		t.Fatalf("expected cursor session %s, got %s", s1.ID, lastCursor.ID)
 	}
 
-	execEv := &models.ExecEvent{ID: "ev_exec_1", SessionID: s1.ID, Timestamp: now, Command: "git push origin main", Args: []string{"push", "origin", "main"}, RiskScore: 65, RiskLabels: []string{"git push"}}
-	netEv := &models.NetEvent{ID: "ev_net_1", SessionID: s1.ID, Timestamp: now, RemoteIP: "1.2.3.4", RemotePort: 443, Protocol: "tcp", RiskScore: 25}
+	execEv := &models.ExecEvent{ID: "ev_exec_1", SessionID: s1.ID, Timestamp: now, Command: "git push origin main", Args: []string{"push", "origin", "main"}, RiskScore: 65, RiskLabels: []string{"git push"}, ContainerID: "3f2a1b9c0d4e", ContainerImage: "node:20"}
+	netEv := &models.NetEvent{ID: "ev_net_1", SessionID: s1.ID, Timestamp: now, RemoteIP: "1.2.3.4", RemotePort: 443, Protocol: "tcp", RiskScore: 25, Attribution: models.Attribution{Method: models.AttrDNS, Confidence: 60, Detail: "api.openai.com"}}
 	if err := db.InsertExecEvent(execEv); err != nil {
 		t.Fatal(err)
 	}
 	if err := db.InsertNetEvent(netEv); err != nil {
 		t.Fatal(err)
 	}
+	if err := db.UpdateNetFlow(netEv.ID, now.Add(12*time.Second), 1200, 3400); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertReadEvent(&models.ReadEvent{ID: "ev_read_1", SessionID: s1.ID, Timestamp: now, Path: "/home/dev/.aws/credentials", PID: 4242, ProcessName: "python3", RiskScore: 75, RiskLabels: []string{"credentials file read"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := &models.Transcript{ID: "tr_1", SessionID: s1.ID, Agent: models.AgentCursor, PID: 77, Command: "node agent.js", StartedAt: now, EndedAt: now.Add(time.Minute), ExitCode: 2, Content: []byte("hello\r\n"), Marks: []models.TranscriptMark{{Offset: 0, At: now}}}
+	if err := db.InsertTranscript(tr); err != nil {
+		t.Fatal(err)
+	}
 
 	sf := &models.SessionFile{ID: "sf_1", SessionID: s1.ID, FilePath: "main.go", ChangeType: models.FileModified, LinesAdded: 3, LinesRemoved: 1, SaveCount: 1, FirstSeen: now, LastSeen: now}
 	before := []byte("old\n")
@@ -58,6 +70,14 @@ func TestDB_GetLastSessionAndReplay(t *testing.T) {
 	if err := db.UpsertSessionFile(sf, snap); err != nil {
 		t.Fatal(err)
 	}
+	// The file keeps the weakest attribution among its changes.
+	for _, a := range []models.Attribution{{Method: models.AttrProcess, Confidence: 90, Detail: "cursor"}, {Method: models.AttrWorkspace, Confidence: 50}, {Method: models.AttrEnv, Confidence: 90, Detail: "CURSOR_TRACE_ID"}, {}} {
+		again := *sf
+		again.ID, again.Attribution = "sf_again", a
+		if err := db.UpsertSessionFile(&again, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
 
 	replay, err := db.GetReplay(s1.ID)
 	if err != nil {
@@ -69,7 +89,122 @@ func TestDB_GetLastSessionAndReplay(t *testing.T) {
 	if len(replay.Execs) != 1 || len(replay.NetEvents) != 1 || len(replay.Files) != 1 {
 		t.Fatalf("unexpected replay counts exec=%d net=%d files=%d", len(replay.Execs), len(replay.NetEvents), len(replay.Files))
 	}
+	if e := replay.Execs[0]; e.ContainerID != "3f2a1b9c0d4e" || e.ContainerImage != "node:20" {
+		t.Fatalf("expected exec container tag to round-trip, got %+v", e)
+	}
+	if len(replay.Reads) != 1 || replay.Reads[0].ProcessName != "python3" || replay.Reads[0].RiskLabels[0] != "credentials file read" {
+		t.Fatalf("unexpected sensitive reads %+v", replay.Reads)
+	}
+	if len(replay.Transcripts) != 1 || string(replay.Transcripts[0].Content) != "hello\r\n" || replay.Transcripts[0].ExitCode != 2 || len(replay.Transcripts[0].Marks) != 1 {
+		t.Fatalf("unexpected transcripts %+v", replay.Transcripts)
+	}
+	if got := replay.Files[0].Attribution; got != (models.Attribution{Method: models.AttrWorkspace, Confidence: 50}) {
+		t.Fatalf("expected the file's weakest attribution, got %+v", got)
+	}
+	if got := replay.NetEvents[0].Attribution; got.Method != models.AttrDNS || got.Confidence != 60 || got.Detail != "api.openai.com" {
+		t.Fatalf("expected net attribution to round-trip, got %+v", got)
+	}
+	if replay.NetEvents[0].Action != models.ActionNetConnect {
+		t.Fatalf("expected net event action to default to NET_CONNECT, got %q", replay.NetEvents[0].Action)
+	}
+	if n := replay.NetEvents[0]; n.EndedAt == nil || n.BytesSent != 1200 || n.BytesRecv != 3400 {
+		t.Fatalf("expected closed flow with byte counts, got %+v", n)
+	}
 	if _, ok := replay.Snapshots[sf.ID]; !ok {
 		t.Fatalf("expected snapshot for session file %s", sf.ID)
 	}
 }
+
+func TestOpen_AddsMissingColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kai.db")
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = raw.Exec(`CREATE TABLE events_net (
+		id TEXT PRIMARY KEY, session_id TEXT NOT NULL, timestamp INTEGER NOT NULL,
+		remote_ip TEXT NOT NULL, remote_port INTEGER NOT NULL, domain TEXT, protocol TEXT DEFAULT 'tcp',
+		bytes_sent INTEGER DEFAULT 0, bytes_recv INTEGER DEFAULT 0, is_ai_endpoint INTEGER DEFAULT 0, risk_score INTEGER DEFAULT 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = raw.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.InsertSession(&models.Session{ID: "cs_one", Agent: models.AgentClaude, StartedAt: time.Now(), LastActivity: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	listen := &models.NetEvent{ID: "ev_net_listen", SessionID: "cs_one", Timestamp: time.Now(), Action: models.ActionNetListen, RemoteIP: "0.0.0.0", RemotePort: 5353, Protocol: "udp"}
+	if err := db.InsertNetEvent(listen); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := db.GetReplay("cs_one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.NetEvents) != 1 || replay.NetEvents[0].Action != models.ActionNetListen || replay.NetEvents[0].Protocol != "udp" {
+		t.Fatalf("unexpected net events: %+v", replay.NetEvents)
+	}
+}
+
+func TestDB_PurgeOlderThan(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "kai.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	old := now.Add(-40 * 24 * time.Hour)
+	for _, s := range []*models.Session{
+		{ID: "cs_old", Agent: models.AgentClaude, StartedAt: old, LastActivity: old},
+		{ID: "cs_new", Agent: models.AgentClaude, StartedAt: now, LastActivity: now},
+	} {
+		if err := db.InsertSession(s); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertExecEvent(&models.ExecEvent{ID: "ev_x_" + s.ID, SessionID: s.ID, Timestamp: s.StartedAt, Command: "ls"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertNetEvent(&models.NetEvent{ID: "ev_n_" + s.ID, SessionID: s.ID, Timestamp: s.StartedAt, RemoteIP: "1.2.3.4", RemotePort: 443, Protocol: "tcp"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertReadEvent(&models.ReadEvent{ID: "ev_r_" + s.ID, SessionID: s.ID, Timestamp: s.StartedAt, Path: "/home/dev/.env"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertCorrelatedEvent(&models.CorrelatedEvent{ID: "ev_c_" + s.ID, SessionID: s.ID, Timestamp: s.StartedAt, Rule: "secret read then external connection", RiskScore: 95}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertTranscript(&models.Transcript{ID: "tr_" + s.ID, SessionID: s.ID, Agent: s.Agent, StartedAt: s.StartedAt, EndedAt: s.StartedAt}); err != nil {
+			t.Fatal(err)
+		}
+		after := []byte("x\n")
+		sf := &models.SessionFile{ID: "sf_" + s.ID, SessionID: s.ID, FilePath: "main.go", ChangeType: models.FileModified, FirstSeen: s.StartedAt, LastSeen: s.StartedAt}
+		if err := db.UpsertSessionFile(sf, &models.Snapshot{ID: "sn_" + s.ID, SessionFileID: sf.ID, CapturedAt: s.StartedAt, AfterText: &after}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertUnattributedEvent(&models.UnattributedEvent{ID: "ev_u_" + s.ID, Timestamp: s.StartedAt, Action: models.ActionFileWrite, Path: "/tmp/x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.PurgeOlderThan(30 * 24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"sessions", "events_exec", "events_net", "events_read", "events_correlated", "transcripts", "session_files", "snapshots", "events_unattributed"} {
+		var n int
+		if err := db.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("%s: %d rows left, want only the recent one", table, n)
+		}
+	}
+	if _, err := db.GetReplay("cs_new"); err != nil {
+		t.Fatalf("expected the recent session to survive, got %v", err)
+	}
+}